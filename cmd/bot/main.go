@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -12,8 +13,15 @@ import (
 	"github.com/crayon/wrap-bot/internal/tasks"
 	"github.com/crayon/wrap-bot/pkgs/bot"
 	scheduler "github.com/crayon/wrap-bot/pkgs/feature"
+	"github.com/crayon/wrap-bot/pkgs/feature/archive"
+	"github.com/crayon/wrap-bot/pkgs/feature/digest"
+	"github.com/crayon/wrap-bot/pkgs/feature/jobs"
+	"github.com/crayon/wrap-bot/pkgs/feature/outbound"
+	"github.com/crayon/wrap-bot/pkgs/feature/permission"
+	"github.com/crayon/wrap-bot/pkgs/lifecycle"
 	"github.com/crayon/wrap-bot/pkgs/logger"
 	"github.com/crayon/wrap-bot/pkgs/napcat"
+	"github.com/crayon/wrap-bot/pkgs/ratelimit"
 	"github.com/crayon/wrap-bot/plugins"
 	"github.com/joho/godotenv"
 )
@@ -35,18 +43,126 @@ func main() {
 	sched := scheduler.New()
 	wsHub := adminws.NewHub()
 
+	dispatcher := outbound.NewDispatcher(outbound.Config{
+		GlobalInterval: time.Duration(cfg.OutboundGlobalIntervalMs) * time.Millisecond,
+		TargetInterval: time.Duration(cfg.OutboundTargetIntervalMs) * time.Millisecond,
+		MaxRetries:     cfg.OutboundMaxRetries,
+		RetryDelay:     time.Duration(cfg.OutboundRetryDelayMs) * time.Millisecond,
+	})
+	outbound.SetDefault(dispatcher)
+
 	apiClient := napcat.NewClient(cfg.NapCatHTTPURL, cfg.NapCatHTTPToken)
-	wsClient := napcat.NewWSClient(cfg.NapCatWSURL, cfg.NapCatWSToken)
+	actionTimeout := time.Duration(cfg.NapCatActionTimeout) * time.Second
+
+	var eventClient bot.WebSocketClient
+	var actionTransport napcat.Transport
+
+	switch cfg.NapCatEventMode {
+	case "reverse_ws":
+		server := napcat.NewReverseWSServer(cfg.NapCatListenAddr, cfg.NapCatReverseWSPath, cfg.NapCatWSToken)
+		server.SetActionTimeout(actionTimeout)
+		if cfg.NapCatActionMode == "ws" {
+			// Each bot connecting to the server gets an account whose
+			// replies go back over its own connection.
+			server.OnConnect(func(selfID int64) {
+				name := fmt.Sprintf("reverse_%d", selfID)
+				if _, ok := engine.AccountByName(name); ok {
+					return
+				}
+				client := server.ForSelf(selfID)
+				engine.AddAccount(&bot.Account{Name: name, SelfID: selfID, API: outbound.NewClient(client, dispatcher)})
+				napcat.RegisterAccount(name, client)
+			})
+		}
+		eventClient, actionTransport = server, server
+	case "http_post":
+		eventClient = napcat.NewHTTPPostServer(cfg.NapCatListenAddr, cfg.NapCatPostPath, cfg.NapCatPostSecret)
+	default:
+		wsClient := napcat.NewWSClient(cfg.NapCatWSURL, cfg.NapCatWSToken)
+		wsClient.SetActionTimeout(actionTimeout)
+		wsClient.OnStateChange(connectionReporter(wsHub, "default"))
+		eventClient, actionTransport = wsClient, wsClient
+	}
+
+	if cfg.NapCatActionMode == "ws" {
+		if actionTransport != nil {
+			napcat.SetDefaultTransport(actionTransport)
+			logger.Info("Sending NapCat actions over the event WebSocket")
+		} else {
+			logger.Warn("NAPCAT_ACTION_MODE=ws needs a WebSocket event mode, falling back to HTTP")
+		}
+	}
+
+	// Replies go through the outbound queue like scheduled pushes, so both
+	// share one send rate.
+	replyClient := outbound.NewClient(apiClient, dispatcher)
+	engine.SetAPIClient(replyClient)
+	engine.SetWebSocketClient(eventClient)
+	napcat.RegisterAccount("default", apiClient)
+
+	accounts, err := config.LoadAccounts(cfg.NapCatAccountsFile)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to load accounts: %v", err))
+	}
+	for _, account := range accounts {
+		accountWS := napcat.NewWSClient(account.WSURL, account.WSToken)
+		accountWS.SetActionTimeout(actionTimeout)
+		accountWS.OnStateChange(connectionReporter(wsHub, account.Name))
 
-	engine.SetAPIClient(apiClient)
-	engine.SetWebSocketClient(wsClient)
+		accountAPI := napcat.NewHTTPClient(account.HTTPURL, account.HTTPToken)
+		if account.ActionMode == "ws" {
+			accountAPI = accountWS.Client
+		}
+
+		engine.AddAccount(&bot.Account{Name: account.Name, Events: accountWS, API: outbound.NewClient(accountAPI, dispatcher)})
+		napcat.RegisterAccount(account.Name, accountAPI)
+		logger.Info(fmt.Sprintf("Added bot account %s: %s", account.Name, account.WSURL))
+	}
+
+	engine.SetMaxWorkers(cfg.EventWorkers)
+	engine.SetQueueConfig(bot.QueueConfig{
+		Policy:   bot.OverflowPolicy(cfg.EventOverflowPolicy),
+		Size:     cfg.EventQueueSize,
+		ChatSize: cfg.EventChatQueueSize,
+		Key:      eventOrderKey(cfg.EventOrder),
+	})
+	engine.SetPromptCancelWords("取消", "cancel", cfg.CommandPrefix+"cancel")
 
 	engine.Use(bot.Recovery())
 	engine.Use(bot.Logger())
 	engine.Use(bot.Authentication(cfg.AllowedUsers, cfg.AllowedGroups))
-	engine.Use(bot.InjectAPIClient(apiClient))
+	engine.Use(bot.InjectAPIClient(replyClient))
+
+	perms := permission.NewManager(cfg.Superusers, cfg.AdminIDs, cfg.CommandPrefix, cfg.PermissionsPath)
+	permission.SetDefault(perms)
+	engine.SetAuthorizer(perms)
+
+	jobManager := jobs.Default()
+	jobManager.SetMaxPerUser(cfg.JobMaxPerUser)
+
+	if cfg.AIEnabled && cfg.DigestEnabled {
+		digest.SetDefault(digest.NewRecorder(
+			cfg.DigestGroups,
+			time.Duration(cfg.DigestRetentionHours)*time.Hour,
+			cfg.DigestMaxMessages,
+			cfg.DigestOptOutPath,
+		))
+	}
+
+	if cfg.ArchiveEnabled {
+		store, err := archive.NewArchive(cfg.ArchiveDir, cfg.ArchiveRetentionDays)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open message archive: %v", err))
+		} else {
+			archive.SetDefault(store)
+			napcat.OnMessageSent(func(msg napcat.SentMessage) {
+				store.Add(archive.FromSent(msg))
+			})
+		}
+	}
 
 	plugins.Register(engine, cfg)
+	applyRateLimits(engine, cfg)
 	tasks.RegisterAll(sched, cfg)
 
 	sched.Start()
@@ -56,6 +172,9 @@ func main() {
 		Scheduler: sched,
 		Config:    cfg,
 		WSHub:     wsHub,
+		Jobs:      jobManager,
+		Archive:   archive.Default(),
+		Outbound:  dispatcher,
 	})
 
 	go wsHub.Run()
@@ -64,16 +183,102 @@ func main() {
 		wsHub.BroadcastLog(entry)
 	})
 
+	jobManager.SetOnChange(func(list []jobs.Info) {
+		wsHub.BroadcastJobs(list)
+	})
+
+	dispatcher.SetOnChange(func(list []outbound.Delivery) {
+		wsHub.BroadcastOutbound(list)
+	})
+
 	go adminws.StartStatusBroadcaster(wsHub, engine, 3*time.Second)
 
+	// Components stop in this order: event sources and handlers first, so
+	// nothing new is scheduled or sent, then scheduled tasks, the outbound
+	// queue, the archive and finally the admin server.
+	shutdown := lifecycle.New()
+	shutdown.Add("bot engine", engine.Shutdown)
+	shutdown.Add("scheduler", lifecycle.Wait(sched.Stop))
+	shutdown.Add("outbound queue", dispatcher.Close)
+	if store := archive.Default(); store != nil {
+		shutdown.Add("archive", func(ctx context.Context) error {
+			return store.Close()
+		})
+	}
+
 	if cfg.ServerEnabled {
 		logger.Info(fmt.Sprintf("Starting admin server on port %s", cfg.ServerPort))
-		admin.StartServer(cfg.ServerPort)
+		server := admin.StartServer(cfg.ServerPort)
+		shutdown.Add("admin server", server.Shutdown)
 	}
 
-	logger.Info(fmt.Sprintf("Starting bot with NapCat WebSocket: %s", cfg.NapCatWSURL))
-	if err := engine.Run(); err != nil {
-		logger.Error(fmt.Sprintf("Bot stopped with error: %v", err))
+	switch cfg.NapCatEventMode {
+	case "reverse_ws", "http_post":
+		logger.Info(fmt.Sprintf("Starting bot with NapCat %s on %s", cfg.NapCatEventMode, cfg.NapCatListenAddr))
+	default:
+		logger.Info(fmt.Sprintf("Starting bot with NapCat WebSocket: %s", cfg.NapCatWSURL))
+	}
+	runErr := engine.Run()
+	if err := shutdown.Shutdown(time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second); err != nil {
+		logger.Warn(fmt.Sprintf("Shutdown incomplete: %v", err))
+	}
+	if runErr != nil {
+		logger.Error(fmt.Sprintf("Bot stopped with error: %v", runErr))
 		os.Exit(1)
 	}
 }
+
+// applyRateLimits restores the per-plugin rate limits saved from the admin
+// dashboard.
+func applyRateLimits(engine *bot.Engine, cfg *config.Config) {
+	engine.SetRateLimitReply(cfg.RateLimitMessage, time.Duration(cfg.RateLimitCooldownSeconds)*time.Second)
+
+	rules, err := ratelimit.LoadRules(cfg.RateLimitsPath)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to load rate limits: %v", err))
+		return
+	}
+	for name, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			logger.Warn(fmt.Sprintf("Ignoring rate limit of plugin %s: %v", name, err))
+			continue
+		}
+		if !engine.SetPluginRateLimit(name, &rule) {
+			logger.Warn(fmt.Sprintf("Ignoring rate limit of unknown plugin %s", name))
+			continue
+		}
+		logger.Info(fmt.Sprintf("Rate limit of plugin %s: %s", name, rule))
+	}
+}
+
+// eventOrderKey maps EVENT_ORDER to the key that decides which events are
+// handled one at a time.
+func eventOrderKey(order string) bot.ChatKeyFunc {
+	switch order {
+	case "chat":
+		return bot.ChatKey
+	case "none":
+		return bot.Unordered
+	case "user", "":
+		return bot.UserKey
+	default:
+		logger.Warn(fmt.Sprintf("Unknown EVENT_ORDER %q, ordering events per user", order))
+		return bot.UserKey
+	}
+}
+
+// connectionReporter forwards an account's WebSocket state changes to the
+// admin dashboard.
+func connectionReporter(hub *adminws.Hub, account string) func(napcat.StateChange) {
+	return func(change napcat.StateChange) {
+		hub.BroadcastConnection(map[string]interface{}{
+			"account":  account,
+			"state":    change.State,
+			"url":      change.URL,
+			"attempt":  change.Attempt,
+			"delay_ms": change.Delay.Milliseconds(),
+			"error":    change.Error,
+			"time":     change.Time.Unix(),
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crayon/wrap-bot/internal/shared"
+	"github.com/crayon/wrap-bot/pkgs/feature/archive"
+	"github.com/labstack/echo/v4"
+)
+
+type ArchiveMessagesResponse struct {
+	Total    int              `json:"total"`
+	Offset   int              `json:"offset"`
+	Limit    int              `json:"limit"`
+	Messages []archive.Record `json:"messages"`
+}
+
+func getArchive(c echo.Context) (*archive.Archive, error) {
+	ctx := shared.GetAdminContext()
+	if ctx == nil || ctx.Archive == nil {
+		return nil, c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "message archive not enabled",
+		})
+	}
+	return ctx.Archive, nil
+}
+
+func GetArchiveMessages(c echo.Context) error {
+	store, err := getArchive(c)
+	if store == nil {
+		return err
+	}
+
+	query, err := parseArchiveQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	query.Limit = 50
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l > 0 && l <= 500 {
+		query.Limit = l
+	}
+	if o, err := strconv.Atoi(c.QueryParam("offset")); err == nil && o > 0 {
+		query.Offset = o
+	}
+
+	messages, total := store.Search(query)
+	if messages == nil {
+		messages = []archive.Record{}
+	}
+
+	return c.JSON(http.StatusOK, ArchiveMessagesResponse{
+		Total:    total,
+		Offset:   query.Offset,
+		Limit:    query.Limit,
+		Messages: messages,
+	})
+}
+
+func GetArchiveGroups(c echo.Context) error {
+	store, err := getArchive(c)
+	if store == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"total":          store.Count(),
+		"retention_days": store.RetentionDays(),
+		"groups":         store.Groups(),
+	})
+}
+
+func ExportArchive(c echo.Context) error {
+	store, err := getArchive(c)
+	if store == nil {
+		return err
+	}
+
+	query, err := parseArchiveQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	format := archive.ExportFormat(c.QueryParam("format"))
+	contentType := map[archive.ExportFormat]string{
+		archive.ExportJSONL: "application/x-ndjson",
+		archive.ExportCSV:   "text/csv; charset=utf-8",
+		archive.ExportText:  "text/plain; charset=utf-8",
+	}
+	if format == "" {
+		format = archive.ExportJSONL
+	}
+	if _, ok := contentType[format]; !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "format must be jsonl, csv or txt",
+		})
+	}
+
+	filename := fmt.Sprintf("archive-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Response().Header().Set(echo.HeaderContentType, contentType[format])
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	return store.Export(c.Response(), query, format)
+}
+
+func PruneArchive(c echo.Context) error {
+	store, err := getArchive(c)
+	if store == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{
+		"removed": store.Prune(),
+		"total":   store.Count(),
+	})
+}
+
+func parseArchiveQuery(c echo.Context) (archive.Query, error) {
+	query := archive.Query{
+		Keywords:  c.QueryParam("q"),
+		Direction: archive.Direction(c.QueryParam("direction")),
+	}
+
+	var err error
+	if v := c.QueryParam("group_id"); v != "" {
+		if query.GroupID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return query, fmt.Errorf("invalid group_id: %s", v)
+		}
+	}
+	if v := c.QueryParam("user_id"); v != "" {
+		if query.UserID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return query, fmt.Errorf("invalid user_id: %s", v)
+		}
+	}
+	if query.Since, err = parseArchiveTime(c.QueryParam("since")); err != nil {
+		return query, err
+	}
+	if query.Until, err = parseArchiveTime(c.QueryParam("until")); err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// parseArchiveTime accepts a unix timestamp, an RFC 3339 time or a date.
+func parseArchiveTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", v)
+}
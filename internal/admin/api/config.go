@@ -11,38 +11,100 @@ import (
 )
 
 var configDescriptions = map[string]string{
-	"NAPCAT_HTTP_URL":      "NapCat HTTP API address",
-	"NAPCAT_WS_URL":        "NapCat WebSocket address",
-	"NAPCAT_HTTP_TOKEN":    "NapCat HTTP authentication token",
-	"NAPCAT_WS_TOKEN":      "NapCat WebSocket authentication token",
-	"SERVER_PORT":          "Admin backend port",
-	"SERVER_ENABLED":       "Whether admin backend is enabled",
-	"DEBUG":                "DEBUG mode",
-	"COMMAND_PREFIX":       "Command prefix",
-	"AI_ENABLED":           "Whether AI features are enabled",
-	"AI_URL":               "AI API address",
-	"AI_KEY":               "AI API key",
-	"AI_MODEL":             "AI model name",
-	"AI_TEMPERATURE":       "AI temperature parameter",
-	"AI_TOP_P":             "AI Top-P parameter",
-	"AI_MAX_TOKENS":        "AI max tokens",
-	"AI_MAX_HISTORY":       "AI max history records",
-	"AI_IMAGE_DETAIL":      "Image processing detail (high/low/auto)",
-	"AI_TOOLS":             "Enabled tools (comma-separated)",
-	"SYSTEM_PROMPT_PATH":   "System prompt path",
-	"ANALYZER_PROMPT_PATH": "Analyzer prompt path",
-	"HOT_API_HOST":         "Hot API URL",
-	"HOT_API_KEY":          "Hot API key",
-	"RSS_API_HOST":         "RSS API URL",
-	"TECH_PUSH_GROUPS":     "Tech push group IDs (comma-separated)",
-	"TECH_PUSH_USERS":      "Tech push user IDs (comma-separated)",
-	"RSS_PUSH_GROUPS":      "RSS push group IDs (comma-separated)",
-	"RSS_PUSH_USERS":       "RSS push user IDs (comma-separated)",
-	"ALLOWED_USERS":        "Allowed user IDs (comma-separated)",
-	"ALLOWED_GROUPS":       "Allowed group IDs (comma-separated)",
-	"ADMIN_IDS":            "Admin user IDs (comma-separated)",
-	"SERP_API_KEY":         "SerpAPI key (web search)",
-	"WEATHER_API_KEY":      "WeatherAPI key (weather query)",
+	"NAPCAT_HTTP_URL":               "NapCat HTTP API address",
+	"NAPCAT_WS_URL":                 "NapCat WebSocket address",
+	"NAPCAT_HTTP_TOKEN":             "NapCat HTTP authentication token",
+	"NAPCAT_WS_TOKEN":               "NapCat WebSocket authentication token",
+	"NAPCAT_ACTION_MODE":            "How actions are sent to NapCat: http or ws (reuse the event WebSocket)",
+	"NAPCAT_ACTION_TIMEOUT_SECONDS": "Timeout for actions sent over the WebSocket",
+	"NAPCAT_EVENT_MODE":             "How events are received: ws (connect to NAPCAT_WS_URL), reverse_ws or http_post",
+	"NAPCAT_LISTEN_ADDR":            "Listen address for reverse WebSocket and HTTP POST modes",
+	"NAPCAT_REVERSE_WS_PATH":        "Reverse WebSocket path (/api and /event suffixes for split roles)",
+	"NAPCAT_POST_PATH":              "HTTP POST event receiver path",
+	"NAPCAT_POST_SECRET":            "HMAC secret for verifying the X-Signature of HTTP POST events",
+	"NAPCAT_ACCOUNTS_FILE":          "JSON file listing additional bot accounts",
+	"PUSH_ACCOUNTS":                 "Account used for scheduled pushes per group or user (id:account,...)",
+	"OUTBOUND_GLOBAL_INTERVAL_MS":   "Minimum gap between any two sent messages (replies and pushes) in milliseconds",
+	"OUTBOUND_TARGET_INTERVAL_MS":   "Minimum gap between messages sent to the same group or user in milliseconds",
+	"OUTBOUND_MAX_RETRIES":          "Retries for sends failing with a temporary NapCat error",
+	"OUTBOUND_RETRY_DELAY_MS":       "Delay before the first retry of a send, doubled for each further retry",
+	"EVENT_WORKERS":                 "Number of incoming events handled at the same time",
+	"EVENT_QUEUE_SIZE":              "Maximum number of incoming events waiting for a worker",
+	"EVENT_CHAT_QUEUE_SIZE":         "Maximum waiting events per chat with the per_chat overflow policy",
+	"EVENT_OVERFLOW_POLICY":         "What to do when the event queue is full: block, drop_oldest or per_chat",
+	"EVENT_ORDER":                   "Which events are handled one at a time in order: user, chat or none",
+	"RATE_LIMITS_PATH":              "File the per-plugin rate limits set in the dashboard are saved to",
+	"RATE_LIMIT_MESSAGE":            "Reply to rate-limited users ({seconds} until they may retry; empty stays silent)",
+	"RATE_LIMIT_COOLDOWN_SECONDS":   "Minimum time between two rate-limit replies to the same user or group",
+	"SHUTDOWN_TIMEOUT_SECONDS":      "Time allowed for running handlers and tasks to finish on shutdown",
+	"SERVER_PORT":                   "Admin backend port",
+	"SERVER_ENABLED":                "Whether admin backend is enabled",
+	"DEBUG":                         "DEBUG mode",
+	"COMMAND_PREFIX":                "Command prefix",
+	"AI_ENABLED":                    "Whether AI features are enabled",
+	"AI_URL":                        "AI API address",
+	"AI_KEY":                        "AI API key",
+	"AI_MODEL":                      "AI model name",
+	"AI_TEMPERATURE":                "AI temperature parameter",
+	"AI_TOP_P":                      "AI Top-P parameter",
+	"AI_MAX_TOKENS":                 "AI max tokens",
+	"AI_MAX_HISTORY":                "AI max history records",
+	"AI_IMAGE_DETAIL":               "Image processing detail (high/low/auto)",
+	"AI_IMAGE_CACHE_DIR":            "Directory for cached, downsized images (pruned after 7 days or past 256 MB)",
+	"AI_IMAGE_MAX_BYTES":            "Maximum accepted image size in bytes",
+	"AI_IMAGE_MAX_DIMENSION":        "Longest image side after downsizing (pixels)",
+	"AI_TOOLS":                      "Enabled tools (comma-separated)",
+	"SYSTEM_PROMPT_PATH":            "System prompt path",
+	"ANALYZER_PROMPT_PATH":          "Analyzer prompt path",
+	"HOT_API_HOST":                  "Hot API URL",
+	"HOT_API_KEY":                   "Hot API key",
+	"RSS_API_HOST":                  "RSS API URL",
+	"TECH_PUSH_GROUPS":              "Tech push group IDs (comma-separated)",
+	"TECH_PUSH_USERS":               "Tech push user IDs (comma-separated)",
+	"RSS_PUSH_GROUPS":               "RSS push group IDs (comma-separated)",
+	"RSS_PUSH_USERS":                "RSS push user IDs (comma-separated)",
+	"ALLOWED_USERS":                 "Allowed user IDs (comma-separated)",
+	"ALLOWED_GROUPS":                "Allowed group IDs (comma-separated)",
+	"ADMIN_IDS":                     "Bot admin user IDs (comma-separated)",
+	"SUPERUSERS":                    "Superuser IDs who manage permissions with /perm (comma-separated)",
+	"PERMISSIONS_PATH":              "File the roles and grants set with /perm are saved to",
+	"SERP_API_KEY":                  "SerpAPI key (web search)",
+	"WEATHER_API_KEY":               "WeatherAPI key (weather query)",
+	"AI_VOICE_ENABLED":              "Whether voice input/output is enabled",
+	"AI_STT_MODEL":                  "Speech-to-text model",
+	"AI_TTS_MODEL":                  "Text-to-speech model",
+	"AI_TTS_VOICE":                  "Default text-to-speech voice",
+	"AI_TTS_GROUPS":                 "Group IDs replied to with voice (comma-separated)",
+	"AI_TTS_USERS":                  "User IDs replied to with voice (comma-separated)",
+	"AI_TTS_VOICES":                 "Per-group voices (group_id:voice, comma-separated)",
+	"AI_FILE_MAX_BYTES":             "Maximum size of files read by AI chat (bytes)",
+	"AI_DOC_CONTEXT_TOKENS":         "Token budget for document excerpts per question",
+	"AI_DOC_TTL_MINUTES":            "How long uploaded documents stay in a conversation",
+	"EXPLAINER_MODE":                "Chat explainer mode (auto, single, windowed, chain)",
+	"EXPLAINER_WINDOW_SIZE":         "Messages per window in windowed explainer analysis",
+	"EXPLAINER_CONCURRENCY":         "Concurrent explainer requests in windowed mode",
+	"EXPLAINER_TIMEOUT_SECONDS":     "Timeout for each explainer AI request (seconds)",
+	"EXPLAINER_MAX_DEPTH":           "Levels of nested forwards expanded by the chat explainer",
+	"DIGEST_ENABLED":                "Whether group chat digests are enabled",
+	"DIGEST_GROUPS":                 "Group IDs recorded for digests (comma-separated)",
+	"DIGEST_TIME":                   "Daily digest time (HH:MM)",
+	"DIGEST_RETENTION_HOURS":        "How long recorded messages are kept for digests",
+	"DIGEST_MAX_MESSAGES":           "Maximum recorded messages per group",
+	"DIGEST_OPTOUT_PATH":            "File storing users who opted out of digests",
+	"ARCHIVE_ENABLED":               "Whether incoming and outgoing messages are archived for search",
+	"ARCHIVE_DIR":                   "Directory storing the message archive",
+	"ARCHIVE_RETENTION_DAYS":        "Days archived messages are kept (0 keeps everything)",
+	"NOTICE_GROUPS":                 "Groups handled by the notice plugin (comma-separated, empty for all)",
+	"WELCOME_MESSAGE":               "Welcome message for new members ({at}, {name}, {user_id}, {group_id}; empty disables)",
+	"FAREWELL_MESSAGE":              "Message posted when a member leaves (same placeholders; empty only logs)",
+	"ANTI_RECALL_ENABLED":           "Whether recalled group messages are logged",
+	"AUTO_APPROVE_FRIEND":           "Whether matching friend requests are approved automatically",
+	"AUTO_APPROVE_GROUP":            "Whether matching group join requests and invites are approved automatically",
+	"APPROVE_KEYWORDS":              "Request comments containing one of these keywords are approved (comma-separated)",
+	"APPROVE_USERS":                 "User IDs whose requests are always approved (comma-separated)",
+	"REJECT_UNMATCHED_REQUESTS":     "Whether requests matching no rule are rejected instead of left pending",
+	"JOB_MAX_PER_USER":              "Maximum concurrent long-running jobs per user",
+	"JOB_PROGRESS_INTERVAL_SECONDS": "Interval between job progress messages (seconds, 0 disables)",
 }
 
 func GetConfig(c echo.Context) error {
@@ -51,6 +113,28 @@ func GetConfig(c echo.Context) error {
 		"NAPCAT_WS_URL",
 		"NAPCAT_HTTP_TOKEN",
 		"NAPCAT_WS_TOKEN",
+		"NAPCAT_ACTION_MODE",
+		"NAPCAT_ACTION_TIMEOUT_SECONDS",
+		"NAPCAT_EVENT_MODE",
+		"NAPCAT_LISTEN_ADDR",
+		"NAPCAT_REVERSE_WS_PATH",
+		"NAPCAT_POST_PATH",
+		"NAPCAT_POST_SECRET",
+		"NAPCAT_ACCOUNTS_FILE",
+		"PUSH_ACCOUNTS",
+		"OUTBOUND_GLOBAL_INTERVAL_MS",
+		"OUTBOUND_TARGET_INTERVAL_MS",
+		"OUTBOUND_MAX_RETRIES",
+		"OUTBOUND_RETRY_DELAY_MS",
+		"EVENT_WORKERS",
+		"EVENT_QUEUE_SIZE",
+		"EVENT_CHAT_QUEUE_SIZE",
+		"EVENT_OVERFLOW_POLICY",
+		"EVENT_ORDER",
+		"RATE_LIMITS_PATH",
+		"RATE_LIMIT_MESSAGE",
+		"RATE_LIMIT_COOLDOWN_SECONDS",
+		"SHUTDOWN_TIMEOUT_SECONDS",
 		"SERVER_PORT",
 		"SERVER_ENABLED",
 		"DEBUG",
@@ -64,6 +148,9 @@ func GetConfig(c echo.Context) error {
 		"AI_MAX_TOKENS",
 		"AI_MAX_HISTORY",
 		"AI_IMAGE_DETAIL",
+		"AI_IMAGE_CACHE_DIR",
+		"AI_IMAGE_MAX_BYTES",
+		"AI_IMAGE_MAX_DIMENSION",
 		"AI_TOOLS",
 		"SYSTEM_PROMPT_PATH",
 		"ANALYZER_PROMPT_PATH",
@@ -77,8 +164,45 @@ func GetConfig(c echo.Context) error {
 		"ALLOWED_USERS",
 		"ALLOWED_GROUPS",
 		"ADMIN_IDS",
+		"SUPERUSERS",
+		"PERMISSIONS_PATH",
 		"SERP_API_KEY",
 		"WEATHER_API_KEY",
+		"AI_VOICE_ENABLED",
+		"AI_STT_MODEL",
+		"AI_TTS_MODEL",
+		"AI_TTS_VOICE",
+		"AI_TTS_GROUPS",
+		"AI_TTS_USERS",
+		"AI_TTS_VOICES",
+		"AI_FILE_MAX_BYTES",
+		"AI_DOC_CONTEXT_TOKENS",
+		"AI_DOC_TTL_MINUTES",
+		"EXPLAINER_MODE",
+		"EXPLAINER_WINDOW_SIZE",
+		"EXPLAINER_CONCURRENCY",
+		"EXPLAINER_TIMEOUT_SECONDS",
+		"EXPLAINER_MAX_DEPTH",
+		"JOB_MAX_PER_USER",
+		"JOB_PROGRESS_INTERVAL_SECONDS",
+		"DIGEST_ENABLED",
+		"DIGEST_GROUPS",
+		"DIGEST_TIME",
+		"DIGEST_RETENTION_HOURS",
+		"DIGEST_MAX_MESSAGES",
+		"DIGEST_OPTOUT_PATH",
+		"ARCHIVE_ENABLED",
+		"ARCHIVE_DIR",
+		"ARCHIVE_RETENTION_DAYS",
+		"NOTICE_GROUPS",
+		"WELCOME_MESSAGE",
+		"FAREWELL_MESSAGE",
+		"ANTI_RECALL_ENABLED",
+		"AUTO_APPROVE_FRIEND",
+		"AUTO_APPROVE_GROUP",
+		"APPROVE_KEYWORDS",
+		"APPROVE_USERS",
+		"REJECT_UNMATCHED_REQUESTS",
 	}
 
 	config := make([]types.ConfigItem, 0, len(configKeys))
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/crayon/wrap-bot/internal/shared"
+	"github.com/labstack/echo/v4"
+)
+
+func GetJobs(c echo.Context) error {
+	ctx := shared.GetAdminContext()
+	if ctx == nil || ctx.Jobs == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "job manager not available",
+		})
+	}
+
+	return c.JSON(http.StatusOK, ctx.Jobs.List())
+}
+
+func CancelJob(c echo.Context) error {
+	jobID := c.Param("id")
+
+	ctx := shared.GetAdminContext()
+	if ctx == nil || ctx.Jobs == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "job manager not available",
+		})
+	}
+
+	if err := ctx.Jobs.Cancel(jobID, 0, true); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+			"id":    jobID,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": "cancelled",
+		"job_id": jobID,
+	})
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/crayon/wrap-bot/internal/shared"
+	"github.com/labstack/echo/v4"
+)
+
+func GetOutbound(c echo.Context) error {
+	ctx := shared.GetAdminContext()
+	if ctx == nil || ctx.Outbound == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "outbound dispatcher not available",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"stats":      ctx.Outbound.Stats(),
+		"deliveries": ctx.Outbound.List(),
+	})
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"net/http"
+	"sort"
 
 	"github.com/crayon/wrap-bot/internal/admin/types"
 	"github.com/crayon/wrap-bot/internal/shared"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/ratelimit"
 	"github.com/labstack/echo/v4"
 )
 
@@ -14,16 +17,7 @@ func GetPlugins(c echo.Context) error {
 		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "engine not available"})
 	}
 
-	pluginsMap := ctx.Engine.GetPlugins()
-	plugins := []types.PluginStatus{}
-	for name, info := range pluginsMap {
-		plugins = append(plugins, types.PluginStatus{
-			Name:        name,
-			Enabled:     info.Enabled,
-			Description: info.Description,
-		})
-	}
-	return c.JSON(http.StatusOK, plugins)
+	return c.JSON(http.StatusOK, pluginStatuses(ctx.Engine))
 }
 
 func TogglePlugin(c echo.Context) error {
@@ -38,16 +32,7 @@ func TogglePlugin(c echo.Context) error {
 	}
 
 	if ctx.WSHub != nil {
-		pluginsMap := ctx.Engine.GetPlugins()
-		plugins := []types.PluginStatus{}
-		for name, info := range pluginsMap {
-			plugins = append(plugins, types.PluginStatus{
-				Name:        name,
-				Enabled:     info.Enabled,
-				Description: info.Description,
-			})
-		}
-		ctx.WSHub.BroadcastPlugins(plugins)
+		ctx.WSHub.BroadcastPlugins(pluginStatuses(ctx.Engine))
 	}
 
 	enabled := ctx.Engine.IsPluginEnabled(name)
@@ -56,3 +41,73 @@ func TogglePlugin(c echo.Context) error {
 		Enabled: enabled,
 	})
 }
+
+// SetPluginRateLimit limits how often a plugin handles events. A body with
+// zero events removes the limit. Limits are saved to RATE_LIMITS_PATH.
+func SetPluginRateLimit(c echo.Context) error {
+	ctx := shared.GetAdminContext()
+	if ctx == nil || ctx.Engine == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "engine not available"})
+	}
+
+	var rule ratelimit.Rule
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	var limit *ratelimit.Rule
+	if rule.Events != 0 {
+		if rule.Scope == "" {
+			rule.Scope = ratelimit.ScopeUser
+		}
+		if err := rule.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		limit = &rule
+	}
+
+	name := c.Param("name")
+	if !ctx.Engine.SetPluginRateLimit(name, limit) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "plugin not found"})
+	}
+
+	if ctx.Config != nil {
+		if err := ratelimit.SaveRules(ctx.Config.RateLimitsPath, ctx.Engine.PluginRateLimits()); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to save rate limits: " + err.Error()})
+		}
+	}
+
+	plugins := pluginStatuses(ctx.Engine)
+	if ctx.WSHub != nil {
+		ctx.WSHub.BroadcastPlugins(plugins)
+	}
+
+	for _, plugin := range plugins {
+		if plugin.Name == name {
+			return c.JSON(http.StatusOK, plugin)
+		}
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "plugin not found"})
+}
+
+// pluginStatuses lists the plugins in the order they see events.
+func pluginStatuses(engine *bot.Engine) []types.PluginStatus {
+	plugins := []types.PluginStatus{}
+	for name, info := range engine.GetPlugins() {
+		plugins = append(plugins, types.PluginStatus{
+			Name:        name,
+			Enabled:     info.Enabled,
+			Description: info.Description,
+			Priority:    info.Priority,
+			Consume:     info.Consume,
+			RateLimit:   info.RateLimit,
+		})
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		if plugins[i].Priority != plugins[j].Priority {
+			return plugins[i].Priority > plugins[j].Priority
+		}
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
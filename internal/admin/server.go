@@ -26,8 +26,16 @@ func StartServer(port string) *echo.Echo {
 	admin.GET("/status", api.GetStatus)
 	admin.GET("/plugins", api.GetPlugins)
 	admin.POST("/plugins/:name/toggle", api.TogglePlugin)
+	admin.PUT("/plugins/:name/rate-limit", api.SetPluginRateLimit)
 	admin.GET("/tasks", api.GetTasks)
 	admin.POST("/tasks/:id/trigger", api.TriggerTask)
+	admin.GET("/jobs", api.GetJobs)
+	admin.POST("/jobs/:id/cancel", api.CancelJob)
+	admin.GET("/outbound", api.GetOutbound)
+	admin.GET("/archive/messages", api.GetArchiveMessages)
+	admin.GET("/archive/groups", api.GetArchiveGroups)
+	admin.GET("/archive/export", api.ExportArchive)
+	admin.POST("/archive/prune", api.PruneArchive)
 	admin.GET("/config", api.GetConfig)
 	admin.POST("/config", api.UpdateConfig)
 	admin.GET("/logs", api.GetLogs)
@@ -1,9 +1,14 @@
 package types
 
+import "github.com/crayon/wrap-bot/pkgs/ratelimit"
+
 type PluginStatus struct {
-	Name        string `json:"name"`
-	Enabled     bool   `json:"enabled"`
-	Description string `json:"description"`
+	Name        string          `json:"name"`
+	Enabled     bool            `json:"enabled"`
+	Description string          `json:"description"`
+	Priority    int             `json:"priority"`
+	Consume     bool            `json:"consume"`
+	RateLimit   *ratelimit.Rule `json:"rate_limit"`
 }
 
 type TaskStatus struct {
@@ -88,6 +88,30 @@ func (h *Hub) BroadcastTasks(tasks interface{}) {
 	h.broadcastJSON(data)
 }
 
+func (h *Hub) BroadcastJobs(jobs interface{}) {
+	data := map[string]interface{}{
+		"type": "jobs",
+		"data": jobs,
+	}
+	h.broadcastJSON(data)
+}
+
+func (h *Hub) BroadcastOutbound(deliveries interface{}) {
+	data := map[string]interface{}{
+		"type": "outbound",
+		"data": deliveries,
+	}
+	h.broadcastJSON(data)
+}
+
+func (h *Hub) BroadcastConnection(connection interface{}) {
+	data := map[string]interface{}{
+		"type": "connection",
+		"data": connection,
+	}
+	h.broadcastJSON(data)
+}
+
 func (h *Hub) broadcastJSON(data interface{}) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
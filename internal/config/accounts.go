@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// AccountConfig describes an additional bot account. Its events always come
+// over a forward WebSocket; ActionMode "ws" also sends actions over it,
+// anything else posts them to HTTPURL.
+type AccountConfig struct {
+	Name       string `json:"name"`
+	WSURL      string `json:"ws_url"`
+	WSToken    string `json:"ws_token"`
+	HTTPURL    string `json:"http_url"`
+	HTTPToken  string `json:"http_token"`
+	ActionMode string `json:"action_mode"`
+}
+
+func LoadAccounts(path string) ([]AccountConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []AccountConfig
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("invalid accounts file: %w", err)
+	}
+
+	seen := map[string]bool{"default": true}
+	for i, account := range accounts {
+		if account.Name == "" || account.WSURL == "" {
+			return nil, fmt.Errorf("account %d: name and ws_url are required", i+1)
+		}
+		if seen[account.Name] {
+			return nil, fmt.Errorf("duplicate account name: %s", account.Name)
+		}
+		seen[account.Name] = true
+	}
+
+	return accounts, nil
+}
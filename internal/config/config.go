@@ -25,24 +25,86 @@ type Config struct {
 
 	AIModel string
 
-	AIImageDetail       string
-	SystemPromptPath    string
-	AnalyzerPromptPath  string
-	HotApiHost          string
-	HotApiKey           string
-	TechPushGroups      []int64
-	TechPushUsers       []int64
-	RssPushGroups       []int64
-	RssPushUsers        []int64
-	AllowedUsers        []int64
-	AllowedGroups       []int64
-	RSSApiHost          string
-	AdminUsername       string
-	AdminPassword       string
-	JWTSecret           string
-	SerpAPIKey          string
-	WeatherAPIKey       string
-	AIToolsEnabled      []string
+	AIImageDetail              string
+	AIImageCacheDir            string
+	AIImageMaxBytes            int
+	AIImageMaxDimension        int
+	SystemPromptPath           string
+	AnalyzerPromptPath         string
+	HotApiHost                 string
+	HotApiKey                  string
+	TechPushGroups             []int64
+	TechPushUsers              []int64
+	RssPushGroups              []int64
+	RssPushUsers               []int64
+	AllowedUsers               []int64
+	AllowedGroups              []int64
+	RSSApiHost                 string
+	AdminUsername              string
+	AdminPassword              string
+	JWTSecret                  string
+	SerpAPIKey                 string
+	WeatherAPIKey              string
+	AIToolsEnabled             []string
+	AIVoiceEnabled             bool
+	AISTTModel                 string
+	AITTSModel                 string
+	AITTSVoice                 string
+	AITTSGroups                []int64
+	AITTSUsers                 []int64
+	AITTSVoices                map[int64]string
+	AIFileMaxBytes             int
+	AIDocContextTokens         int
+	AIDocTTLMinutes            int
+	ExplainerMode              string
+	ExplainerWindowSize        int
+	ExplainerConcurrency       int
+	ExplainerTimeoutSeconds    int
+	ExplainerMaxDepth          int
+	JobMaxPerUser              int
+	JobProgressIntervalSeconds int
+	DigestEnabled              bool
+	DigestGroups               []int64
+	DigestTime                 string
+	DigestRetentionHours       int
+	DigestMaxMessages          int
+	DigestOptOutPath           string
+	ArchiveEnabled             bool
+	ArchiveDir                 string
+	ArchiveRetentionDays       int
+	NapCatActionMode           string
+	NapCatActionTimeout        int
+	NapCatEventMode            string
+	NapCatListenAddr           string
+	NapCatReverseWSPath        string
+	NapCatPostPath             string
+	NapCatPostSecret           string
+	NapCatAccountsFile         string
+	PushAccounts               map[int64]string
+	OutboundGlobalIntervalMs   int
+	OutboundTargetIntervalMs   int
+	OutboundMaxRetries         int
+	OutboundRetryDelayMs       int
+	NoticeGroups               []int64
+	WelcomeMessage             string
+	FarewellMessage            string
+	AntiRecallEnabled          bool
+	AutoApproveFriend          bool
+	AutoApproveGroup           bool
+	ApproveKeywords            []string
+	ApproveUsers               []int64
+	RejectUnmatchedRequests    bool
+	EventWorkers               int
+	EventQueueSize             int
+	EventChatQueueSize         int
+	EventOverflowPolicy        string
+	ShutdownTimeoutSeconds     int
+	EventOrder                 string
+	RateLimitsPath             string
+	RateLimitMessage           string
+	RateLimitCooldownSeconds   int
+	Superusers                 []int64
+	PermissionsPath            string
 }
 
 func Load() *Config {
@@ -62,24 +124,86 @@ func Load() *Config {
 
 		AIModel: getEnv("AI_MODEL", "deepseek/deepseek-r1-turbo"),
 
-		AIImageDetail:       getEnv("AI_IMAGE_DETAIL", "auto"),
-		SystemPromptPath:    getEnv("SYSTEM_PROMPT_PATH", "configs/system_prompt.md"),
-		AnalyzerPromptPath:  getEnv("ANALYZER_PROMPT_PATH", "configs/analyzer_prompt.md"),
-		HotApiHost:          getEnv("HOT_API_HOST", "https://hot-api.crayoncreator.top"),
-		HotApiKey:           getEnv("HOT_API_KEY", "keykeykey"),
-		TechPushGroups:      getEnvInt64Slice("TECH_PUSH_GROUPS", []int64{}),
-		TechPushUsers:       getEnvInt64Slice("TECH_PUSH_USERS", []int64{}),
-		RssPushGroups:       getEnvInt64Slice("RSS_PUSH_GROUPS", []int64{}),
-		RssPushUsers:        getEnvInt64Slice("RSS_PUSH_USERS", []int64{}),
-		AllowedUsers:        getEnvInt64Slice("ALLOWED_USERS", []int64{}),
-		AllowedGroups:       getEnvInt64Slice("ALLOWED_GROUPS", []int64{}),
-		RSSApiHost:          getEnv("RSS_API_HOST", "https://rsshub.rssforever.com"),
-		AdminUsername:       getEnv("ADMIN_USERNAME", "admin"),
-		AdminPassword:       getEnv("ADMIN_PASSWORD", ""),
-		JWTSecret:           getEnv("JWT_SECRET", ""),
-		SerpAPIKey:          getEnv("SERP_API_KEY", ""),
-		WeatherAPIKey:       getEnv("WEATHER_API_KEY", ""),
-		AIToolsEnabled:      getEnvStringSlice("AI_TOOLS", []string{}),
+		AIImageDetail:              getEnv("AI_IMAGE_DETAIL", "auto"),
+		AIImageCacheDir:            getEnv("AI_IMAGE_CACHE_DIR", "data/image_cache"),
+		AIImageMaxBytes:            getEnvInt("AI_IMAGE_MAX_BYTES", 10*1024*1024),
+		AIImageMaxDimension:        getEnvInt("AI_IMAGE_MAX_DIMENSION", 1568),
+		SystemPromptPath:           getEnv("SYSTEM_PROMPT_PATH", "configs/system_prompt.md"),
+		AnalyzerPromptPath:         getEnv("ANALYZER_PROMPT_PATH", "configs/analyzer_prompt.md"),
+		HotApiHost:                 getEnv("HOT_API_HOST", "https://hot-api.crayoncreator.top"),
+		HotApiKey:                  getEnv("HOT_API_KEY", "keykeykey"),
+		TechPushGroups:             getEnvInt64Slice("TECH_PUSH_GROUPS", []int64{}),
+		TechPushUsers:              getEnvInt64Slice("TECH_PUSH_USERS", []int64{}),
+		RssPushGroups:              getEnvInt64Slice("RSS_PUSH_GROUPS", []int64{}),
+		RssPushUsers:               getEnvInt64Slice("RSS_PUSH_USERS", []int64{}),
+		AllowedUsers:               getEnvInt64Slice("ALLOWED_USERS", []int64{}),
+		AllowedGroups:              getEnvInt64Slice("ALLOWED_GROUPS", []int64{}),
+		RSSApiHost:                 getEnv("RSS_API_HOST", "https://rsshub.rssforever.com"),
+		AdminUsername:              getEnv("ADMIN_USERNAME", "admin"),
+		AdminPassword:              getEnv("ADMIN_PASSWORD", ""),
+		JWTSecret:                  getEnv("JWT_SECRET", ""),
+		SerpAPIKey:                 getEnv("SERP_API_KEY", ""),
+		WeatherAPIKey:              getEnv("WEATHER_API_KEY", ""),
+		AIToolsEnabled:             getEnvStringSlice("AI_TOOLS", []string{}),
+		AIVoiceEnabled:             getEnvBool("AI_VOICE_ENABLED", false),
+		AISTTModel:                 getEnv("AI_STT_MODEL", "FunAudioLLM/SenseVoiceSmall"),
+		AITTSModel:                 getEnv("AI_TTS_MODEL", "FunAudioLLM/CosyVoice2-0.5B"),
+		AITTSVoice:                 getEnv("AI_TTS_VOICE", "FunAudioLLM/CosyVoice2-0.5B:alex"),
+		AITTSGroups:                getEnvInt64Slice("AI_TTS_GROUPS", []int64{}),
+		AITTSUsers:                 getEnvInt64Slice("AI_TTS_USERS", []int64{}),
+		AITTSVoices:                getEnvInt64StringMap("AI_TTS_VOICES"),
+		AIFileMaxBytes:             getEnvInt("AI_FILE_MAX_BYTES", 20*1024*1024),
+		AIDocContextTokens:         getEnvInt("AI_DOC_CONTEXT_TOKENS", 3000),
+		AIDocTTLMinutes:            getEnvInt("AI_DOC_TTL_MINUTES", 60),
+		ExplainerMode:              getEnv("EXPLAINER_MODE", "auto"),
+		ExplainerWindowSize:        getEnvInt("EXPLAINER_WINDOW_SIZE", 20),
+		ExplainerConcurrency:       getEnvInt("EXPLAINER_CONCURRENCY", 3),
+		ExplainerTimeoutSeconds:    getEnvInt("EXPLAINER_TIMEOUT_SECONDS", 60),
+		ExplainerMaxDepth:          getEnvInt("EXPLAINER_MAX_DEPTH", 3),
+		JobMaxPerUser:              getEnvInt("JOB_MAX_PER_USER", 1),
+		JobProgressIntervalSeconds: getEnvInt("JOB_PROGRESS_INTERVAL_SECONDS", 15),
+		DigestEnabled:              getEnvBool("DIGEST_ENABLED", false),
+		DigestGroups:               getEnvInt64Slice("DIGEST_GROUPS", []int64{}),
+		DigestTime:                 getEnv("DIGEST_TIME", "21:00"),
+		DigestRetentionHours:       getEnvInt("DIGEST_RETENTION_HOURS", 48),
+		DigestMaxMessages:          getEnvInt("DIGEST_MAX_MESSAGES", 3000),
+		DigestOptOutPath:           getEnv("DIGEST_OPTOUT_PATH", "data/digest_optout.json"),
+		ArchiveEnabled:             getEnvBool("ARCHIVE_ENABLED", false),
+		ArchiveDir:                 getEnv("ARCHIVE_DIR", "data/archive"),
+		ArchiveRetentionDays:       getEnvInt("ARCHIVE_RETENTION_DAYS", 30),
+		NapCatActionMode:           getEnv("NAPCAT_ACTION_MODE", "http"),
+		NapCatActionTimeout:        getEnvInt("NAPCAT_ACTION_TIMEOUT_SECONDS", 30),
+		NapCatEventMode:            getEnv("NAPCAT_EVENT_MODE", "ws"),
+		NapCatListenAddr:           getEnv("NAPCAT_LISTEN_ADDR", ":6700"),
+		NapCatReverseWSPath:        getEnv("NAPCAT_REVERSE_WS_PATH", "/onebot/v11/ws"),
+		NapCatPostPath:             getEnv("NAPCAT_POST_PATH", "/onebot/v11/post"),
+		NapCatPostSecret:           getEnv("NAPCAT_POST_SECRET", ""),
+		NapCatAccountsFile:         getEnv("NAPCAT_ACCOUNTS_FILE", ""),
+		PushAccounts:               getEnvInt64StringMap("PUSH_ACCOUNTS"),
+		OutboundGlobalIntervalMs:   getEnvInt("OUTBOUND_GLOBAL_INTERVAL_MS", 1000),
+		OutboundTargetIntervalMs:   getEnvInt("OUTBOUND_TARGET_INTERVAL_MS", 3000),
+		OutboundMaxRetries:         getEnvInt("OUTBOUND_MAX_RETRIES", 3),
+		OutboundRetryDelayMs:       getEnvInt("OUTBOUND_RETRY_DELAY_MS", 2000),
+		NoticeGroups:               getEnvInt64Slice("NOTICE_GROUPS", []int64{}),
+		WelcomeMessage:             getEnv("WELCOME_MESSAGE", ""),
+		FarewellMessage:            getEnv("FAREWELL_MESSAGE", ""),
+		AntiRecallEnabled:          getEnvBool("ANTI_RECALL_ENABLED", false),
+		AutoApproveFriend:          getEnvBool("AUTO_APPROVE_FRIEND", false),
+		AutoApproveGroup:           getEnvBool("AUTO_APPROVE_GROUP", false),
+		ApproveKeywords:            getEnvStringSlice("APPROVE_KEYWORDS", []string{}),
+		ApproveUsers:               getEnvInt64Slice("APPROVE_USERS", []int64{}),
+		RejectUnmatchedRequests:    getEnvBool("REJECT_UNMATCHED_REQUESTS", false),
+		EventWorkers:               getEnvInt("EVENT_WORKERS", 10),
+		EventQueueSize:             getEnvInt("EVENT_QUEUE_SIZE", 1000),
+		EventChatQueueSize:         getEnvInt("EVENT_CHAT_QUEUE_SIZE", 50),
+		EventOverflowPolicy:        getEnv("EVENT_OVERFLOW_POLICY", "drop_oldest"),
+		ShutdownTimeoutSeconds:     getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 15),
+		EventOrder:                 getEnv("EVENT_ORDER", "user"),
+		RateLimitsPath:             getEnv("RATE_LIMITS_PATH", "data/rate_limits.json"),
+		RateLimitMessage:           getEnv("RATE_LIMIT_MESSAGE", "太快啦，{seconds} 秒后再试吧"),
+		RateLimitCooldownSeconds:   getEnvInt("RATE_LIMIT_COOLDOWN_SECONDS", 30),
+		Superusers:                 getEnvInt64Slice("SUPERUSERS", []int64{}),
+		PermissionsPath:            getEnv("PERMISSIONS_PATH", "data/permissions.json"),
 	}
 
 	logger.Info("================================================")
@@ -91,11 +215,13 @@ func Load() *Config {
 	logger.Info("  ServerEnabled: " + strconv.FormatBool(cfg.ServerEnabled))
 	logger.Info("  Debug: " + strconv.FormatBool(cfg.Debug))
 	logger.Info("  AdminIDs: " + strings.Join(int64SliceToString(cfg.AdminIDs), ","))
+	logger.Info("  Superusers: " + strings.Join(int64SliceToString(cfg.Superusers), ","))
 	logger.Info("  CommandPrefix: " + cfg.CommandPrefix)
 	logger.Info("  AIEnabled: " + strconv.FormatBool(cfg.AIEnabled))
 	logger.Info("  AIURL: " + cfg.AIURL)
 	logger.Info("  AIModel: " + cfg.AIModel)
 	logger.Info("  AIImageDetail: " + cfg.AIImageDetail)
+	logger.Info("  AIImageCacheDir: " + cfg.AIImageCacheDir)
 	logger.Info("  SystemPromptPath: " + cfg.SystemPromptPath)
 	logger.Info("  AnalyzerPromptPath: " + cfg.AnalyzerPromptPath)
 	logger.Info("  HotApiHost: " + cfg.HotApiHost)
@@ -108,6 +234,11 @@ func Load() *Config {
 	logger.Info("  RSSApiHost: " + cfg.RSSApiHost)
 	logger.Info("  AdminUsername: " + cfg.AdminUsername)
 	logger.Info("  AIToolsEnabled: " + strings.Join(cfg.AIToolsEnabled, ","))
+	logger.Info("  AIVoiceEnabled: " + strconv.FormatBool(cfg.AIVoiceEnabled))
+	logger.Info("  AISTTModel: " + cfg.AISTTModel)
+	logger.Info("  AITTSModel: " + cfg.AITTSModel)
+	logger.Info("  AITTSGroups: " + strings.Join(int64SliceToString(cfg.AITTSGroups), ","))
+	logger.Info("  AITTSUsers: " + strings.Join(int64SliceToString(cfg.AITTSUsers), ","))
 	logger.Info("  SerpAPIKey: " + maskKey(cfg.SerpAPIKey))
 	logger.Info("  WeatherAPIKey: " + maskKey(cfg.WeatherAPIKey))
 	logger.Info("================================================")
@@ -156,6 +287,18 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			logger.Warn("Invalid int value for " + key + ": " + value + ", using default")
+			return defaultValue
+		}
+		return i
+	}
+	return defaultValue
+}
+
 func getEnvInt64Slice(key string, defaultValue []int64) []int64 {
 	value := os.Getenv(key)
 	if value == "" {
@@ -187,6 +330,39 @@ func getEnvInt64Slice(key string, defaultValue []int64) []int64 {
 	return result
 }
 
+// getEnvInt64StringMap parses "id:value" pairs separated by commas,
+// e.g. AI_TTS_VOICES=123456:alex,654321:anna.
+func getEnvInt64StringMap(key string) map[int64]string {
+	result := make(map[int64]string)
+	value := os.Getenv(key)
+	if value == "" {
+		return result
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		idx := strings.Index(part, ":")
+		if idx <= 0 {
+			logger.Warn("Invalid entry in " + key + ": " + part + ", skipping")
+			continue
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSpace(part[:idx]), 10, 64)
+		if err != nil {
+			logger.Warn("Invalid int64 value in " + key + ": " + part + ", skipping")
+			continue
+		}
+
+		result[id] = strings.TrimSpace(part[idx+1:])
+	}
+
+	return result
+}
+
 func int64SliceToString(slice []int64) []string {
 	result := make([]string, len(slice))
 	for i, v := range slice {
@@ -5,6 +5,9 @@ import (
 	"github.com/crayon/wrap-bot/internal/config"
 	"github.com/crayon/wrap-bot/pkgs/bot"
 	scheduler "github.com/crayon/wrap-bot/pkgs/feature"
+	"github.com/crayon/wrap-bot/pkgs/feature/archive"
+	"github.com/crayon/wrap-bot/pkgs/feature/jobs"
+	"github.com/crayon/wrap-bot/pkgs/feature/outbound"
 )
 
 type AdminContext struct {
@@ -12,6 +15,9 @@ type AdminContext struct {
 	Scheduler *scheduler.Scheduler
 	Config    *config.Config
 	WSHub     *websocket.Hub
+	Jobs      *jobs.Manager
+	Archive   *archive.Archive
+	Outbound  *outbound.Dispatcher
 }
 
 var globalContext *AdminContext
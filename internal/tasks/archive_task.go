@@ -0,0 +1,34 @@
+package tasks
+
+import (
+	"github.com/crayon/wrap-bot/internal/config"
+	scheduler "github.com/crayon/wrap-bot/pkgs/feature"
+	"github.com/crayon/wrap-bot/pkgs/feature/archive"
+)
+
+type ArchivePruneTask struct{}
+
+func NewArchivePruneTask() *ArchivePruneTask {
+	return &ArchivePruneTask{}
+}
+
+func (t *ArchivePruneTask) Name() string {
+	return "archive-prune-daily"
+}
+
+func (t *ArchivePruneTask) Schedule(sched *scheduler.Scheduler, cfg *config.Config) error {
+	store := archive.Default()
+	if store == nil || cfg.ArchiveRetentionDays <= 0 {
+		return nil
+	}
+
+	entryID, err := sched.At(4, 0, 0).WithID(t.Name()).Do(func() {
+		store.Prune()
+	})
+
+	if err == nil {
+		sched.RegisterTask(t.Name(), "Archive Retention", "每日清理过期的聊天存档", "0 0 4 * * *", entryID)
+	}
+
+	return err
+}
@@ -0,0 +1,143 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	scheduler "github.com/crayon/wrap-bot/pkgs/feature"
+	aiconfig "github.com/crayon/wrap-bot/pkgs/feature/ai/config"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/factory"
+	"github.com/crayon/wrap-bot/pkgs/feature/chat_explainer"
+	"github.com/crayon/wrap-bot/pkgs/feature/digest"
+	"github.com/crayon/wrap-bot/pkgs/feature/outbound"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+	"github.com/crayon/wrap-bot/pkgs/napcat"
+)
+
+const dailyDigestMinMessages = 5
+
+type DigestTask struct {
+	cfg      *config.Config
+	analyzer *chat_explainer.Analyzer
+}
+
+func NewDigestTask(cfg *config.Config) *DigestTask {
+	if !cfg.AIEnabled || !cfg.DigestEnabled {
+		return &DigestTask{cfg: cfg}
+	}
+
+	aiCfg := &aiconfig.Config{
+		APIURL: cfg.AIURL,
+		APIKey: cfg.AIKey,
+
+		Model: cfg.AIModel,
+
+		Temperature: 0.7,
+		TopP:        0.9,
+		MaxTokens:   2000,
+		MaxHistory:  0,
+
+		ToolsEnabled: []string{},
+
+		SystemPromptPath: cfg.SystemPromptPath,
+	}
+
+	factory := factory.NewFactory(aiCfg)
+	chatAgent := factory.CreateAgent()
+
+	systemPrompt := ""
+	if data, err := os.ReadFile(cfg.SystemPromptPath); err == nil {
+		systemPrompt = string(data)
+	}
+
+	analyzer := chat_explainer.NewAnalyzer(chatAgent, systemPrompt, 20)
+	analyzer.SetOptions(chat_explainer.AnalyzerOptions{
+		Concurrency:       cfg.ExplainerConcurrency,
+		TimeoutPerRequest: time.Duration(cfg.ExplainerTimeoutSeconds) * time.Second,
+	})
+
+	return &DigestTask{cfg: cfg, analyzer: analyzer}
+}
+
+func (t *DigestTask) Name() string {
+	return "group-digest-daily"
+}
+
+func (t *DigestTask) Schedule(sched *scheduler.Scheduler, cfg *config.Config) error {
+	if t.analyzer == nil || digest.Default() == nil {
+		return nil
+	}
+
+	if len(cfg.DigestGroups) == 0 {
+		logger.Warn("DigestTask: DIGEST_GROUPS not set, skipping")
+		return nil
+	}
+
+	hour, minute, err := parseClock(cfg.DigestTime)
+	if err != nil {
+		return fmt.Errorf("invalid DIGEST_TIME: %w", err)
+	}
+
+	entryID, err := sched.At(hour, minute, 0).WithID(t.Name()).Do(t.sendDigests)
+
+	if err == nil {
+		sched.RegisterTask(t.Name(), "Group Digest Daily", "每日推送群聊摘要", fmt.Sprintf("0 %d %d * * *", minute, hour), entryID)
+	}
+
+	return err
+}
+
+func (t *DigestTask) sendDigests() {
+	napcatClient := napcat.NewClient(t.cfg.NapCatHTTPURL, t.cfg.NapCatHTTPToken)
+
+	var selfID int64
+	if info, err := napcatClient.GetLoginInfo(); err == nil {
+		selfID = info.UserID
+	}
+
+	recorder := digest.Default()
+	since := time.Now().Add(-24 * time.Hour)
+
+	for _, groupID := range recorder.Groups() {
+		messages := recorder.Since(groupID, since)
+		if len(messages) < dailyDigestMinMessages {
+			logger.Info(fmt.Sprintf("[Digest] Group %d has only %d messages today, skipping", groupID, len(messages)))
+			continue
+		}
+
+		result, err := t.analyzer.Digest(context.Background(), messages)
+		if err != nil {
+			logger.Error(fmt.Sprintf("[Digest] Failed to generate digest for group %d: %v", groupID, err))
+			continue
+		}
+
+		nodes := chat_explainer.BuildDigestNodes(result, "今日群聊摘要", selfID)
+		client := napcat.ClientForTarget(t.cfg.PushAccounts, groupID, napcatClient)
+		msg := outbound.GroupForward(client, groupID, nodes, "digest")
+		if result := outbound.Default().Send(context.Background(), msg); result.Err != nil {
+			logger.Error(fmt.Sprintf("[Digest] Failed to send digest to group %d: %v", groupID, result.Err))
+		}
+	}
+}
+
+func parseClock(value string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid hour in %q", value)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid minute in %q", value)
+	}
+	return hour, minute, nil
+}
@@ -15,6 +15,8 @@ func RegisterAll(sched *scheduler.Scheduler, cfg *config.Config) {
 	tasks := []Task{
 		NewTechPushTask(cfg),
 		NewRssPushTask(cfg),
+		NewDigestTask(cfg),
+		NewArchivePruneTask(),
 	}
 
 	for _, task := range tasks {
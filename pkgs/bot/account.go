@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+// Account is one bot login managed by the engine: where its events come from
+// and the client its replies go through. SelfID may be left zero and is
+// learned from the first event the account receives. An account without
+// Events gets the events carrying its SelfID from another account's source,
+// as when several bots share one reverse WebSocket server.
+type Account struct {
+	Name   string
+	SelfID int64
+	Events WebSocketClient
+	API    APIClient
+}
+
+// AddAccount registers an additional bot account. The account configured
+// through SetWebSocketClient and SetAPIClient is named "default".
+func (e *Engine) AddAccount(account *Account) {
+	e.accountsMu.Lock()
+	defer e.accountsMu.Unlock()
+
+	e.accounts = append(e.accounts, account)
+	if account.SelfID != 0 {
+		e.bySelfID[account.SelfID] = account
+	}
+}
+
+func (e *Engine) Accounts() []*Account {
+	e.accountsMu.RLock()
+	defer e.accountsMu.RUnlock()
+
+	accounts := make([]*Account, len(e.accounts))
+	copy(accounts, e.accounts)
+	return accounts
+}
+
+// Account returns the account an event with selfID belongs to, falling back
+// to the default account.
+func (e *Engine) Account(selfID int64) *Account {
+	e.accountsMu.RLock()
+	defer e.accountsMu.RUnlock()
+
+	if account, ok := e.bySelfID[selfID]; ok {
+		return account
+	}
+	return e.accounts[0]
+}
+
+func (e *Engine) AccountByName(name string) (*Account, bool) {
+	e.accountsMu.RLock()
+	defer e.accountsMu.RUnlock()
+
+	for _, account := range e.accounts {
+		if account.Name == name {
+			return account, true
+		}
+	}
+	return nil, false
+}
+
+// receive starts an account's event source and forwards its events to the
+// engine, binding the account to the SelfID the events carry.
+func (e *Engine) receive(account *Account) {
+	events := make(chan *Event, 100)
+
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				e.bindSelfID(account, event.SelfID)
+				select {
+				case e.eventChan <- event:
+				case <-e.ctx.Done():
+					return
+				}
+			case <-e.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := account.Events.Start(events); err != nil {
+		logger.Error(fmt.Sprintf("Account %s event source error: %v", account.Name, err))
+		e.cancel()
+	}
+}
+
+func (e *Engine) bindSelfID(account *Account, selfID int64) {
+	if selfID == 0 {
+		return
+	}
+
+	e.accountsMu.Lock()
+	defer e.accountsMu.Unlock()
+
+	if _, ok := e.bySelfID[selfID]; ok {
+		return
+	}
+	if account.SelfID == 0 {
+		account.SelfID = selfID
+		logger.Info(fmt.Sprintf("Account %s logged in as %d", account.Name, selfID))
+	}
+	e.bySelfID[selfID] = account
+}
@@ -0,0 +1,103 @@
+package bot
+
+type MessageInfo struct {
+	Time        int64            `json:"time"`
+	MessageType MessageType      `json:"message_type"`
+	MessageID   int32            `json:"message_id"`
+	RealID      int32            `json:"real_id"`
+	GroupID     int64            `json:"group_id,omitempty"`
+	UserID      int64            `json:"user_id"`
+	Sender      Sender           `json:"sender"`
+	Message     []MessageSegment `json:"message"`
+	RawMessage  string           `json:"raw_message"`
+}
+
+type StrangerInfo struct {
+	UserID    int64  `json:"user_id"`
+	Nickname  string `json:"nickname"`
+	Sex       string `json:"sex"`
+	Age       int32  `json:"age"`
+	QID       string `json:"qid,omitempty"`
+	Level     int32  `json:"level,omitempty"`
+	LoginDays int32  `json:"login_days,omitempty"`
+}
+
+type GroupMemberInfo struct {
+	GroupID         int64  `json:"group_id"`
+	UserID          int64  `json:"user_id"`
+	Nickname        string `json:"nickname"`
+	Card            string `json:"card"`
+	Sex             string `json:"sex"`
+	Age             int32  `json:"age"`
+	Area            string `json:"area"`
+	JoinTime        int64  `json:"join_time"`
+	LastSentTime    int64  `json:"last_sent_time"`
+	Level           string `json:"level"`
+	Role            string `json:"role"`
+	Unfriendly      bool   `json:"unfriendly"`
+	Title           string `json:"title"`
+	TitleExpireTime int64  `json:"title_expire_time"`
+	CardChangeable  bool   `json:"card_changeable"`
+	ShutUpTimestamp int64  `json:"shut_up_timestamp"`
+}
+
+type GroupFile struct {
+	GroupID       int64  `json:"group_id"`
+	FileID        string `json:"file_id"`
+	FileName      string `json:"file_name"`
+	BusID         int32  `json:"busid"`
+	FileSize      int64  `json:"file_size"`
+	UploadTime    int64  `json:"upload_time"`
+	DeadTime      int64  `json:"dead_time"`
+	ModifyTime    int64  `json:"modify_time"`
+	DownloadTimes int32  `json:"download_times"`
+	Uploader      int64  `json:"uploader"`
+	UploaderName  string `json:"uploader_name"`
+}
+
+type GroupFolder struct {
+	GroupID        int64  `json:"group_id"`
+	FolderID       string `json:"folder_id"`
+	FolderName     string `json:"folder_name"`
+	CreateTime     int64  `json:"create_time"`
+	Creator        int64  `json:"creator"`
+	CreatorName    string `json:"creator_name"`
+	TotalFileCount int32  `json:"total_file_count"`
+}
+
+type GroupFiles struct {
+	Files   []GroupFile   `json:"files"`
+	Folders []GroupFolder `json:"folders"`
+}
+
+type RecordFile struct {
+	File     string `json:"file"`
+	URL      string `json:"url"`
+	FileName string `json:"file_name"`
+	Base64   string `json:"base64"`
+}
+
+type ImageFile struct {
+	File     string `json:"file"`
+	URL      string `json:"url"`
+	FileName string `json:"file_name"`
+	Base64   string `json:"base64"`
+}
+
+type OneBotStatus struct {
+	Online bool `json:"online"`
+	Good   bool `json:"good"`
+}
+
+type VersionInfo struct {
+	AppName         string `json:"app_name"`
+	AppVersion      string `json:"app_version"`
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+type FileInfo struct {
+	File     string `json:"file"`
+	URL      string `json:"url"`
+	FileName string `json:"file_name"`
+	Base64   string `json:"base64"`
+}
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"sync"
 )
 
@@ -10,6 +11,12 @@ type Context struct {
 	index    int
 	mu       sync.RWMutex
 	Keys     map[string]interface{}
+	sent     []int64
+	engine   *Engine
+	ctx      context.Context
+	aborted  bool
+	consumed bool
+	release  func()
 }
 
 func newContext(event *Event, handlers []HandlerFunc) *Context {
@@ -29,8 +36,42 @@ func (c *Context) Next() {
 	}
 }
 
+// Context returns a context that is cancelled when the engine stops waiting
+// for handlers during shutdown. Pass it to slow calls such as AI requests.
+func (c *Context) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Release lets the queue start the next event of this event's chat while
+// the handler keeps running. Long-running handlers, such as ones waiting for
+// a reply or running a job, call it once they no longer need to be ordered
+// before later events. Calling it more than once has no effect.
+func (c *Context) Release() {
+	if c.release != nil {
+		c.release()
+	}
+}
+
 func (c *Context) Abort() {
 	c.index = len(c.handlers)
+	c.aborted = true
+}
+
+func (c *Context) IsAborted() bool {
+	return c.aborted
+}
+
+// Consume marks the event as handled so that plugins with a lower priority
+// do not see it. The current handler keeps running.
+func (c *Context) Consume() {
+	c.consumed = true
+}
+
+func (c *Context) IsConsumed() bool {
+	return c.consumed
 }
 
 func (c *Context) Set(key string, value interface{}) {
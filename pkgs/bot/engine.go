@@ -12,37 +12,56 @@ import (
 	"time"
 
 	"github.com/crayon/wrap-bot/pkgs/logger"
+	"github.com/crayon/wrap-bot/pkgs/ratelimit"
 )
 
 type HandlerFunc func(ctx *Context)
 
 type Engine struct {
-	handlers   []HandlerFunc
-	mu         sync.RWMutex
-	eventChan  chan *Event
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wsClient   WebSocketClient
-	apiClient  APIClient
-	maxWorkers int
-	workerPool chan struct{}
-	plugins    map[string]*PluginInfo
-	pluginsMu  sync.RWMutex
-	startTime  time.Time
+	handlers      []HandlerFunc
+	mu            sync.RWMutex
+	eventChan     chan *Event
+	ctx           context.Context
+	cancel        context.CancelFunc
+	accounts      []*Account
+	bySelfID      map[int64]*Account
+	accountsMu    sync.RWMutex
+	maxWorkers    int
+	queue         *eventQueue
+	workers       sync.WaitGroup
+	workersOnce   sync.Once
+	handlerCtx    context.Context
+	stopHandler   context.CancelFunc
+	stopOnce      sync.Once
+	stopErr       error
+	plugins       map[string]*PluginInfo
+	pluginOrder   []*PluginInfo
+	pluginsMu     sync.RWMutex
+	startTime     time.Time
+	sessions      *sessions
+	authorizer    Authorizer
+	limitReply    string
+	limitCooldown time.Duration
 }
 
 type BotStatus struct {
-	Running   bool   `json:"running"`
-	Uptime    int64  `json:"uptime"`
-	Version   string `json:"version"`
-	GoVersion string `json:"go_version"`
+	Running   bool       `json:"running"`
+	Uptime    int64      `json:"uptime"`
+	Version   string     `json:"version"`
+	GoVersion string     `json:"go_version"`
+	Queue     QueueStats `json:"queue"`
 }
 
 type PluginInfo struct {
 	Name        string
 	Description string
 	Enabled     bool
+	Priority    int
+	Consume     bool
+	Matcher     Matcher
 	Handler     HandlerFunc
+	RateLimit   *ratelimit.Rule
+	limiter     *ratelimit.Limiter
 }
 
 type WebSocketClient interface {
@@ -54,11 +73,38 @@ type WebSocketClient interface {
 type APIClient interface {
 	SendGroupMessage(groupID int64, message interface{}) (int32, error)
 	SendPrivateMessage(userID int64, message interface{}) (int32, error)
+	SendGroupForwardMsg(groupID int64, nodes []ForwardNode) (map[string]interface{}, error)
+	SendPrivateForwardMsg(userID int64, nodes []ForwardNode) (map[string]interface{}, error)
+	GetForwardMsg(messageID string) (map[string]interface{}, error)
+	GetMsgRaw(messageID int64) (map[string]interface{}, error)
 	DeleteMessage(messageID int32) error
 	GetGroupList() ([]Group, error)
 	GetGroupInfo(groupID int64) (*GroupInfo, error)
 	GetGroupMemberList(groupID int64) ([]GroupMember, error)
 	GetFriendList() ([]Friend, error)
+
+	GetMsg(messageID int64) (*MessageInfo, error)
+	SetGroupBan(groupID, userID int64, duration int) error
+	SetGroupKick(groupID, userID int64, rejectAddRequest bool) error
+	SetGroupCard(groupID, userID int64, card string) error
+	SetGroupWholeBan(groupID int64, enable bool) error
+	SetFriendAddRequest(flag string, approve bool, remark string) error
+	SetGroupAddRequest(flag, subType string, approve bool, reason string) error
+	GetStrangerInfo(userID int64, noCache bool) (*StrangerInfo, error)
+	GetGroupMemberInfo(groupID, userID int64, noCache bool) (*GroupMemberInfo, error)
+	UploadGroupFile(groupID int64, file, name, folder string) error
+	UploadPrivateFile(userID int64, file, name string) error
+	GetFile(fileID string) (*FileInfo, error)
+	GetGroupFileURL(groupID int64, fileID string, busid int) (string, error)
+	GetGroupFiles(groupID int64, folderID string) (*GroupFiles, error)
+	SendLike(userID int64, times int) error
+	SetMsgEmojiLike(messageID int64, emojiID string, set bool) error
+	MarkMsgAsRead(messageID int64) error
+	GetRecord(file string, outFormat string) (*RecordFile, error)
+	GetImage(file string) (*ImageFile, error)
+	CanSendImage() (bool, error)
+	GetStatus() (*OneBotStatus, error)
+	GetVersionInfo() (*VersionInfo, error)
 }
 
 type Group struct {
@@ -91,15 +137,21 @@ type Friend struct {
 
 func New() *Engine {
 	ctx, cancel := context.WithCancel(context.Background())
+	handlerCtx, stopHandler := context.WithCancel(context.Background())
 	e := &Engine{
-		handlers:   make([]HandlerFunc, 0),
-		eventChan:  make(chan *Event, 100),
-		ctx:        ctx,
-		cancel:     cancel,
-		maxWorkers: 10,
-		workerPool: make(chan struct{}, 10),
-		plugins:    make(map[string]*PluginInfo),
-		startTime:  time.Now(),
+		handlers:    make([]HandlerFunc, 0),
+		eventChan:   make(chan *Event, 100),
+		ctx:         ctx,
+		cancel:      cancel,
+		accounts:    []*Account{{Name: "default"}},
+		bySelfID:    make(map[int64]*Account),
+		maxWorkers:  10,
+		queue:       newEventQueue(DefaultQueueConfig()),
+		handlerCtx:  handlerCtx,
+		stopHandler: stopHandler,
+		plugins:     make(map[string]*PluginInfo),
+		startTime:   time.Now(),
+		sessions:    newSessions(),
 	}
 
 	logger.Info("Bot engine initialized")
@@ -113,6 +165,7 @@ func (e *Engine) GetStatus() *BotStatus {
 		Uptime:    int64(uptime),
 		Version:   "1.0.0",
 		GoVersion: runtime.Version(),
+		Queue:     e.QueueStats(),
 	}
 }
 
@@ -124,79 +177,190 @@ func (e *Engine) Use(handler HandlerFunc) *Engine {
 }
 
 func (e *Engine) SetWebSocketClient(client WebSocketClient) {
-	e.wsClient = client
+	e.accountsMu.Lock()
+	defer e.accountsMu.Unlock()
+	e.accounts[0].Events = client
 }
 
 func (e *Engine) SetAPIClient(client APIClient) {
-	e.apiClient = client
+	e.accountsMu.Lock()
+	defer e.accountsMu.Unlock()
+	e.accounts[0].API = client
 }
 
+// GetAPIClient returns the default account's client.
 func (e *Engine) GetAPIClient() APIClient {
-	return e.apiClient
+	e.accountsMu.RLock()
+	defer e.accountsMu.RUnlock()
+	return e.accounts[0].API
 }
 
+// SetMaxWorkers sets how many events are handled at once. Call it before
+// Run.
 func (e *Engine) SetMaxWorkers(max int) {
-	e.maxWorkers = max
-	e.workerPool = make(chan struct{}, max)
+	if max > 0 {
+		e.maxWorkers = max
+	}
+}
+
+// SetQueueConfig replaces the queue of events waiting for a worker and the
+// key that decides which events are handled in order. Call it before Run.
+func (e *Engine) SetQueueConfig(cfg QueueConfig) {
+	e.queue = newEventQueue(cfg)
 }
 
+func (e *Engine) QueueStats() QueueStats {
+	stats := e.queue.stats()
+	stats.Workers = e.maxWorkers
+	return stats
+}
+
+// handleEvent passes the event to a waiting prompt or queues it for the
+// workers.
 func (e *Engine) handleEvent(event *Event) {
-	e.workerPool <- struct{}{}
-	go func() {
-		defer func() {
-			<-e.workerPool
-			if err := recover(); err != nil {
-				logger.Error(fmt.Sprintf("Panic recovered in event handler: %v", err))
-			}
-		}()
+	if e.sessions.intercept(event) {
+		return
+	}
+	e.queue.push(event)
+}
+
+func (e *Engine) startWorkers() {
+	e.workersOnce.Do(func() {
+		for i := 0; i < e.maxWorkers; i++ {
+			e.workers.Add(1)
+			go e.work()
+		}
+	})
+}
 
-		e.mu.RLock()
-		handlers := make([]HandlerFunc, len(e.handlers))
-		copy(handlers, e.handlers)
-		e.mu.RUnlock()
+func (e *Engine) work() {
+	defer e.workers.Done()
+	for {
+		event, key, ok := e.queue.pop()
+		if !ok {
+			return
+		}
+		var once sync.Once
+		release := func() {
+			once.Do(func() { e.queue.done(key) })
+		}
+		e.process(event, release)
+		release()
+	}
+}
 
-		ctx := newContext(event, handlers)
-		ctx.Next()
+func (e *Engine) process(event *Event, release func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error(fmt.Sprintf("Panic recovered in event handler: %v", err))
+		}
 	}()
+
+	e.mu.RLock()
+	handlers := make([]HandlerFunc, len(e.handlers), len(e.handlers)+1)
+	copy(handlers, e.handlers)
+	e.mu.RUnlock()
+	handlers = append(handlers, e.dispatch)
+
+	ctx := newContext(event, handlers)
+	ctx.engine = e
+	ctx.ctx = e.handlerCtx
+	ctx.release = release
+	account := e.Account(event.SelfID)
+	ctx.Set("account", account)
+	if account.API != nil {
+		ctx.Set("api_client", account.API)
+	}
+	ctx.Next()
 }
 
+// Run starts the event sources and workers and feeds events to the workers
+// until SIGINT or SIGTERM arrives or the engine stops. It does not wait for
+// running handlers; call Shutdown afterwards for that.
 func (e *Engine) Run() error {
-	if e.wsClient == nil {
-		return ErrWebSocketClientNotSet
+	accounts := e.Accounts()
+	for _, account := range accounts {
+		if account.Events == nil {
+			return ErrWebSocketClientNotSet
+		}
 	}
 
-	go func() {
-		if err := e.wsClient.Start(e.eventChan); err != nil {
-			logger.Error(fmt.Sprintf("WebSocket client error: %v", err))
-			e.cancel()
-		}
-	}()
+	e.startWorkers()
+	for _, account := range accounts {
+		go e.receive(account)
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	for {
 		select {
 		case event := <-e.eventChan:
 			e.handleEvent(event)
-		case <-sigChan:
-			logger.Info("Shutting down gracefully...")
-			e.Shutdown()
+		case sig := <-sigChan:
+			logger.Info(fmt.Sprintf("Received %s, shutting down gracefully...", sig))
 			return nil
 		case <-e.ctx.Done():
 			logger.Info("Context cancelled, shutting down...")
-			e.Shutdown()
 			return e.ctx.Err()
 		}
 	}
 }
 
-func (e *Engine) Shutdown() {
+// Shutdown stops the event sources and lets the workers finish the events
+// already received. If ctx is done first, queued events are dropped and the
+// contexts of running handlers are cancelled. Only the first call has an
+// effect.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		e.stopErr = e.shutdown(ctx)
+	})
+	return e.stopErr
+}
+
+func (e *Engine) shutdown(ctx context.Context) error {
+	defer e.stopHandler()
+
 	e.cancel()
-	if e.wsClient != nil {
-		e.wsClient.Close()
+	for _, account := range e.Accounts() {
+		if account.Events != nil {
+			account.Events.Close()
+		}
+	}
+
+	e.startWorkers()
+	e.drainIntake()
+	e.queue.close()
+
+	finished := make(chan struct{})
+	go func() {
+		e.workers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		logger.Info("All event handlers finished")
+		return nil
+	case <-ctx.Done():
+		dropped := e.queue.clear()
+		logger.Warn(fmt.Sprintf("Shutdown deadline reached, cancelling %d running handlers and dropping %d queued events",
+			e.queue.stats().InFlight, dropped))
+		return ctx.Err()
+	}
+}
+
+// drainIntake queues the events that were received but not yet read by Run.
+func (e *Engine) drainIntake() {
+	for {
+		select {
+		case event := <-e.eventChan:
+			e.handleEvent(event)
+		default:
+			return
+		}
 	}
-	close(e.eventChan)
 }
 
 func (e *Engine) InjectEvent(eventData []byte) error {
@@ -204,12 +368,17 @@ func (e *Engine) InjectEvent(eventData []byte) error {
 	if err := json.Unmarshal(eventData, &event); err != nil {
 		return err
 	}
-	e.eventChan <- &event
-	return nil
+	select {
+	case e.eventChan <- &event:
+		return nil
+	case <-e.ctx.Done():
+		return ErrEngineStopped
+	}
 }
 
 var (
 	ErrWebSocketClientNotSet = &BotError{Code: "WS_CLIENT_NOT_SET", Message: "WebSocket client not set"}
+	ErrEngineStopped         = &BotError{Code: "ENGINE_STOPPED", Message: "engine stopped"}
 )
 
 type BotError struct {
@@ -221,29 +390,35 @@ func (e *BotError) Error() string {
 	return e.Code + ": " + e.Message
 }
 
-func (e *Engine) RegisterPlugin(name, description string, handler HandlerFunc) {
-	e.pluginsMu.Lock()
-	defer e.pluginsMu.Unlock()
-	e.plugins[name] = &PluginInfo{
+// RegisterPlugin adds a plugin behind the middlewares added with Use.
+// Without options the plugin has PriorityDefault, no matcher and does not
+// consume events.
+func (e *Engine) RegisterPlugin(name, description string, handler HandlerFunc, opts ...PluginOption) {
+	plugin := &PluginInfo{
 		Name:        name,
 		Description: description,
 		Enabled:     true,
+		Priority:    PriorityDefault,
 		Handler:     handler,
 	}
+	for _, opt := range opts {
+		opt(plugin)
+	}
 
-	wrappedHandler := func(ctx *Context) {
-		e.pluginsMu.RLock()
-		plugin, exists := e.plugins[name]
-		e.pluginsMu.RUnlock()
-
-		if exists && plugin.Enabled {
-			handler(ctx)
-		} else {
-			ctx.Next()
+	e.pluginsMu.Lock()
+	defer e.pluginsMu.Unlock()
+	if old, exists := e.plugins[name]; exists {
+		for i, p := range e.pluginOrder {
+			if p == old {
+				e.pluginOrder = append(e.pluginOrder[:i], e.pluginOrder[i+1:]...)
+				break
+			}
 		}
 	}
+	e.plugins[name] = plugin
+	e.pluginOrder = append(e.pluginOrder, plugin)
+	e.sortPluginsLocked()
 
-	e.Use(wrappedHandler)
 	e.broadcastPlugins()
 }
 
@@ -2,6 +2,7 @@ package bot
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +16,19 @@ const (
 	EventTypeMessageSent   EventType = "message_sent"
 )
 
+// MetaTypeConnection marks the synthetic meta events the bot emits when its
+// connection to the OneBot implementation changes state. The event's SubType
+// holds the ConnectionState.
+const MetaTypeConnection = "connection"
+
+type ConnectionState string
+
+const (
+	ConnectionConnected    ConnectionState = "connected"
+	ConnectionDisconnected ConnectionState = "disconnected"
+	ConnectionReconnecting ConnectionState = "reconnecting"
+)
+
 type MessageType string
 
 const (
@@ -60,6 +74,8 @@ type Event struct {
 	RequestType RequestType            `json:"request_type,omitempty"`
 	Comment     string                 `json:"comment,omitempty"`
 	Flag        string                 `json:"flag,omitempty"`
+	OperatorID  int64                  `json:"operator_id,omitempty"`
+	Duration    int64                  `json:"duration,omitempty"`
 	MetaType    string                 `json:"meta_event_type,omitempty"`
 	Extra       map[string]interface{} `json:"-"`
 }
@@ -122,3 +138,111 @@ func (e *Event) GetImages() []string {
 
 	return urls
 }
+
+var cqImagePattern = regexp.MustCompile(`\[CQ:image,([^\]]*)\]`)
+
+// GetImageFiles maps each image URL in the message to its QQ file id, which
+// get_image still resolves after the URL has expired.
+func (e *Event) GetImageFiles() map[string]string {
+	files := make(map[string]string)
+	for _, match := range cqImagePattern.FindAllStringSubmatch(e.RawMessage, -1) {
+		var url, file string
+		for _, param := range strings.Split(match[1], ",") {
+			key, value, _ := strings.Cut(param, "=")
+			switch key {
+			case "url":
+				url = strings.ReplaceAll(value, "&amp;", "&")
+			case "file":
+				file = value
+			}
+		}
+		if url != "" && file != "" {
+			files[url] = file
+		}
+	}
+	return files
+}
+
+func (e *Event) GetSegments() []MessageSegment {
+	rawSegments, ok := e.Message.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	segments := make([]MessageSegment, 0, len(rawSegments))
+	for _, raw := range rawSegments {
+		segMap, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		segType, _ := segMap["type"].(string)
+		data, _ := segMap["data"].(map[string]interface{})
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+
+		segments = append(segments, MessageSegment{
+			Type: segType,
+			Data: data,
+		})
+	}
+
+	return segments
+}
+
+func (e *Event) GetRecords() []string {
+	var files []string
+	for _, seg := range e.GetSegments() {
+		if seg.Type != "record" {
+			continue
+		}
+		if file, ok := seg.Data["file"].(string); ok && file != "" {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) > 0 || e.RawMessage == "" {
+		return files
+	}
+
+	re := regexp.MustCompile(`\[CQ:record,[^\]]*file=([^,\]]+)`)
+	for _, match := range re.FindAllStringSubmatch(e.RawMessage, -1) {
+		if len(match) > 1 {
+			files = append(files, strings.ReplaceAll(match[1], "&amp;", "&"))
+		}
+	}
+
+	return files
+}
+
+type FileRef struct {
+	Name   string
+	FileID string
+	URL    string
+	Size   int64
+}
+
+func (e *Event) GetFiles() []FileRef {
+	var files []FileRef
+	for _, seg := range e.GetSegments() {
+		if seg.Type != "file" {
+			continue
+		}
+
+		ref := FileRef{}
+		ref.Name, _ = seg.Data["file"].(string)
+		ref.FileID, _ = seg.Data["file_id"].(string)
+		ref.URL, _ = seg.Data["url"].(string)
+
+		switch size := seg.Data["file_size"].(type) {
+		case float64:
+			ref.Size = int64(size)
+		case string:
+			ref.Size, _ = strconv.ParseInt(size, 10, 64)
+		}
+
+		files = append(files, ref)
+	}
+	return files
+}
@@ -2,24 +2,19 @@ package bot
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/crayon/wrap-bot/pkgs/logger"
 )
 
 func (c *Context) Reply(message interface{}) error {
-	api := c.GetAPIClient()
-	if api == nil {
-		return fmt.Errorf("API client not found in context")
-	}
-
 	if c.Event.IsGroupMessage() {
-		_, err := api.SendGroupMessage(c.Event.GroupID, message)
-		return err
+		return c.SendTo(GroupTarget(c.Event.GroupID), message)
 	}
 
 	if c.Event.IsPrivateMessage() {
-		_, err := api.SendPrivateMessage(c.Event.UserID, message)
-		return err
+		return c.SendTo(UserTarget(c.Event.UserID), message)
 	}
 
 	return fmt.Errorf("unsupported message type for reply")
@@ -34,21 +29,149 @@ func (c *Context) ReplyAt(text string) error {
 		return c.ReplyText(text)
 	}
 
-	atSegment := MessageSegment{
-		Type: "at",
-		Data: map[string]interface{}{
-			"qq": fmt.Sprintf("%d", c.Event.UserID),
-		},
+	return c.Reply(NewMessage().At(c.Event.UserID).Text(" " + text))
+}
+
+// ReplyQuote replies with message quoting the event's message.
+func (c *Context) ReplyQuote(message interface{}) error {
+	return c.Reply(NewMessage().Segment(toSegments(message)...).Reply(int64(c.Event.MessageID)))
+}
+
+// ReplyImage replies with the image at source: a URL, a base64:// or
+// file:// URI, or a local path.
+func (c *Context) ReplyImage(source string) error {
+	return c.Reply(NewMessage().Image(source))
+}
+
+func (c *Context) ReplyForward(nodes []ForwardNode) error {
+	api := c.GetAPIClient()
+	if api == nil {
+		return fmt.Errorf("API client not found in context")
+	}
+
+	var result map[string]interface{}
+	var err error
+	switch {
+	case c.Event.IsGroupMessage():
+		result, err = api.SendGroupForwardMsg(c.Event.GroupID, nodes)
+	case c.Event.IsPrivateMessage():
+		result, err = api.SendPrivateForwardMsg(c.Event.UserID, nodes)
+	default:
+		return fmt.Errorf("unsupported message type for reply")
+	}
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result["message_id"].(float64); ok {
+		c.recordSent(int64(id))
+	}
+	return nil
+}
+
+// Target is a group or user a message can be sent to.
+type Target struct {
+	MessageType MessageType
+	ID          int64
+}
+
+func GroupTarget(groupID int64) Target {
+	return Target{MessageType: MessageTypeGroup, ID: groupID}
+}
+
+func UserTarget(userID int64) Target {
+	return Target{MessageType: MessageTypePrivate, ID: userID}
+}
+
+// SendTo sends message to target through the event's account. Message may
+// be a string, a segment, a segment slice or a *MessageBuilder.
+func (c *Context) SendTo(target Target, message interface{}) error {
+	api := c.GetAPIClient()
+	if api == nil {
+		return fmt.Errorf("API client not found in context")
 	}
 
-	textSegment := MessageSegment{
-		Type: "text",
-		Data: map[string]interface{}{
-			"text": " " + text,
-		},
+	switch m := message.(type) {
+	case *MessageBuilder:
+		message = m.Build()
+	case MessageSegment:
+		message = []MessageSegment{m}
 	}
 
-	return c.Reply([]MessageSegment{atSegment, textSegment})
+	var messageID int32
+	var err error
+	switch target.MessageType {
+	case MessageTypeGroup:
+		messageID, err = api.SendGroupMessage(target.ID, message)
+	case MessageTypePrivate:
+		messageID, err = api.SendPrivateMessage(target.ID, message)
+	default:
+		return fmt.Errorf("unsupported target type %q", target.MessageType)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.recordSent(int64(messageID))
+	return nil
+}
+
+// Recall withdraws every message sent through this context so far once
+// after has passed. It returns immediately.
+func (c *Context) Recall(after time.Duration) {
+	api := c.GetAPIClient()
+
+	c.mu.RLock()
+	ids := make([]int64, len(c.sent))
+	copy(ids, c.sent)
+	c.mu.RUnlock()
+
+	if api == nil || len(ids) == 0 {
+		return
+	}
+
+	time.AfterFunc(after, func() {
+		for _, id := range ids {
+			if err := api.DeleteMessage(int32(id)); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to recall message %d: %v", id, err))
+			}
+		}
+	})
+}
+
+// SentMessageIDs returns the IDs of the messages sent through this context.
+func (c *Context) SentMessageIDs() []int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]int64, len(c.sent))
+	copy(ids, c.sent)
+	return ids
+}
+
+func (c *Context) recordSent(messageID int64) {
+	if messageID == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.sent = append(c.sent, messageID)
+	c.mu.Unlock()
+}
+
+func toSegments(message interface{}) []MessageSegment {
+	switch m := message.(type) {
+	case string:
+		return []MessageSegment{TextSegment(m)}
+	case MessageSegment:
+		return []MessageSegment{m}
+	case []MessageSegment:
+		return m
+	case *MessageBuilder:
+		return m.Build()
+	default:
+		return []MessageSegment{TextSegment(fmt.Sprint(m))}
+	}
 }
 
 func (c *Context) GetAPIClient() APIClient {
@@ -60,28 +183,60 @@ func (c *Context) GetAPIClient() APIClient {
 	return nil
 }
 
+// InjectAPIClient provides api to handlers of events whose account has no
+// client of its own.
 func InjectAPIClient(api APIClient) HandlerFunc {
 	return func(ctx *Context) {
-		ctx.Set("api_client", api)
+		if _, exists := ctx.Get("api_client"); !exists {
+			ctx.Set("api_client", api)
+		}
 		ctx.Next()
 	}
 }
 
+// GetAccount returns the bot account that received the event.
+func (c *Context) GetAccount() *Account {
+	if account, exists := c.Get("account"); exists {
+		if a, ok := account.(*Account); ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// OnCommand runs handler for messages starting with prefix+command. A
+// matched command consumes the event, so lower-priority plugins such as AI
+// chat do not answer it as well.
 func OnCommand(prefix string, command string, handler HandlerFunc) HandlerFunc {
-	fullCommand := prefix + command
+	matches := MatchCommand(prefix, command)
 
 	return func(ctx *Context) {
-		text := ctx.Event.GetText()
-		if len(text) < len(fullCommand) {
-			return
+		if matches(ctx) {
+			ctx.Consume()
+			handler(ctx)
 		}
+	}
+}
 
-		if text[:len(fullCommand)] == fullCommand {
-			handler(ctx)
+// MatchCommand accepts messages starting with prefix followed by one of the
+// commands.
+func MatchCommand(prefix string, commands ...string) Matcher {
+	return func(ctx *Context) bool {
+		text := ctx.Event.GetText()
+		for _, command := range commands {
+			if strings.HasPrefix(text, prefix+command) {
+				return true
+			}
 		}
+		return false
 	}
 }
 
+// MatchMessage accepts group and private messages.
+func MatchMessage(ctx *Context) bool {
+	return ctx.Event.IsGroupMessage() || ctx.Event.IsPrivateMessage()
+}
+
 func OnKeyword(keyword string, handler HandlerFunc) HandlerFunc {
 	return func(ctx *Context) {
 		text := ctx.Event.GetText()
@@ -106,6 +261,55 @@ func OnRegex(pattern string, handler HandlerFunc) HandlerFunc {
 	}
 }
 
+// OnNotice runs handler for notice events of the given type, such as
+// NoticeTypeGroupIncrease. An empty noticeType matches every notice.
+func OnNotice(noticeType NoticeType, handler HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if ctx.Event.IsNotice() && (noticeType == "" || ctx.Event.NoticeType == noticeType) {
+			handler(ctx)
+		}
+	}
+}
+
+// OnRequest runs handler for friend or group requests of the given type.
+// An empty requestType matches every request.
+func OnRequest(requestType RequestType, handler HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if ctx.Event.IsRequest() && (requestType == "" || ctx.Event.RequestType == requestType) {
+			handler(ctx)
+		}
+	}
+}
+
+// ApproveRequest answers the friend or group request of the event. The
+// reason is shown to the requester when a group request is rejected.
+func (c *Context) ApproveRequest(approve bool, reason string) error {
+	api := c.GetAPIClient()
+	if api == nil {
+		return fmt.Errorf("API client not found in context")
+	}
+
+	switch c.Event.RequestType {
+	case RequestTypeFriend:
+		return api.SetFriendAddRequest(c.Event.Flag, approve, "")
+	case RequestTypeGroup:
+		return api.SetGroupAddRequest(c.Event.Flag, c.Event.SubType, approve, reason)
+	default:
+		return fmt.Errorf("event is not a request")
+	}
+}
+
+// OnConnection runs handler for the meta events reporting that the bot's
+// connection to the OneBot implementation was established, lost or is being
+// retried.
+func OnConnection(handler func(ctx *Context, state ConnectionState)) HandlerFunc {
+	return func(ctx *Context) {
+		if ctx.Event.PostType == EventTypeMetaEvent && ctx.Event.MetaType == MetaTypeConnection {
+			handler(ctx, ConnectionState(ctx.Event.SubType))
+		}
+	}
+}
+
 func LogError(err error, context string) {
 	if err != nil {
 		logger.Error(fmt.Sprintf("Error [%s]: %v", context, err))
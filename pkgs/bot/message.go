@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+)
+
+// ForwardNode is one entry of a merged forward message.
+type ForwardNode struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"data"`
+}
+
+func TextSegment(text string) MessageSegment {
+	return MessageSegment{Type: "text", Data: map[string]interface{}{"text": text}}
+}
+
+func AtSegment(userID int64) MessageSegment {
+	return MessageSegment{Type: "at", Data: map[string]interface{}{"qq": userID}}
+}
+
+func AtAllSegment() MessageSegment {
+	return MessageSegment{Type: "at", Data: map[string]interface{}{"qq": "all"}}
+}
+
+func ReplySegment(messageID int64) MessageSegment {
+	return MessageSegment{Type: "reply", Data: map[string]interface{}{"id": messageID}}
+}
+
+func FaceSegment(id int) MessageSegment {
+	return MessageSegment{Type: "face", Data: map[string]interface{}{"id": id}}
+}
+
+// ImageSegment sends the image at source, which may be an http(s) URL, a
+// base64:// or file:// URI, or a local path.
+func ImageSegment(source string) MessageSegment {
+	return MessageSegment{Type: "image", Data: map[string]interface{}{"file": MediaFile(source)}}
+}
+
+func RecordSegment(source string) MessageSegment {
+	return MessageSegment{Type: "record", Data: map[string]interface{}{"file": MediaFile(source)}}
+}
+
+func VideoSegment(source string) MessageSegment {
+	return MessageSegment{Type: "video", Data: map[string]interface{}{"file": MediaFile(source)}}
+}
+
+func FileSegment(source, name string) MessageSegment {
+	data := map[string]interface{}{"file": MediaFile(source)}
+	if name != "" {
+		data["name"] = name
+	}
+	return MessageSegment{Type: "file", Data: data}
+}
+
+// MediaFile turns a media source into the file value OneBot expects. URLs
+// and base64:// or file:// URIs pass through; local paths become absolute
+// file:// URIs.
+func MediaFile(source string) string {
+	for _, prefix := range []string{"http://", "https://", "base64://", "file://"} {
+		if strings.HasPrefix(source, prefix) {
+			return source
+		}
+	}
+
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return "file://" + filepath.ToSlash(source)
+}
+
+// MediaBytes encodes in-memory media as a base64:// URI.
+func MediaBytes(data []byte) string {
+	return "base64://" + base64.StdEncoding.EncodeToString(data)
+}
+
+// NewForwardNode builds a forward node shown as sent by name (uin).
+func NewForwardNode(name string, uin int64, segments ...MessageSegment) ForwardNode {
+	content := make([]interface{}, len(segments))
+	for i, seg := range segments {
+		content[i] = seg
+	}
+
+	return ForwardNode{
+		Type: "node",
+		Data: map[string]interface{}{
+			"nickname": name,
+			"user_id":  uin,
+			"content":  content,
+		},
+	}
+}
+
+// MessageBuilder assembles a message segment by segment:
+//
+//	msg := bot.NewMessage().Reply(id).Text("看这个").Image("data/cat.png").Build()
+type MessageBuilder struct {
+	segments []MessageSegment
+}
+
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+func (b *MessageBuilder) Segment(segments ...MessageSegment) *MessageBuilder {
+	b.segments = append(b.segments, segments...)
+	return b
+}
+
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	return b.Segment(TextSegment(text))
+}
+
+func (b *MessageBuilder) At(userID int64) *MessageBuilder {
+	return b.Segment(AtSegment(userID))
+}
+
+func (b *MessageBuilder) AtAll() *MessageBuilder {
+	return b.Segment(AtAllSegment())
+}
+
+// Reply quotes the message with messageID. OneBot expects the reply segment
+// first, so it is inserted at the front.
+func (b *MessageBuilder) Reply(messageID int64) *MessageBuilder {
+	b.segments = append([]MessageSegment{ReplySegment(messageID)}, b.segments...)
+	return b
+}
+
+func (b *MessageBuilder) Face(id int) *MessageBuilder {
+	return b.Segment(FaceSegment(id))
+}
+
+func (b *MessageBuilder) Image(source string) *MessageBuilder {
+	return b.Segment(ImageSegment(source))
+}
+
+func (b *MessageBuilder) ImageBytes(data []byte) *MessageBuilder {
+	return b.Segment(ImageSegment(MediaBytes(data)))
+}
+
+func (b *MessageBuilder) Record(source string) *MessageBuilder {
+	return b.Segment(RecordSegment(source))
+}
+
+func (b *MessageBuilder) RecordBytes(data []byte) *MessageBuilder {
+	return b.Segment(RecordSegment(MediaBytes(data)))
+}
+
+func (b *MessageBuilder) Video(source string) *MessageBuilder {
+	return b.Segment(VideoSegment(source))
+}
+
+func (b *MessageBuilder) File(source, name string) *MessageBuilder {
+	return b.Segment(FileSegment(source, name))
+}
+
+func (b *MessageBuilder) FileBytes(data []byte, name string) *MessageBuilder {
+	return b.Segment(FileSegment(MediaBytes(data), name))
+}
+
+func (b *MessageBuilder) Build() []MessageSegment {
+	segments := make([]MessageSegment, len(b.segments))
+	copy(segments, b.segments)
+	return segments
+}
@@ -118,38 +118,10 @@ func FilterUser(userIDs ...int64) HandlerFunc {
 	}
 }
 
-func RateLimit(maxRequests int, duration time.Duration) HandlerFunc {
-	type entry struct {
-		count     int
-		resetTime time.Time
-	}
-
-	cache := make(map[int64]*entry)
-
-	return func(ctx *Context) {
-		userID := ctx.Event.UserID
-		now := time.Now()
-
-		e, exists := cache[userID]
-		if !exists || now.After(e.resetTime) {
-			cache[userID] = &entry{
-				count:     1,
-				resetTime: now.Add(duration),
-			}
-			ctx.Next()
-			return
-		}
-
-		if e.count >= maxRequests {
-			ctx.Abort()
-			return
-		}
-
-		e.count++
-		ctx.Next()
-	}
-}
-
+// AdminOnly stops every event not sent by one of adminIDs.
+//
+// Deprecated: Use the roles and grants of the permission package, which
+// apply per plugin or command instead of to the whole chain.
 func AdminOnly(adminIDs ...int64) HandlerFunc {
 	adminMap := make(map[int64]bool)
 	for _, id := range adminIDs {
@@ -165,6 +137,10 @@ func AdminOnly(adminIDs ...int64) HandlerFunc {
 	}
 }
 
+// GroupAdminOnly stops every event not sent by a group owner or admin.
+//
+// Deprecated: Grant the plugin or command to the group_admin role with the
+// permission package instead.
 func GroupAdminOnly() HandlerFunc {
 	return func(ctx *Context) {
 		if ctx.Event.Sender == nil {
@@ -204,7 +180,7 @@ func Authentication(allowedUsers []int64, allowedGroups []int64) HandlerFunc {
 				ctx.Abort()
 				return
 			}
-		} else if ctx.Event.MessageType == MessageTypeGroup {
+		} else if ctx.Event.MessageType == MessageTypeGroup || (ctx.Event.IsNotice() && ctx.Event.GroupID != 0) {
 			if len(groupMap) > 0 && !groupMap[ctx.Event.GroupID] {
 				ctx.Abort()
 				return
@@ -0,0 +1,106 @@
+package bot
+
+import "sort"
+
+// Plugin priorities. Plugins run from the highest priority to the lowest;
+// plugins with equal priority run in registration order.
+const (
+	// PriorityMonitor is for plugins that must see every message, such as
+	// recorders, even when a command consumes it later.
+	PriorityMonitor = 100
+	// PriorityCommand is for plugins that answer explicit commands.
+	PriorityCommand = 50
+	PriorityDefault = 0
+	// PriorityFallback is for catch-all plugins such as AI chat that only
+	// handle what no other plugin consumed.
+	PriorityFallback = -100
+)
+
+// Matcher decides whether a plugin handles an event. It runs before the
+// plugin's handler and must not reply or block.
+type Matcher func(ctx *Context) bool
+
+// Authorizer decides whether the sender of an event may use a plugin. It
+// runs after the plugin's matcher accepted the event and may reply to
+// explain a refusal.
+type Authorizer interface {
+	Authorize(ctx *Context, plugin *PluginInfo) bool
+}
+
+// SetAuthorizer makes every plugin ask authorizer before handling an event.
+// A nil authorizer allows everything.
+func (e *Engine) SetAuthorizer(authorizer Authorizer) {
+	e.pluginsMu.Lock()
+	defer e.pluginsMu.Unlock()
+	e.authorizer = authorizer
+}
+
+type PluginOption func(*PluginInfo)
+
+func WithPriority(priority int) PluginOption {
+	return func(p *PluginInfo) {
+		p.Priority = priority
+	}
+}
+
+func WithMatcher(matcher Matcher) PluginOption {
+	return func(p *PluginInfo) {
+		p.Matcher = matcher
+	}
+}
+
+// Consume makes the plugin stop lower-priority plugins from seeing every
+// event its matcher accepts. Handlers can also consume a single event with
+// ctx.Consume.
+func Consume() PluginOption {
+	return func(p *PluginInfo) {
+		p.Consume = true
+	}
+}
+
+// sortPluginsLocked orders the plugins by priority, keeping registration
+// order between equal priorities.
+func (e *Engine) sortPluginsLocked() {
+	sort.SliceStable(e.pluginOrder, func(i, j int) bool {
+		return e.pluginOrder[i].Priority > e.pluginOrder[j].Priority
+	})
+}
+
+// dispatch is the last handler of every chain. It runs the enabled plugins
+// whose matcher accepts the event and stops after one consumes it or aborts
+// the context. A plugin refused by the authorizer or its rate limit is
+// skipped, and the event stops there if the plugin consumes what it
+// matches.
+func (e *Engine) dispatch(ctx *Context) {
+	e.pluginsMu.RLock()
+	authorizer := e.authorizer
+	plugins := make([]PluginInfo, 0, len(e.pluginOrder))
+	for _, plugin := range e.pluginOrder {
+		if plugin.Enabled {
+			plugins = append(plugins, *plugin)
+		}
+	}
+	e.pluginsMu.RUnlock()
+
+	for _, plugin := range plugins {
+		if plugin.Matcher != nil && !plugin.Matcher(ctx) {
+			continue
+		}
+		allowed := authorizer == nil || authorizer.Authorize(ctx, &plugin)
+		if !allowed || !e.allowPlugin(ctx, &plugin) {
+			if plugin.Consume {
+				return
+			}
+			continue
+		}
+
+		plugin.Handler(ctx)
+
+		if plugin.Consume {
+			ctx.Consume()
+		}
+		if ctx.IsConsumed() || ctx.IsAborted() {
+			return
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+// OverflowPolicy decides what happens to new events while the queue in
+// front of the workers is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock stops reading events until a worker frees a slot, which
+	// pushes back on the event sources.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest drops the oldest queued event of any chat.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowPerChat bounds every chat's queue on its own and drops that
+	// chat's oldest event, so one flooding chat cannot push out the others.
+	// The total size still applies and drops the oldest event overall.
+	OverflowPerChat OverflowPolicy = "per_chat"
+)
+
+// ChatKeyFunc returns the conversation an event belongs to. Events with the
+// same key are handled one at a time in the order they arrived, while
+// different keys are handled in parallel. An empty key puts no ordering
+// constraint on the event.
+type ChatKeyFunc func(event *Event) string
+
+// QueueConfig sizes the queue of events waiting for a worker and decides
+// which events are kept in order. A nil Key uses UserKey.
+type QueueConfig struct {
+	Policy   OverflowPolicy
+	Size     int
+	ChatSize int
+	Key      ChatKeyFunc
+}
+
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Policy:   OverflowDropOldest,
+		Size:     1000,
+		ChatSize: 50,
+		Key:      UserKey,
+	}
+}
+
+// QueueStats describes the event queue for the admin dashboard.
+type QueueStats struct {
+	Policy    OverflowPolicy `json:"policy"`
+	Workers   int            `json:"workers"`
+	Pending   int            `json:"pending"`
+	InFlight  int            `json:"in_flight"`
+	Processed uint64         `json:"processed"`
+	Dropped   uint64         `json:"dropped"`
+}
+
+type queuedEvent struct {
+	event *Event
+	seq   uint64
+}
+
+// eventQueue keeps pending events per chat and hands them to workers chat by
+// chat in round-robin order. A chat with an event in flight is skipped until
+// that event is done, so each chat's events are handled in order.
+type eventQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	cfg       QueueConfig
+	chats     map[string][]queuedEvent
+	ready     []string
+	busy      map[string]bool
+	pending   int
+	seq       uint64
+	closed    bool
+	inFlight  int
+	processed uint64
+	dropped   uint64
+}
+
+func newEventQueue(cfg QueueConfig) *eventQueue {
+	defaults := DefaultQueueConfig()
+	if cfg.Policy == "" {
+		cfg.Policy = defaults.Policy
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = defaults.Size
+	}
+	if cfg.ChatSize <= 0 {
+		cfg.ChatSize = defaults.ChatSize
+	}
+	if cfg.Key == nil {
+		cfg.Key = defaults.Key
+	}
+
+	q := &eventQueue{
+		cfg:   cfg,
+		chats: make(map[string][]queuedEvent),
+		busy:  make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// ChatKey keeps the events of each group and each private chat in order. A
+// slow handler then delays the whole group unless it calls Context.Release.
+func ChatKey(event *Event) string {
+	switch {
+	case event.GroupID != 0:
+		return fmt.Sprintf("%d:group:%d", event.SelfID, event.GroupID)
+	case event.UserID != 0:
+		return fmt.Sprintf("%d:private:%d", event.SelfID, event.UserID)
+	default:
+		return fmt.Sprintf("%d:%s", event.SelfID, event.PostType)
+	}
+}
+
+// UserKey keeps the events of each user in each chat in order, so members
+// of a busy group do not wait for each other.
+func UserKey(event *Event) string {
+	if event.GroupID != 0 && event.UserID != 0 {
+		return fmt.Sprintf("%d:group:%d:%d", event.SelfID, event.GroupID, event.UserID)
+	}
+	return ChatKey(event)
+}
+
+// Unordered handles every event as soon as a worker is free.
+func Unordered(*Event) string {
+	return ""
+}
+
+// push queues event, applying the overflow policy when the queue is full.
+// It reports false if the queue was closed and the event dropped.
+func (q *eventQueue) push(event *Event) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := q.cfg.Key(event)
+	if key == "" {
+		// A key of its own orders the event after nothing else.
+		key = fmt.Sprintf("#%d", q.seq+1)
+	}
+	if q.cfg.Policy == OverflowPerChat && len(q.chats[key]) >= q.cfg.ChatSize && !q.closed {
+		q.dropHeadLocked(key)
+	}
+
+	for q.pending >= q.cfg.Size && !q.closed {
+		if q.cfg.Policy == OverflowBlock {
+			q.cond.Wait()
+			continue
+		}
+		q.dropOldestLocked()
+	}
+
+	if q.closed {
+		q.dropped++
+		return false
+	}
+
+	q.seq++
+	if len(q.chats[key]) == 0 && !q.busy[key] {
+		q.ready = append(q.ready, key)
+	}
+	q.chats[key] = append(q.chats[key], queuedEvent{event: event, seq: q.seq})
+	q.pending++
+	q.cond.Broadcast()
+	return true
+}
+
+// pop waits for the next event of a chat that has no event in flight and
+// returns it with its chat key. It returns false once the queue is closed
+// and empty.
+func (q *eventQueue) pop() (*Event, string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ready) == 0 {
+		if q.closed && q.pending == 0 {
+			return nil, "", false
+		}
+		q.cond.Wait()
+	}
+
+	key := q.ready[0]
+	q.ready = q.ready[1:]
+	events := q.chats[key]
+	next := events[0]
+	if len(events) > 1 {
+		q.chats[key] = events[1:]
+	} else {
+		delete(q.chats, key)
+	}
+
+	q.busy[key] = true
+	q.pending--
+	q.inFlight++
+	q.cond.Broadcast()
+	return next.event, key, true
+}
+
+// done marks the event popped for key as handled and makes the chat's next
+// event available.
+func (q *eventQueue) done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.busy, key)
+	if len(q.chats[key]) > 0 {
+		q.ready = append(q.ready, key)
+	}
+	q.inFlight--
+	q.processed++
+	q.cond.Broadcast()
+}
+
+// close stops accepting events. Workers still receive the queued ones.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// clear drops every queued event and returns how many there were.
+func (q *eventQueue) clear() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cleared := q.pending
+	q.dropped += uint64(cleared)
+	q.chats = make(map[string][]queuedEvent)
+	q.ready = nil
+	q.pending = 0
+	q.cond.Broadcast()
+	return cleared
+}
+
+func (q *eventQueue) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Policy:    q.cfg.Policy,
+		Pending:   q.pending,
+		InFlight:  q.inFlight,
+		Processed: q.processed,
+		Dropped:   q.dropped,
+	}
+}
+
+// dropOldestLocked drops the event that has been queued the longest.
+func (q *eventQueue) dropOldestLocked() {
+	oldest := ""
+	var oldestSeq uint64
+	for key, events := range q.chats {
+		if seq := events[0].seq; oldest == "" || seq < oldestSeq {
+			oldest, oldestSeq = key, seq
+		}
+	}
+	if oldest != "" {
+		q.dropHeadLocked(oldest)
+	}
+}
+
+func (q *eventQueue) dropHeadLocked(key string) {
+	events := q.chats[key]
+	if len(events) == 0 {
+		return
+	}
+
+	if len(events) > 1 {
+		q.chats[key] = events[1:]
+	} else {
+		delete(q.chats, key)
+		for i, k := range q.ready {
+			if k == key {
+				q.ready = append(q.ready[:i], q.ready[i+1:]...)
+				break
+			}
+		}
+	}
+	q.pending--
+	q.countDropLocked()
+	q.cond.Broadcast()
+}
+
+// countDropLocked counts a dropped event, logging the first one and then
+// every hundredth so a flood does not flood the log as well.
+func (q *eventQueue) countDropLocked() {
+	q.dropped++
+	if q.dropped%100 == 1 {
+		logger.Warn(fmt.Sprintf("Event queue full (%s), dropped %d events so far", q.cfg.Policy, q.dropped))
+	}
+}
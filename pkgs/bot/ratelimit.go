@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/ratelimit"
+)
+
+// RateLimitConfig configures the RateLimitWith middleware.
+type RateLimitConfig struct {
+	Limiter *ratelimit.Limiter
+	// Key picks the budget an event counts against. Events with an empty
+	// key are not limited.
+	Key func(ctx *Context) string
+	// Message is sent to rejected chats, at most once per Cooldown for each
+	// key. {seconds} is replaced by the time until the next event may pass.
+	// An empty Message drops rejected events silently.
+	Message  string
+	Cooldown time.Duration
+}
+
+// RateLimit lets every user through maxRequests times within any window of
+// duration and silently drops the rest.
+func RateLimit(maxRequests int, duration time.Duration) HandlerFunc {
+	return RateLimitWith(RateLimitConfig{
+		Limiter: ratelimit.NewLimiter(maxRequests, duration),
+		Key:     KeyByUser,
+	})
+}
+
+func RateLimitWith(cfg RateLimitConfig) HandlerFunc {
+	return func(ctx *Context) {
+		key := cfg.Key(ctx)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		ok, retryAfter := cfg.Limiter.Allow(key)
+		if ok {
+			ctx.Next()
+			return
+		}
+
+		ctx.Abort()
+		if cfg.Message != "" && cfg.Limiter.Warn(key, cfg.Cooldown) {
+			ctx.ReplyText(rateLimitMessage(cfg.Message, retryAfter))
+		}
+	}
+}
+
+func KeyByUser(ctx *Context) string {
+	return "u:" + strconv.FormatInt(ctx.Event.UserID, 10)
+}
+
+// KeyByGroup shares one budget per group. Private messages count against
+// the user.
+func KeyByGroup(ctx *Context) string {
+	if ctx.Event.GroupID != 0 {
+		return "g:" + strconv.FormatInt(ctx.Event.GroupID, 10)
+	}
+	return KeyByUser(ctx)
+}
+
+// KeyByCommand shares one budget per command among everyone. Messages that
+// are not commands are not limited.
+func KeyByCommand(prefix string) func(ctx *Context) string {
+	return func(ctx *Context) string {
+		fields := strings.Fields(ctx.Event.GetText())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], prefix) {
+			return ""
+		}
+		return "c:" + fields[0]
+	}
+}
+
+func rateLimitMessage(message string, retryAfter time.Duration) string {
+	seconds := int(retryAfter.Round(time.Second).Seconds())
+	return strings.ReplaceAll(message, "{seconds}", strconv.Itoa(max(seconds, 1)))
+}
+
+// SetRateLimitReply sets the reply to users stopped by a plugin's rate
+// limit and how often one key is told. An empty message rejects silently.
+func (e *Engine) SetRateLimitReply(message string, cooldown time.Duration) {
+	e.pluginsMu.Lock()
+	defer e.pluginsMu.Unlock()
+	e.limitReply = message
+	e.limitCooldown = cooldown
+}
+
+// SetPluginRateLimit limits how often a plugin handles events, counting the
+// events its matcher accepts. A nil rule removes the limit. It reports
+// false if the plugin does not exist.
+func (e *Engine) SetPluginRateLimit(name string, rule *ratelimit.Rule) bool {
+	e.pluginsMu.Lock()
+	defer e.pluginsMu.Unlock()
+
+	plugin, exists := e.plugins[name]
+	if !exists {
+		return false
+	}
+
+	if rule == nil {
+		plugin.RateLimit = nil
+		plugin.limiter = nil
+	} else {
+		limit := *rule
+		plugin.RateLimit = &limit
+		plugin.limiter = ratelimit.NewLimiter(limit.Events, limit.Window())
+	}
+	e.broadcastPlugins()
+	return true
+}
+
+// PluginRateLimits returns the rate limit of every limited plugin.
+func (e *Engine) PluginRateLimits() map[string]ratelimit.Rule {
+	e.pluginsMu.RLock()
+	defer e.pluginsMu.RUnlock()
+
+	rules := make(map[string]ratelimit.Rule)
+	for name, plugin := range e.plugins {
+		if plugin.RateLimit != nil {
+			rules[name] = *plugin.RateLimit
+		}
+	}
+	return rules
+}
+
+// allowPlugin applies the plugin's rate limit to the event. A rejected
+// event still stops at a plugin that consumes what it matches, so a limited
+// command is not answered by a lower-priority plugin instead.
+func (e *Engine) allowPlugin(ctx *Context, plugin *PluginInfo) bool {
+	if plugin.limiter == nil {
+		return true
+	}
+
+	key := plugin.Name + "|" + scopeKey(ctx, plugin.RateLimit.Scope)
+	ok, retryAfter := plugin.limiter.Allow(key)
+	if ok {
+		return true
+	}
+
+	e.pluginsMu.RLock()
+	message, cooldown := e.limitReply, e.limitCooldown
+	e.pluginsMu.RUnlock()
+
+	if message != "" && plugin.limiter.Warn(key, cooldown) {
+		ctx.ReplyText(rateLimitMessage(message, retryAfter))
+	}
+	return false
+}
+
+func scopeKey(ctx *Context, scope ratelimit.Scope) string {
+	switch scope {
+	case ratelimit.ScopeGroup:
+		return KeyByGroup(ctx)
+	case ratelimit.ScopeCommand:
+		return "*"
+	default:
+		return KeyByUser(ctx)
+	}
+}
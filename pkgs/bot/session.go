@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPromptTimeout   = errors.New("prompt timed out")
+	ErrPromptCancelled = errors.New("prompt cancelled")
+	ErrPromptBusy      = errors.New("another prompt is already waiting for this user")
+	ErrPromptNoChat    = errors.New("prompt needs a group or private message")
+)
+
+var defaultCancelWords = []string{"取消", "cancel"}
+
+// sessionKey identifies one user in one chat of one account. GroupID is zero
+// for private chats.
+type sessionKey struct {
+	selfID  int64
+	groupID int64
+	userID  int64
+}
+
+func sessionKeyOf(event *Event) sessionKey {
+	return sessionKey{selfID: event.SelfID, groupID: event.GroupID, userID: event.UserID}
+}
+
+type session struct {
+	match  func(*Event) bool
+	answer chan *Event
+}
+
+// sessions holds the prompts waiting for a user's next message.
+type sessions struct {
+	mu          sync.Mutex
+	waiting     map[sessionKey]*session
+	cancelWords []string
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		waiting:     make(map[sessionKey]*session),
+		cancelWords: defaultCancelWords,
+	}
+}
+
+// SetPromptCancelWords replaces the messages that abort a waiting prompt.
+func (e *Engine) SetPromptCancelWords(words ...string) {
+	e.sessions.mu.Lock()
+	defer e.sessions.mu.Unlock()
+	e.sessions.cancelWords = words
+}
+
+// intercept hands a message to the prompt waiting for its sender, if any.
+// It reports whether the event was consumed and must not reach handlers.
+func (s *sessions) intercept(event *Event) bool {
+	if !event.IsGroupMessage() && !event.IsPrivateMessage() {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sessionKeyOf(event)
+	sess, ok := s.waiting[key]
+	if !ok {
+		return false
+	}
+
+	if !s.isCancelLocked(event) && sess.match != nil && !sess.match(event) {
+		return false
+	}
+
+	delete(s.waiting, key)
+	sess.answer <- event
+	return true
+}
+
+func (s *sessions) isCancelLocked(event *Event) bool {
+	text := strings.TrimSpace(event.GetText())
+	for _, word := range s.cancelWords {
+		if strings.EqualFold(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sessions) isCancel(event *Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isCancelLocked(event)
+}
+
+func (s *sessions) open(key sessionKey, match func(*Event) bool) (*session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, busy := s.waiting[key]; busy {
+		return nil, ErrPromptBusy
+	}
+
+	sess := &session{match: match, answer: make(chan *Event, 1)}
+	s.waiting[key] = sess
+	return sess, nil
+}
+
+func (s *sessions) close(key sessionKey, sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.waiting[key] == sess {
+		delete(s.waiting, key)
+	}
+}
+
+// Prompt asks question in the current chat and waits up to timeout for the
+// same user's next message there, returning its text. That message is not
+// passed to any handler. Sending a cancel word returns ErrPromptCancelled.
+// An empty question only waits.
+//
+// The handler keeps its worker while it waits but releases its place in the
+// chat's order, so the chat's other events are handled meanwhile.
+func (c *Context) Prompt(question string, timeout time.Duration) (string, error) {
+	if question != "" {
+		if err := c.Reply(question); err != nil {
+			return "", err
+		}
+	}
+
+	event, err := c.WaitNext(timeout, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(event.GetText()), nil
+}
+
+// WaitNext waits up to timeout for the next message of the event's user in
+// the same chat for which match returns true. A nil match accepts any
+// message. Messages rejected by match reach handlers as usual.
+func (c *Context) WaitNext(timeout time.Duration, match func(*Event) bool) (*Event, error) {
+	if c.engine == nil || (!c.Event.IsGroupMessage() && !c.Event.IsPrivateMessage()) {
+		return nil, ErrPromptNoChat
+	}
+
+	sessions := c.engine.sessions
+	key := sessionKeyOf(c.Event)
+	sess, err := sessions.open(key, match)
+	if err != nil {
+		return nil, err
+	}
+	defer sessions.close(key, sess)
+	c.Release()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case event := <-sess.answer:
+		if sessions.isCancel(event) {
+			return nil, ErrPromptCancelled
+		}
+		return event, nil
+	case <-timer.C:
+		return nil, ErrPromptTimeout
+	case <-c.engine.ctx.Done():
+		return nil, ErrPromptCancelled
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/crayon/wrap-bot/pkgs/feature/ai"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/memory"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/provider"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/tool"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/vision"
 	"github.com/crayon/wrap-bot/pkgs/logger"
 )
 
@@ -27,14 +29,21 @@ type AgentConfig struct {
 	MaxTokens   int
 
 	ToolsEnabled []string
+
+	ImagePipeline *vision.Pipeline
 }
 
 type ChatOptions struct {
 	NoHistory bool
+	// ExtraContext is sent as an additional system message for this request
+	// only and is never written to history.
+	ExtraContext string
 }
 
 type ChatAgent struct {
 	config AgentConfig
+
+	noResponseFormat atomic.Bool
 }
 
 type ChatResult struct {
@@ -64,7 +73,7 @@ func (a *ChatAgent) ChatWithOptions(ctx context.Context, conversationID, message
 		a.config.History.AddMessage(conversationID, userMsg)
 	}
 
-	messages := []memory.Message{{Role: "system", Content: a.config.SystemPrompt}}
+	messages := a.baseMessages(opts)
 
 	if !opts.NoHistory {
 		history, _ := a.config.History.GetHistory(conversationID)
@@ -154,30 +163,9 @@ func (a *ChatAgent) ChatWithImages(ctx context.Context, conversationID, message
 func (a *ChatAgent) ChatWithImagesAndOptions(ctx context.Context, conversationID, message string, imageURLs []string, opts ChatOptions) (*ChatResult, error) {
 	logger.Info(fmt.Sprintf("[ChatWithImages] ConversationID: %s, Message: %s, Images: %d, NoHistory: %v", conversationID, message, len(imageURLs), opts.NoHistory))
 
-	var content interface{}
-	if len(imageURLs) > 0 {
-		contentItems := []ai.ContentItem{}
-		for _, url := range imageURLs {
-			contentItems = append(contentItems, ai.ContentItem{
-				Type: "image_url",
-				ImageURL: &ai.ImageURL{
-					URL:    url,
-					Detail: "auto",
-				},
-			})
-		}
-		if message != "" {
-			contentItems = append(contentItems, ai.ContentItem{
-				Type: "text",
-				Text: message,
-			})
-		}
-		content = contentItems
-	} else {
-		content = message
-	}
+	content := a.buildUserContent(ctx, message, imageURLs)
 
-	messages := []memory.Message{{Role: "system", Content: a.config.SystemPrompt}}
+	messages := a.baseMessages(opts)
 
 	if !opts.NoHistory {
 		history, _ := a.config.History.GetHistory(conversationID)
@@ -209,7 +197,7 @@ func (a *ChatAgent) ChatWithImagesAndOptions(ctx context.Context, conversationID
 		logger.Warn("[ChatWithImages] No tools available - check AI_TOOLS configuration")
 	}
 
-	logger.Debug(fmt.Sprintf("[ChatWithImages] request: %+v", req))
+	logger.Debug(fmt.Sprintf("[ChatWithImages] request: model=%s, messages=%d, tools=%d", req.Model, len(req.Messages), len(req.Tools)))
 
 	resp, err := a.config.Provider.Complete(ctx, req)
 	if err != nil {
@@ -233,7 +221,7 @@ func (a *ChatAgent) ChatWithImagesAndOptions(ctx context.Context, conversationID
 	if !opts.NoHistory {
 		userMsg := memory.Message{
 			Role:      "user",
-			Content:   content,
+			Content:   historyContent(message, len(imageURLs)),
 			Timestamp: time.Now(),
 		}
 		a.config.History.AddMessage(conversationID, userMsg)
@@ -267,6 +255,57 @@ func (a *ChatAgent) ChatWithImagesAndOptions(ctx context.Context, conversationID
 	return nil, fmt.Errorf("unexpected content type in response")
 }
 
+func (a *ChatAgent) buildUserContent(ctx context.Context, message string, imageURLs []string) interface{} {
+	if len(imageURLs) == 0 {
+		return message
+	}
+
+	detail := "auto"
+	if a.config.ImagePipeline != nil {
+		imageURLs = a.config.ImagePipeline.PrepareAll(ctx, imageURLs)
+		detail = a.config.ImagePipeline.Detail()
+		if len(imageURLs) == 0 {
+			return message
+		}
+	}
+
+	contentItems := []ai.ContentItem{}
+	for _, url := range imageURLs {
+		contentItems = append(contentItems, ai.ContentItem{
+			Type: "image_url",
+			ImageURL: &ai.ImageURL{
+				URL:    url,
+				Detail: detail,
+			},
+		})
+	}
+	if message != "" {
+		contentItems = append(contentItems, ai.ContentItem{
+			Type: "text",
+			Text: message,
+		})
+	}
+	return contentItems
+}
+
+// historyContent is what a message with images is remembered as. The images
+// are inlined as data URLs by then, so keeping them would resend and bill
+// every image again on each later turn.
+func historyContent(message string, images int) string {
+	if images == 0 {
+		return message
+	}
+	return strings.TrimSpace(fmt.Sprintf("[%d image(s)] %s", images, message))
+}
+
+func (a *ChatAgent) baseMessages(opts ChatOptions) []memory.Message {
+	messages := []memory.Message{{Role: "system", Content: a.config.SystemPrompt}}
+	if opts.ExtraContext != "" {
+		messages = append(messages, memory.Message{Role: "system", Content: opts.ExtraContext})
+	}
+	return messages
+}
+
 func (a *ChatAgent) ClearHistory(conversationID string) error {
 	return a.config.History.ClearHistory(conversationID)
 }
@@ -334,7 +373,7 @@ func (a *ChatAgent) handleToolCalls(ctx context.Context, conversationID string,
 
 	logger.Info("[ToolCall] Sending final request to model with tool results")
 
-	messages := []ai.Message{{Role: "system", Content: a.config.SystemPrompt}}
+	messages := convertMessagesToChatRequest(a.baseMessages(opts))
 
 	if !opts.NoHistory {
 		history, _ := a.config.History.GetHistory(conversationID)
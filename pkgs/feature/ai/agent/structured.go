@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/feature/ai"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/memory"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+const maxStructuredAttempts = 3
+
+type Schema struct {
+	Name        string
+	Description string
+	Schema      map[string]interface{}
+}
+
+// ChatStructured asks the model for JSON matching schema and decodes it into
+// out. It requests response_format json_schema when the provider supports it
+// and always restates the schema in the prompt, re-asking with the parse
+// error when the reply cannot be decoded.
+func (a *ChatAgent) ChatStructured(ctx context.Context, conversationID, message string, imageURLs []string, schema Schema, out interface{}, opts ChatOptions) error {
+	logger.Info(fmt.Sprintf("[ChatStructured] ConversationID: %s, Schema: %s, Images: %d", conversationID, schema.Name, len(imageURLs)))
+
+	if target := reflect.ValueOf(out); target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("out must be a non-nil pointer, got %T", out)
+	}
+
+	schemaJSON, err := json.MarshalIndent(schema.Schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	instruction := fmt.Sprintf("%s\n\n请只输出一个符合以下 JSON Schema 的 JSON 值，不要输出任何其他文字或代码块标记：\n%s", message, schemaJSON)
+	userContent := a.buildUserContent(ctx, instruction, imageURLs)
+
+	messages := a.baseMessages(opts)
+	if !opts.NoHistory {
+		history, _ := a.config.History.GetHistory(conversationID)
+		messages = append(messages, history...)
+	}
+	messages = append(messages, memory.Message{Role: "user", Content: userContent, Timestamp: time.Now()})
+
+	var lastErr error
+	for attempt := 1; attempt <= maxStructuredAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		content, err := a.completeStructured(ctx, messages, schema)
+		if err != nil {
+			return err
+		}
+
+		lastErr = decodeStructured(content, schema, out)
+		if lastErr == nil {
+			if !opts.NoHistory {
+				a.config.History.AddMessage(conversationID, memory.Message{Role: "user", Content: message, Timestamp: time.Now()})
+				a.config.History.AddMessage(conversationID, memory.Message{Role: "assistant", Content: content, Timestamp: time.Now()})
+			}
+			return nil
+		}
+
+		logger.Warn(fmt.Sprintf("[ChatStructured] Attempt %d/%d returned invalid JSON: %v", attempt, maxStructuredAttempts, lastErr))
+		messages = append(messages,
+			memory.Message{Role: "assistant", Content: content, Timestamp: time.Now()},
+			memory.Message{Role: "user", Content: fmt.Sprintf("上面的输出无法解析（%v）。请重新输出，只包含符合 Schema 的 JSON。", lastErr), Timestamp: time.Now()},
+		)
+	}
+
+	return fmt.Errorf("structured output failed after %d attempts: %w", maxStructuredAttempts, lastErr)
+}
+
+func (a *ChatAgent) completeStructured(ctx context.Context, messages []memory.Message, schema Schema) (string, error) {
+	req := ai.ChatRequest{
+		Model:       a.config.Model,
+		Messages:    convertMessagesToChatRequest(messages),
+		Stream:      false,
+		Temperature: a.config.Temperature,
+		TopP:        a.config.TopP,
+		MaxTokens:   a.config.MaxTokens,
+	}
+
+	if !a.noResponseFormat.Load() {
+		req.ResponseFormat = &ai.ResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &ai.JSONSchema{
+				Name:        schema.Name,
+				Description: schema.Description,
+				Schema:      schema.Schema,
+			},
+		}
+	}
+
+	resp, err := a.config.Provider.Complete(ctx, req)
+	if err != nil && req.ResponseFormat != nil && isResponseFormatRejected(err) {
+		logger.Warn(fmt.Sprintf("[ChatStructured] Provider rejected response_format, falling back to prompt-only mode: %v", err))
+		a.noResponseFormat.Store(true)
+		req.ResponseFormat = nil
+		resp, err = a.config.Provider.Complete(ctx, req)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("[ChatStructured] API request failed: %v", err))
+		return "", err
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from AI")
+	}
+
+	content, ok := resp.Choices[0].Message.Content.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected content type in response")
+	}
+
+	_, content = parseThinkTags(content)
+	return content, nil
+}
+
+// isResponseFormatRejected reports whether err says the provider does not
+// support response_format. Other 400 errors, such as an overlong context,
+// must not turn structured mode off for good.
+func isResponseFormatRejected(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "response_format") || strings.Contains(msg, "json_schema")
+}
+
+// decodeStructured decodes content into out, a non-nil pointer. out is only
+// written when content is valid, so fields of a failed attempt never leak
+// into the next one.
+func decodeStructured(content string, schema Schema, out interface{}) error {
+	target := reflect.ValueOf(out)
+	raw := extractJSON(content)
+	if raw == "" {
+		return fmt.Errorf("no JSON found in response")
+	}
+
+	decoded := reflect.New(target.Elem().Type())
+	if err := json.Unmarshal([]byte(raw), decoded.Interface()); err != nil {
+		return err
+	}
+	if err := checkRequired(raw, schema); err != nil {
+		return err
+	}
+
+	target.Elem().Set(decoded.Elem())
+	return nil
+}
+
+func checkRequired(raw string, schema Schema) error {
+	var required []string
+	switch r := schema.Schema["required"].(type) {
+	case []string:
+		required = r
+	case []interface{}:
+		for _, name := range r {
+			if s, ok := name.(string); ok {
+				required = append(required, s)
+			}
+		}
+	}
+	if len(required) == 0 {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil
+	}
+	for _, name := range required {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("missing required field %q", name)
+		}
+	}
+	return nil
+}
+
+// extractJSON returns the outermost JSON object or array in content,
+// tolerating markdown code fences and surrounding prose.
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	content = strings.TrimSpace(content)
+
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return ""
+	}
+
+	opening, closing := content[start], byte('}')
+	if opening == '[' {
+		closing = ']'
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && inString:
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == opening:
+			depth++
+		case c == closing:
+			depth--
+			if depth == 0 {
+				return content[start : i+1]
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	APIURL string
+	APIKey string
+
+	STTModel string
+	TTSModel string
+	TTSVoice string
+}
+
+type Client struct {
+	baseURL  string
+	apiKey   string
+	sttModel string
+	ttsModel string
+	ttsVoice string
+	client   *http.Client
+}
+
+func NewClient(cfg Config) *Client {
+	return &Client{
+		baseURL:  BaseURL(cfg.APIURL),
+		apiKey:   cfg.APIKey,
+		sttModel: cfg.STTModel,
+		ttsModel: cfg.TTSModel,
+		ttsVoice: cfg.TTSVoice,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// BaseURL turns a chat completions endpoint into the API root, so the audio
+// endpoints can share the AI_URL setting.
+func BaseURL(apiURL string) string {
+	base := strings.TrimRight(apiURL, "/")
+	base = strings.TrimSuffix(base, "/chat/completions")
+	return base
+}
+
+func (c *Client) Transcribe(ctx context.Context, data []byte, filename string) (string, error) {
+	if c.sttModel == "" {
+		return "", fmt.Errorf("speech-to-text model is not configured")
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	if err := writer.WriteField("model", c.sttModel); err != nil {
+		return "", err
+	}
+
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	respBody, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(result.Text), nil
+}
+
+func (c *Client) Speech(ctx context.Context, text, voice string) ([]byte, error) {
+	if c.ttsModel == "" {
+		return nil, fmt.Errorf("text-to-speech model is not configured")
+	}
+
+	if voice == "" {
+		voice = c.ttsVoice
+	}
+
+	payload := map[string]interface{}{
+		"model":           c.ttsModel,
+		"input":           text,
+		"voice":           voice,
+		"response_format": "mp3",
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/audio/speech", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	return c.do(req)
+}
+
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
+}
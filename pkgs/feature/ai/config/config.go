@@ -25,6 +25,15 @@ type Config struct {
 	SystemPromptPath string
 	SerpAPIKey       string
 	WeatherAPIKey    string
+
+	STTModel string
+	TTSModel string
+	TTSVoice string
+
+	ImageDetail       string
+	ImageCacheDir     string
+	ImageMaxBytes     int
+	ImageMaxDimension int
 }
 
 func Load() *Config {
@@ -42,6 +51,15 @@ func Load() *Config {
 		SystemPromptPath: getEnv("SYSTEM_PROMPT_PATH", "configs/system_prompt.md"),
 		SerpAPIKey:       getEnv("SERP_API_KEY", ""),
 		WeatherAPIKey:    getEnv("WEATHER_API_KEY", ""),
+
+		STTModel: getEnv("AI_STT_MODEL", "FunAudioLLM/SenseVoiceSmall"),
+		TTSModel: getEnv("AI_TTS_MODEL", "FunAudioLLM/CosyVoice2-0.5B"),
+		TTSVoice: getEnv("AI_TTS_VOICE", "FunAudioLLM/CosyVoice2-0.5B:alex"),
+
+		ImageDetail:       getEnv("AI_IMAGE_DETAIL", "auto"),
+		ImageCacheDir:     getEnv("AI_IMAGE_CACHE_DIR", "data/image_cache"),
+		ImageMaxBytes:     getEnvInt("AI_IMAGE_MAX_BYTES", 10*1024*1024),
+		ImageMaxDimension: getEnvInt("AI_IMAGE_MAX_DIMENSION", 1568),
 	}
 }
 
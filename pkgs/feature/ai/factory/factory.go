@@ -4,16 +4,19 @@ import (
 	"os"
 
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/agent"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/audio"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/config"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/memory"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/provider"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/service"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/tool"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/tool/plugins"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/vision"
 )
 
 type Factory struct {
-	config *config.Config
+	config   *config.Config
+	pipeline *vision.Pipeline
 }
 
 func NewFactory(cfg *config.Config) *Factory {
@@ -26,6 +29,28 @@ func (f *Factory) CreateProvider() provider.LLMProvider {
 	return provider.NewHTTPProvider(f.config.APIURL, f.config.APIKey)
 }
 
+func (f *Factory) CreateAudioClient() *audio.Client {
+	return audio.NewClient(audio.Config{
+		APIURL:   f.config.APIURL,
+		APIKey:   f.config.APIKey,
+		STTModel: f.config.STTModel,
+		TTSModel: f.config.TTSModel,
+		TTSVoice: f.config.TTSVoice,
+	})
+}
+
+func (f *Factory) ImagePipeline() *vision.Pipeline {
+	if f.pipeline == nil {
+		f.pipeline = vision.NewPipeline(vision.Config{
+			CacheDir:     f.config.ImageCacheDir,
+			MaxBytes:     int64(f.config.ImageMaxBytes),
+			MaxDimension: f.config.ImageMaxDimension,
+			Detail:       f.config.ImageDetail,
+		})
+	}
+	return f.pipeline
+}
+
 func (f *Factory) CreateMemoryStore() *memory.MemoryStore {
 	return memory.NewMemoryStore(f.config.MaxHistory)
 }
@@ -62,6 +87,8 @@ func (f *Factory) CreateAgent() *agent.ChatAgent {
 		MaxTokens:   f.config.MaxTokens,
 
 		ToolsEnabled: f.config.ToolsEnabled,
+
+		ImagePipeline: f.ImagePipeline(),
 	})
 }
 
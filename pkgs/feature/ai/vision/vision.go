@@ -0,0 +1,347 @@
+package vision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+type Config struct {
+	CacheDir      string
+	CacheMaxAge   time.Duration
+	CacheMaxBytes int64
+	MaxBytes      int64
+	MaxDimension  int
+	Detail        string
+}
+
+const (
+	maxSources         = 1024
+	cachePruneInterval = 10 * time.Minute
+)
+
+// Resolver fetches image bytes through a side channel (e.g. NapCat get_image)
+// when the source cannot be downloaded directly.
+type Resolver func(ctx context.Context, source string) ([]byte, error)
+
+type imageFilesKey struct{}
+
+// WithImageFiles returns ctx carrying the QQ file id of each image URL, so a
+// Resolver can look an image up by id once its URL has expired.
+func WithImageFiles(ctx context.Context, files map[string]string) context.Context {
+	if len(files) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, imageFilesKey{}, files)
+}
+
+// ImageFile returns the file id recorded for source by WithImageFiles, or
+// source itself when there is none.
+func ImageFile(ctx context.Context, source string) string {
+	files, _ := ctx.Value(imageFilesKey{}).(map[string]string)
+	if file, ok := files[source]; ok {
+		return file
+	}
+	return source
+}
+
+type Pipeline struct {
+	cfg      Config
+	client   *http.Client
+	resolver Resolver
+	mu       sync.RWMutex
+	// sources maps an image source to the hash of its content, whose
+	// processed bytes live in the disk cache.
+	sources   map[string]string
+	lastPrune time.Time
+}
+
+var allowedTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+func NewPipeline(cfg Config) *Pipeline {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 10 * 1024 * 1024
+	}
+	if cfg.MaxDimension <= 0 {
+		cfg.MaxDimension = 1568
+	}
+	if cfg.Detail == "" {
+		cfg.Detail = "auto"
+	}
+	if cfg.CacheMaxAge <= 0 {
+		cfg.CacheMaxAge = 7 * 24 * time.Hour
+	}
+	if cfg.CacheMaxBytes <= 0 {
+		cfg.CacheMaxBytes = 256 * 1024 * 1024
+	}
+
+	if cfg.CacheDir != "" {
+		if err := os.MkdirAll(cfg.CacheDir, 0755); err != nil {
+			logger.Warn(fmt.Sprintf("[Vision] Failed to create cache dir %s: %v, caching disabled", cfg.CacheDir, err))
+			cfg.CacheDir = ""
+		}
+	}
+
+	p := &Pipeline{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		sources:   make(map[string]string),
+		lastPrune: time.Now(),
+	}
+	p.pruneCache()
+	return p
+}
+
+func (p *Pipeline) SetResolver(resolver Resolver) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resolver = resolver
+}
+
+func (p *Pipeline) Detail() string {
+	return p.cfg.Detail
+}
+
+// PrepareAll converts every source into a data URL. Sources that fail are
+// logged and dropped rather than handed to the model as raw URLs.
+func (p *Pipeline) PrepareAll(ctx context.Context, sources []string) []string {
+	result := make([]string, 0, len(sources))
+	for _, source := range sources {
+		dataURL, err := p.Prepare(ctx, source)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("[Vision] Dropping image that could not be prepared: %v", err))
+			continue
+		}
+		result = append(result, dataURL)
+	}
+	return result
+}
+
+func (p *Pipeline) Prepare(ctx context.Context, source string) (string, error) {
+	if strings.HasPrefix(source, "data:") {
+		return source, nil
+	}
+
+	if hash, ok := p.lookupSource(source); ok {
+		if cached, cachedType, ok := p.readCache(hash); ok {
+			return toDataURL(cachedType, cached), nil
+		}
+	}
+
+	data, err := p.fetch(ctx, source)
+	if err != nil {
+		return "", err
+	}
+
+	if int64(len(data)) > p.cfg.MaxBytes {
+		return "", fmt.Errorf("image too large: %d bytes (max %d)", len(data), p.cfg.MaxBytes)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if _, ok := allowedTypes[mimeType]; !ok {
+		return "", fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if cached, cachedType, ok := p.readCache(hash); ok {
+		p.storeSource(source, hash)
+		return toDataURL(cachedType, cached), nil
+	}
+
+	processed, processedType, err := downscale(data, mimeType, p.cfg.MaxDimension)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("[Vision] Failed to downscale image %s: %v, sending original", hash[:12], err))
+		processed, processedType = data, mimeType
+	}
+
+	if p.writeCache(hash, processedType, processed) {
+		p.storeSource(source, hash)
+	}
+	return toDataURL(processedType, processed), nil
+}
+
+func (p *Pipeline) fetch(ctx context.Context, source string) ([]byte, error) {
+	var httpErr error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err := p.download(ctx, source)
+		if err == nil {
+			return data, nil
+		}
+		httpErr = err
+	}
+
+	p.mu.RLock()
+	resolver := p.resolver
+	p.mu.RUnlock()
+
+	if resolver != nil {
+		data, err := resolver(ctx, source)
+		if err == nil {
+			return data, nil
+		}
+		if httpErr != nil {
+			return nil, fmt.Errorf("download failed: %v; resolver failed: %w", httpErr, err)
+		}
+		return nil, err
+	}
+
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	return nil, fmt.Errorf("cannot fetch image source: %s", source)
+}
+
+func (p *Pipeline) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("image download error %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, p.cfg.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (p *Pipeline) lookupSource(source string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	hash, ok := p.sources[source]
+	return hash, ok
+}
+
+func (p *Pipeline) storeSource(source, hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.sources) >= maxSources {
+		p.sources = make(map[string]string)
+	}
+	p.sources[source] = hash
+}
+
+func (p *Pipeline) readCache(hash string) ([]byte, string, bool) {
+	if p.cfg.CacheDir == "" {
+		return nil, "", false
+	}
+
+	for mimeType, ext := range allowedTypes {
+		path := filepath.Join(p.cfg.CacheDir, hash+"."+ext)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			// Touch the file so pruning drops the least recently used first.
+			now := time.Now()
+			_ = os.Chtimes(path, now, now)
+			return data, mimeType, true
+		}
+	}
+	return nil, "", false
+}
+
+// writeCache stores data under hash and reports whether it was written.
+func (p *Pipeline) writeCache(hash, mimeType string, data []byte) bool {
+	if p.cfg.CacheDir == "" {
+		return false
+	}
+
+	path := filepath.Join(p.cfg.CacheDir, hash+"."+allowedTypes[mimeType])
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logger.Warn(fmt.Sprintf("[Vision] Failed to write cache %s: %v", path, err))
+		return false
+	}
+
+	p.mu.Lock()
+	due := time.Since(p.lastPrune) >= cachePruneInterval
+	if due {
+		p.lastPrune = time.Now()
+	}
+	p.mu.Unlock()
+	if due {
+		p.pruneCache()
+	}
+	return true
+}
+
+// pruneCache removes cached images older than CacheMaxAge, then the least
+// recently used ones until the cache fits in CacheMaxBytes.
+func (p *Pipeline) pruneCache() {
+	if p.cfg.CacheDir == "" {
+		return
+	}
+
+	entries, err := os.ReadDir(p.cfg.CacheDir)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("[Vision] Failed to read cache dir %s: %v", p.cfg.CacheDir, err))
+		return
+	}
+
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	cutoff := time.Now().Add(-p.cfg.CacheMaxAge)
+	var files []cacheFile
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(p.cfg.CacheDir, entry.Name())
+		if info.ModTime().Before(cutoff) {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	if total <= p.cfg.CacheMaxBytes {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= p.cfg.CacheMaxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+		}
+	}
+}
+
+func toDataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,400 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+type Direction string
+
+const (
+	DirectionIn  Direction = "in"
+	DirectionOut Direction = "out"
+)
+
+const dayLayout = "2006-01-02"
+
+// Archive stores incoming and outgoing messages as one JSON lines file per
+// day and keeps an in-memory inverted index over the retained records for
+// full-text search.
+type Archive struct {
+	mu        sync.RWMutex
+	dir       string
+	retention time.Duration
+	records   []Record
+	index     map[string][]int
+	file      *os.File
+	fileDay   string
+}
+
+type Query struct {
+	Keywords  string
+	GroupID   int64
+	UserID    int64
+	Direction Direction
+	Since     time.Time
+	Until     time.Time
+	Offset    int
+	Limit     int
+}
+
+type GroupStat struct {
+	GroupID   int64 `json:"group_id"`
+	Count     int   `json:"count"`
+	FirstTime int64 `json:"first_time"`
+	LastTime  int64 `json:"last_time"`
+}
+
+func NewArchive(dir string, retentionDays int) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	a := &Archive{
+		dir:       dir,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+		index:     make(map[string][]int),
+	}
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	a.Prune()
+
+	logger.Info(fmt.Sprintf("[Archive] Loaded %d messages from %s", len(a.records), dir))
+	return a, nil
+}
+
+var defaultArchive *Archive
+
+func SetDefault(a *Archive) {
+	defaultArchive = a
+}
+
+// Default returns the archive shared by the bot, or nil when archiving is
+// disabled.
+func Default() *Archive {
+	return defaultArchive
+}
+
+func (a *Archive) Add(record Record) {
+	if record.Time == 0 {
+		record.Time = time.Now().Unix()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.indexRecord(len(a.records), record)
+	a.records = append(a.records, record)
+
+	if err := a.appendToFile(record); err != nil {
+		logger.Error(fmt.Sprintf("[Archive] Failed to persist message: %v", err))
+	}
+}
+
+// Search returns records matching the query, newest first, along with the
+// total number of matches before Offset and Limit are applied.
+func (a *Archive) Search(q Query) ([]Record, int) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	keywords := strings.Fields(strings.ToLower(q.Keywords))
+	candidates := a.candidates(q.Keywords)
+
+	var results []Record
+	total := 0
+	for i := len(candidates) - 1; i >= 0; i-- {
+		record := a.records[candidates[i]]
+		if !q.matches(record, keywords) {
+			continue
+		}
+
+		total++
+		if total <= q.Offset || (q.Limit > 0 && len(results) >= q.Limit) {
+			continue
+		}
+		results = append(results, record)
+	}
+
+	return results, total
+}
+
+func (a *Archive) Groups() []GroupStat {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	stats := make(map[int64]*GroupStat)
+	for _, record := range a.records {
+		if record.GroupID == 0 {
+			continue
+		}
+		stat, ok := stats[record.GroupID]
+		if !ok {
+			stat = &GroupStat{GroupID: record.GroupID, FirstTime: record.Time}
+			stats[record.GroupID] = stat
+		}
+		stat.Count++
+		stat.FirstTime = min(stat.FirstTime, record.Time)
+		stat.LastTime = max(stat.LastTime, record.Time)
+	}
+
+	result := make([]GroupStat, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastTime > result[j].LastTime })
+	return result
+}
+
+func (a *Archive) Count() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.records)
+}
+
+func (a *Archive) RetentionDays() int {
+	return int(a.retention / (24 * time.Hour))
+}
+
+// Prune drops records and day files older than the retention period and
+// returns the number of records removed. A zero retention keeps everything.
+func (a *Archive) Prune() int {
+	if a.retention <= 0 {
+		return 0
+	}
+
+	cutoff := time.Now().Add(-a.retention)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	kept := make([]Record, 0, len(a.records))
+	for _, record := range a.records {
+		if record.Time >= cutoff.Unix() {
+			kept = append(kept, record)
+		}
+	}
+	removed := len(a.records) - len(kept)
+
+	if removed > 0 {
+		a.records = kept
+		a.index = make(map[string][]int)
+		for i, record := range a.records {
+			a.indexRecord(i, record)
+		}
+	}
+
+	cutoffDay := cutoff.Format(dayLayout)
+	for _, day := range a.days() {
+		if day < cutoffDay && day != a.fileDay {
+			if err := os.Remove(a.dayPath(day)); err != nil {
+				logger.Warn(fmt.Sprintf("[Archive] Failed to remove %s: %v", a.dayPath(day), err))
+			}
+		}
+	}
+
+	if removed > 0 {
+		logger.Info(fmt.Sprintf("[Archive] Pruned %d messages older than %s", removed, cutoffDay))
+	}
+	return removed
+}
+
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	a.fileDay = ""
+	return err
+}
+
+func (a *Archive) candidates(keywords string) []int {
+	terms := queryTerms(keywords)
+	if len(terms) == 0 {
+		all := make([]int, len(a.records))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+
+	postings := make([][]int, len(terms))
+	for i, term := range terms {
+		postings[i] = a.postings(term)
+		if len(postings[i]) == 0 {
+			return nil
+		}
+	}
+	sort.Slice(postings, func(i, j int) bool { return len(postings[i]) < len(postings[j]) })
+
+	result := postings[0]
+	for _, list := range postings[1:] {
+		result = intersect(result, list)
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// postings returns the records containing term. Latin words also match
+// longer indexed words they are a prefix of, so "wor" finds "world".
+func (a *Archive) postings(term string) []int {
+	if isCJK([]rune(term)[0]) {
+		return a.index[term]
+	}
+
+	seen := make(map[int]bool)
+	var result []int
+	for indexed, positions := range a.index {
+		if !strings.HasPrefix(indexed, term) {
+			continue
+		}
+		for _, pos := range positions {
+			if !seen[pos] {
+				seen[pos] = true
+				result = append(result, pos)
+			}
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+func (q Query) matches(record Record, keywords []string) bool {
+	if q.GroupID != 0 && record.GroupID != q.GroupID {
+		return false
+	}
+	if q.UserID != 0 && record.UserID != q.UserID {
+		return false
+	}
+	if q.Direction != "" && record.Direction != q.Direction {
+		return false
+	}
+	if !q.Since.IsZero() && record.Time < q.Since.Unix() {
+		return false
+	}
+	if !q.Until.IsZero() && record.Time > q.Until.Unix() {
+		return false
+	}
+
+	text := strings.ToLower(record.Text)
+	for _, keyword := range keywords {
+		if !strings.Contains(text, keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+func intersect(a, b []int) []int {
+	var result []int
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return result
+}
+
+func (a *Archive) indexRecord(pos int, record Record) {
+	for _, term := range Tokenize(record.Text) {
+		a.index[term] = append(a.index[term], pos)
+	}
+}
+
+func (a *Archive) appendToFile(record Record) error {
+	day := time.Unix(record.Time, 0).Format(dayLayout)
+	if a.file == nil || a.fileDay != day {
+		if a.file != nil {
+			a.file.Close()
+		}
+
+		file, err := os.OpenFile(a.dayPath(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			a.file = nil
+			return err
+		}
+		a.file = file
+		a.fileDay = day
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+func (a *Archive) load() error {
+	for _, day := range a.days() {
+		file, err := os.Open(a.dayPath(day))
+		if err != nil {
+			return fmt.Errorf("failed to open archive file: %w", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue
+			}
+			a.records = append(a.records, record)
+		}
+		err = scanner.Err()
+		file.Close()
+
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", a.dayPath(day), err)
+		}
+	}
+
+	sort.SliceStable(a.records, func(i, j int) bool { return a.records[i].Time < a.records[j].Time })
+	a.index = make(map[string][]int)
+	for i, record := range a.records {
+		a.indexRecord(i, record)
+	}
+	return nil
+}
+
+func (a *Archive) days() []string {
+	matches, _ := filepath.Glob(filepath.Join(a.dir, "*.jsonl"))
+
+	days := make([]string, 0, len(matches))
+	for _, match := range matches {
+		day := strings.TrimSuffix(filepath.Base(match), ".jsonl")
+		if _, err := time.Parse(dayLayout, day); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+	return days
+}
+
+func (a *Archive) dayPath(day string) string {
+	return filepath.Join(a.dir, day+".jsonl")
+}
@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	ExportJSONL ExportFormat = "jsonl"
+	ExportCSV   ExportFormat = "csv"
+	ExportText  ExportFormat = "txt"
+)
+
+// Export writes every record matching the query, oldest first, in the given
+// format. Offset and Limit of the query are ignored.
+func (a *Archive) Export(w io.Writer, q Query, format ExportFormat) error {
+	q.Offset, q.Limit = 0, 0
+	records, _ := a.Search(q)
+
+	switch format {
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		for i := len(records) - 1; i >= 0; i-- {
+			if err := enc.Encode(records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"time", "direction", "message_type", "group_id", "user_id", "sender_name", "message_id", "text"}); err != nil {
+			return err
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			r := records[i]
+			row := []string{
+				time.Unix(r.Time, 0).Format(time.RFC3339),
+				string(r.Direction),
+				r.MessageType,
+				strconv.FormatInt(r.GroupID, 10),
+				strconv.FormatInt(r.UserID, 10),
+				r.SenderName,
+				strconv.FormatInt(r.MessageID, 10),
+				r.Text,
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case ExportText:
+		for i := len(records) - 1; i >= 0; i-- {
+			r := records[i]
+			if _, err := fmt.Fprintf(w, "[%s] %s(%d): %s\n", time.Unix(r.Time, 0).Format("2006-01-02 15:04:05"), r.SenderName, r.UserID, r.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported export format: %s", format)
+}
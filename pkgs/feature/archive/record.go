@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/napcat"
+)
+
+type Record struct {
+	MessageID   int64                `json:"message_id"`
+	Direction   Direction            `json:"direction"`
+	MessageType string               `json:"message_type"`
+	GroupID     int64                `json:"group_id,omitempty"`
+	UserID      int64                `json:"user_id"`
+	SenderName  string               `json:"sender_name"`
+	Segments    []bot.MessageSegment `json:"segments"`
+	Text        string               `json:"text"`
+	Time        int64                `json:"time"`
+}
+
+var cqCodePattern = regexp.MustCompile(`\[CQ:([a-z_]+)[^\]]*\]`)
+
+// FromEvent builds a record for an incoming group or private message.
+func FromEvent(event *bot.Event) Record {
+	record := Record{
+		MessageID:   int64(event.MessageID),
+		Direction:   DirectionIn,
+		MessageType: string(event.MessageType),
+		GroupID:     event.GroupID,
+		UserID:      event.UserID,
+		Time:        event.Time,
+	}
+
+	if event.Sender != nil {
+		record.SenderName = event.Sender.Nickname
+		if event.Sender.Card != "" {
+			record.SenderName = event.Sender.Card
+		}
+	}
+
+	record.Segments = event.GetSegments()
+	if len(record.Segments) == 0 && event.RawMessage != "" {
+		record.Segments = normalizeSegments(event.RawMessage)
+	}
+	record.Text = segmentsText(record.Segments)
+
+	return record
+}
+
+// FromSent builds a record for a message the bot sent.
+func FromSent(msg napcat.SentMessage) Record {
+	record := Record{
+		MessageID:   msg.MessageID,
+		Direction:   DirectionOut,
+		MessageType: msg.MessageType,
+		GroupID:     msg.GroupID,
+		UserID:      msg.UserID,
+		SenderName:  "Bot",
+		Segments:    normalizeSegments(msg.Message),
+	}
+	record.Text = segmentsText(record.Segments)
+
+	return record
+}
+
+// normalizeSegments turns anything accepted as a message by the send APIs,
+// a string, segment slices or forward nodes, into message segments.
+func normalizeSegments(message interface{}) []bot.MessageSegment {
+	if text, ok := message.(string); ok {
+		return []bot.MessageSegment{{Type: "text", Data: map[string]interface{}{"text": text}}}
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil
+	}
+
+	var segments []bot.MessageSegment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		var single bot.MessageSegment
+		if err := json.Unmarshal(data, &single); err != nil || single.Type == "" {
+			return nil
+		}
+		segments = []bot.MessageSegment{single}
+	}
+	return segments
+}
+
+func segmentsText(segments []bot.MessageSegment) string {
+	var parts []string
+	for _, seg := range segments {
+		if text := segmentText(seg); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+func segmentText(seg bot.MessageSegment) string {
+	switch seg.Type {
+	case "text":
+		text, _ := seg.Data["text"].(string)
+		return cqCodePattern.ReplaceAllStringFunc(text, func(code string) string {
+			return segmentLabel(cqCodePattern.FindStringSubmatch(code)[1])
+		})
+	case "at":
+		return fmt.Sprintf("@%v", seg.Data["qq"])
+	case "node":
+		if content, ok := seg.Data["content"]; ok {
+			return segmentsText(normalizeSegments(content))
+		}
+		return ""
+	}
+	return segmentLabel(seg.Type)
+}
+
+func segmentLabel(segType string) string {
+	switch segType {
+	case "reply":
+		return ""
+	case "image":
+		return "[图片]"
+	case "face", "mface":
+		return "[表情]"
+	case "record":
+		return "[语音]"
+	case "video":
+		return "[视频]"
+	case "file":
+		return "[文件]"
+	case "forward":
+		return "[聊天记录]"
+	}
+	return "[" + segType + "]"
+}
@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into index terms. Latin words and numbers become
+// lowercase terms, while runs of CJK characters, which have no spaces
+// between words, are indexed as single characters plus overlapping bigrams.
+func Tokenize(text string) []string {
+	return tokenize(text, true)
+}
+
+// queryTerms tokenizes a search query. CJK runs longer than one character
+// only need their bigrams, since every bigram of the query must match.
+func queryTerms(text string) []string {
+	return tokenize(text, false)
+}
+
+func tokenize(text string, unigrams bool) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	var word strings.Builder
+	var run []rune
+
+	flushWord := func() {
+		add(word.String())
+		word.Reset()
+	}
+	flushRun := func() {
+		if len(run) == 1 || (unigrams && len(run) > 0) {
+			for _, r := range run {
+				add(string(r))
+			}
+		}
+		for i := 0; i+1 < len(run); i++ {
+			add(string(run[i : i+2]))
+		}
+		run = run[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			run = append(run, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushRun()
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+			flushRun()
+		}
+	}
+	flushWord()
+	flushRun()
+
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -16,6 +16,14 @@ type Analyzer struct {
 	systemPrompt string
 	logger       *logger.Logger
 	parser       *Parser
+	options      AnalyzerOptions
+}
+
+var DefaultAnalyzerOptions = AnalyzerOptions{
+	Mode:              ModeAuto,
+	WindowSize:        20,
+	Concurrency:       3,
+	TimeoutPerRequest: 60 * time.Second,
 }
 
 func NewAnalyzer(chatAgent *agent.ChatAgent, systemPrompt string, maxHistory int) *Analyzer {
@@ -24,15 +32,32 @@ func NewAnalyzer(chatAgent *agent.ChatAgent, systemPrompt string, maxHistory int
 		systemPrompt: systemPrompt,
 		logger:       logger.NewLogger(1000),
 		parser:       NewParser(),
+		options:      DefaultAnalyzerOptions,
 	}
 }
 
-func (a *Analyzer) AnalyzeAll(ctx context.Context, messages []ChatMessage) (*ChatAnalysis, error) {
+func (a *Analyzer) SetOptions(opts AnalyzerOptions) {
+	if opts.Mode == "" {
+		opts.Mode = DefaultAnalyzerOptions.Mode
+	}
+	if opts.WindowSize <= 0 {
+		opts.WindowSize = DefaultAnalyzerOptions.WindowSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultAnalyzerOptions.Concurrency
+	}
+	if opts.TimeoutPerRequest <= 0 {
+		opts.TimeoutPerRequest = DefaultAnalyzerOptions.TimeoutPerRequest
+	}
+	a.options = opts
+}
+
+func (a *Analyzer) AnalyzeAll(ctx context.Context, messages []ChatMessage, onProgress ProgressFunc) (*ChatAnalysis, error) {
 	if len(messages) == 0 {
 		return &ChatAnalysis{}, nil
 	}
 
-	mergedGroup := a.parser.MergeConsecutiveMessages(messages)
+	mergedGroup := a.parser.MergeConsecutiveMessages(FlattenMessages(messages))
 
 	mergedMessages := make([]ChatMessage, 0, len(mergedGroup.MergedMessages))
 	for _, merged := range mergedGroup.MergedMessages {
@@ -44,11 +69,13 @@ func (a *Analyzer) AnalyzeAll(ctx context.Context, messages []ChatMessage) (*Cha
 			Images:      merged.Images,
 			MessageType: merged.MessageType,
 			Timestamp:   merged.Timestamps[0],
+			ReplyTo:     merged.ReplyTo,
+			Depth:       merged.Depth,
 		}
 		mergedMessages = append(mergedMessages, mergedMsg)
 	}
 
-	chainResult, err := a.AnalyzeWithChain(ctx, mergedMessages)
+	chainResult, err := a.AnalyzeWithChain(ctx, mergedMessages, onProgress)
 	if err != nil {
 		return nil, err
 	}
@@ -68,16 +95,23 @@ func (a *Analyzer) AnalyzeAll(ctx context.Context, messages []ChatMessage) (*Cha
 	}, nil
 }
 
-func (a *Analyzer) AnalyzeWithChain(ctx context.Context, messages []ChatMessage) (*ChainRequestResult, error) {
+func (a *Analyzer) AnalyzeWithChain(ctx context.Context, messages []ChatMessage, onProgress ProgressFunc) (*ChainRequestResult, error) {
 	conversationID := fmt.Sprintf("forward_%d_%d", messages[0].MessageID, time.Now().Unix())
 
 	config := &ChainRequestConfig{
 		ConversationID:    conversationID,
 		Messages:          messages,
-		TimeoutPerRequest: 30 * time.Second,
+		TimeoutPerRequest: a.options.TimeoutPerRequest,
+		Mode:              a.options.Mode,
+		WindowSize:        a.options.WindowSize,
+		Concurrency:       a.options.Concurrency,
+		OnProgress:        onProgress,
 	}
 
-	return a.chainAnalyze(ctx, config)
+	if config.Mode == ModeChain {
+		return a.chainAnalyze(ctx, config)
+	}
+	return a.batchAnalyze(ctx, config)
 }
 
 func (a *Analyzer) chainAnalyze(ctx context.Context, config *ChainRequestConfig) (*ChainRequestResult, error) {
@@ -90,7 +124,11 @@ func (a *Analyzer) chainAnalyze(ctx context.Context, config *ChainRequestConfig)
 	for i, msg := range config.Messages {
 		a.logger.Info(fmt.Sprintf("处理第 %d/%d 条消息，发送者: %s", i+1, len(config.Messages), msg.SenderName))
 
-		analysis, err := a.processSingleMessage(ctx, config.ConversationID, msg, i, result.MessageAnalyses)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		analysis, err := a.processSingleMessage(ctx, config, msg, result.MessageAnalyses)
 		if err != nil {
 			a.logger.Error(fmt.Sprintf("消息 %d 处理失败: %v", i+1, err))
 			result.Errors = append(result.Errors, fmt.Errorf("消息%d处理失败: %w", i+1, err))
@@ -99,6 +137,7 @@ func (a *Analyzer) chainAnalyze(ctx context.Context, config *ChainRequestConfig)
 			result.MessageAnalyses = append(result.MessageAnalyses, MessageAnalysis{
 				Content: fmt.Sprintf("[分析失败] %v", err),
 			})
+			config.reportProgress(i + 1)
 			continue
 		}
 
@@ -106,12 +145,15 @@ func (a *Analyzer) chainAnalyze(ctx context.Context, config *ChainRequestConfig)
 			Content: analysis,
 		})
 		result.SuccessCount++
+		config.reportProgress(i + 1)
 
 		a.logger.Info(fmt.Sprintf("消息 %d 处理完成", i+1))
 	}
 
 	a.logger.Info("开始生成整体总结")
-	summary, err := a.generateSummary(ctx, config.ConversationID, result.MessageAnalyses)
+	summaryCtx, cancel := withRequestTimeout(ctx, config.TimeoutPerRequest)
+	summary, err := a.generateSummary(summaryCtx, config.ConversationID, result.MessageAnalyses)
+	cancel()
 	if err != nil {
 		a.logger.Error(fmt.Sprintf("总结生成失败: %v", err))
 		result.Errors = append(result.Errors, fmt.Errorf("总结生成失败: %w", err))
@@ -126,7 +168,11 @@ func (a *Analyzer) chainAnalyze(ctx context.Context, config *ChainRequestConfig)
 	return result, nil
 }
 
-func (a *Analyzer) processSingleMessage(ctx context.Context, conversationID string, msg ChatMessage, index int, previousAnalyses []MessageAnalysis) (string, error) {
+func (a *Analyzer) processSingleMessage(ctx context.Context, config *ChainRequestConfig, msg ChatMessage, previousAnalyses []MessageAnalysis) (string, error) {
+	ctx, cancel := withRequestTimeout(ctx, config.TimeoutPerRequest)
+	defer cancel()
+
+	conversationID := config.ConversationID
 	prompt := a.buildSingleMessagePrompt(msg, previousAnalyses)
 
 	var result *agent.ChatResult
@@ -177,7 +223,11 @@ func (a *Analyzer) buildSingleMessagePrompt(msg ChatMessage, previousAnalyses []
 	}
 
 	if msg.ReplyTo != nil {
-		prompt.WriteString(fmt.Sprintf("回复给：%s 的消息\n", msg.ReplyTo.SenderName))
+		prompt.WriteString(fmt.Sprintf("回复给：%s 的消息「%s」\n", msg.ReplyTo.SenderName, replySnippet(*msg.ReplyTo)))
+	}
+
+	if msg.Depth > 0 {
+		prompt.WriteString(fmt.Sprintf("位置：第%d层嵌套合并转发中的消息\n", msg.Depth))
 	}
 
 	if isMerged {
@@ -214,6 +264,13 @@ func (a *Analyzer) generateSummary(ctx context.Context, conversationID string, a
 	return strings.TrimSpace(result.Content), nil
 }
 
+func withRequestTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 func parseAnalysisResult(content string) string {
 	re := regexp.MustCompile(`(?s)<think>\n(.*?)\n</think>\n(.*)`)
 	matches := re.FindStringSubmatch(content)
@@ -0,0 +1,282 @@
+package chat_explainer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/agent"
+)
+
+const maxImagesPerCall = 6
+
+type transcriptAnalysis struct {
+	Analyses []struct {
+		Index       int    `json:"index"`
+		Explanation string `json:"explanation"`
+	} `json:"analyses"`
+	Summary string `json:"summary"`
+}
+
+var transcriptSchema = agent.Schema{
+	Name:        "chat_transcript_analysis",
+	Description: "Per-message explanations and an overall summary of a group chat transcript",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"analyses": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"index":       map[string]interface{}{"type": "integer"},
+						"explanation": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"index", "explanation"},
+				},
+			},
+			"summary": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"analyses", "summary"},
+	},
+}
+
+// batchAnalyze explains the whole transcript in one structured call, or, when
+// it is longer than the window size, in windows analysed concurrently
+// followed by a summary pass.
+func (a *Analyzer) batchAnalyze(ctx context.Context, config *ChainRequestConfig) (*ChainRequestResult, error) {
+	messages := config.Messages
+	windowSize := config.WindowSize
+	if windowSize <= 0 {
+		windowSize = len(messages)
+	}
+
+	if config.Mode == ModeSingle || len(messages) <= windowSize {
+		a.logger.Info(fmt.Sprintf("单次请求分析 %d 条消息", len(messages)))
+		config.reportProgress(0)
+		analysis, err := a.analyzeWindow(ctx, config, 0, len(messages), true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			a.logger.Warn(fmt.Sprintf("单次请求分析失败，回退到链式分析: %v", err))
+			return a.chainAnalyze(ctx, config)
+		}
+		config.reportProgress(len(messages))
+		return a.collectWindows(config, []*transcriptAnalysis{analysis}, analysis.Summary, nil), nil
+	}
+
+	var starts []int
+	for start := 0; start < len(messages); start += windowSize {
+		starts = append(starts, start)
+	}
+
+	a.logger.Info(fmt.Sprintf("分 %d 个窗口并发分析 %d 条消息，并发数 %d", len(starts), len(messages), config.Concurrency))
+
+	windows := make([]*transcriptAnalysis, len(starts))
+	errs := make([]error, len(starts))
+
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for i, start := range starts {
+		end := min(start+windowSize, len(messages))
+
+		wg.Add(1)
+		go func(i, start, end int) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			windows[i], errs[i] = a.analyzeWindow(ctx, config, start, end, false)
+			if errs[i] != nil {
+				a.logger.Error(fmt.Sprintf("窗口 %d 分析失败: %v", i+1, errs[i]))
+			}
+
+			mu.Lock()
+			done += end - start
+			config.reportProgress(done)
+			mu.Unlock()
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var windowSummaries []string
+	var failures []error
+	for i, w := range windows {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("窗口%d分析失败: %w", i+1, errs[i]))
+			continue
+		}
+		windowSummaries = append(windowSummaries, fmt.Sprintf("第%d段：%s", i+1, w.Summary))
+	}
+
+	summary := "总结生成失败"
+	if len(windowSummaries) > 0 {
+		s, err := a.summarizeWindows(ctx, config, windowSummaries)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("总结生成失败: %w", err))
+		} else {
+			summary = s
+		}
+	}
+
+	return a.collectWindows(config, windows, summary, failures), nil
+}
+
+func (a *Analyzer) analyzeWindow(ctx context.Context, config *ChainRequestConfig, start, end int, whole bool) (*transcriptAnalysis, error) {
+	ctx, cancel := withRequestTimeout(ctx, config.TimeoutPerRequest)
+	defer cancel()
+
+	prompt, images := a.buildTranscriptPrompt(config.Messages, start, end, whole)
+
+	var result transcriptAnalysis
+	err := a.agent.ChatStructured(ctx, config.ConversationID, prompt, images, transcriptSchema, &result, agent.ChatOptions{NoHistory: true})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (a *Analyzer) buildTranscriptPrompt(messages []ChatMessage, start, end int, whole bool) (string, []string) {
+	var prompt strings.Builder
+	var images []string
+	nested := false
+
+	prompt.WriteString("你是群聊对话解读助手。\n\n")
+
+	if start > 0 {
+		prompt.WriteString("【前文（仅供理解上下文，无需分析）】\n")
+		for i := max(0, start-3); i < start; i++ {
+			prompt.WriteString(fmt.Sprintf("%s：%s\n", messages[i].SenderName, transcriptLine(messages[i])))
+		}
+		prompt.WriteString("\n")
+	}
+
+	prompt.WriteString("【需要分析的对话】每行以 #序号 开头：\n")
+	for i := start; i < end; i++ {
+		msg := messages[i]
+		line := transcriptLine(msg)
+		for _, image := range msg.Images {
+			if len(images) >= maxImagesPerCall {
+				break
+			}
+			images = append(images, image)
+			line += fmt.Sprintf(" [附图%d]", len(images))
+		}
+		if msg.Depth > 0 {
+			nested = true
+		}
+		prompt.WriteString(formatTranscriptEntry(i, msg, line))
+	}
+
+	prompt.WriteString("\n要求：\n")
+	prompt.WriteString(fmt.Sprintf("1. analyses 中为 #%d 到 #%d 的每一条消息各给出一条 explanation，index 使用消息序号，用2-3句话解释这条消息在讨论什么、在对话中起什么作用，涉及专业术语时顺便解释。\n", start+1, end))
+	if whole {
+		prompt.WriteString("2. summary 总结整段对话的脉络（发生了什么、讨论了什么话题、结论是什么）以及出现的关键概念。\n")
+	} else {
+		prompt.WriteString("2. summary 用几句话概括这一段对话的内容，后续会与其他段落合并总结。\n")
+	}
+	prompt.WriteString("3. 必须基于实际提供的内容，严禁编造。")
+	if nested {
+		prompt.WriteString("\n4. 带缩进和 ↳ 的行是被转发进来的嵌套聊天记录，缩进越深层级越深，解读时注意区分它们与外层对话。")
+	}
+
+	return prompt.String(), images
+}
+
+// formatTranscriptEntry renders one numbered transcript line, indenting
+// messages from nested forwards and quoting the message being replied to.
+func formatTranscriptEntry(index int, msg ChatMessage, line string) string {
+	if msg.ReplyTo != nil {
+		line = fmt.Sprintf("（回复 %s「%s」）%s", msg.ReplyTo.SenderName, replySnippet(*msg.ReplyTo), line)
+	}
+	indent := ""
+	if msg.Depth > 0 {
+		indent = strings.Repeat("  ", msg.Depth) + "↳ "
+	}
+	return fmt.Sprintf("%s#%d %s：%s\n", indent, index+1, msg.SenderName, line)
+}
+
+func transcriptLine(msg ChatMessage) string {
+	content := strings.ReplaceAll(msg.Content, "\n", " / ")
+	if content == "" {
+		if len(msg.Images) > 0 {
+			return "[图片]"
+		}
+		return "[表情或无文字内容]"
+	}
+	return content
+}
+
+func (a *Analyzer) summarizeWindows(ctx context.Context, config *ChainRequestConfig, windowSummaries []string) (string, error) {
+	ctx, cancel := withRequestTimeout(ctx, config.TimeoutPerRequest)
+	defer cancel()
+
+	var prompt strings.Builder
+	prompt.WriteString("以下是一段群聊按时间顺序分段后的概要：\n\n")
+	for _, s := range windowSummaries {
+		prompt.WriteString(s)
+		prompt.WriteString("\n")
+	}
+	prompt.WriteString("\n请总结：\n")
+	prompt.WriteString("1. 这段对话的整体脉络（发生了什么、讨论了什么话题）\n")
+	prompt.WriteString("2. 出现的专业术语或关键概念\n")
+
+	result, err := a.agent.ChatWithOptions(ctx, config.ConversationID, prompt.String(), agent.ChatOptions{NoHistory: true})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Content), nil
+}
+
+func (a *Analyzer) collectWindows(config *ChainRequestConfig, windows []*transcriptAnalysis, summary string, failures []error) *ChainRequestResult {
+	byIndex := make(map[int]string)
+	for _, w := range windows {
+		if w == nil {
+			continue
+		}
+		for _, item := range w.Analyses {
+			if item.Index < 1 || item.Index > len(config.Messages) {
+				continue
+			}
+			byIndex[item.Index-1] = strings.TrimSpace(item.Explanation)
+		}
+	}
+
+	result := &ChainRequestResult{
+		MessageAnalyses: make([]MessageAnalysis, len(config.Messages)),
+		Summary:         summary,
+		Errors:          failures,
+	}
+
+	for i := range config.Messages {
+		if explanation, ok := byIndex[i]; ok && explanation != "" {
+			result.MessageAnalyses[i] = MessageAnalysis{Content: explanation}
+			result.SuccessCount++
+		} else {
+			result.MessageAnalyses[i] = MessageAnalysis{Content: "[分析失败] 未返回该条消息的解读"}
+			result.FailedCount++
+		}
+	}
+
+	a.logger.Info(fmt.Sprintf("批量分析完成，成功 %d/%d", result.SuccessCount, len(config.Messages)))
+	return result
+}
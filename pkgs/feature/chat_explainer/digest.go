@@ -0,0 +1,299 @@
+package chat_explainer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/agent"
+	"github.com/crayon/wrap-bot/pkgs/napcat"
+)
+
+const (
+	digestWindowSize = 300
+	maxDigestPoints  = 5
+)
+
+type DigestTopic struct {
+	Title        string   `json:"title"`
+	Summary      string   `json:"summary"`
+	Participants []string `json:"participants"`
+}
+
+type DigestLink struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	SharedBy    string `json:"shared_by"`
+}
+
+type DigestQuestion struct {
+	Asker    string `json:"asker"`
+	Question string `json:"question"`
+}
+
+type DigestParticipant struct {
+	Name   string   `json:"name"`
+	Points []string `json:"points"`
+}
+
+// Digest is a condensed "what did I miss" view of a stretch of group chat.
+type Digest struct {
+	Topics       []DigestTopic       `json:"topics"`
+	Links        []DigestLink        `json:"links"`
+	Unanswered   []DigestQuestion    `json:"unanswered"`
+	Participants []DigestParticipant `json:"participants"`
+	MessageCount int                 `json:"-"`
+}
+
+var digestSchema = agent.Schema{
+	Name:        "group_chat_digest",
+	Description: "Topics, shared links, unanswered questions and per-person contributions of a group chat",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"topics": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"title":        map[string]interface{}{"type": "string"},
+						"summary":      map[string]interface{}{"type": "string"},
+						"participants": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+					"required": []string{"title", "summary"},
+				},
+			},
+			"links": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"url":         map[string]interface{}{"type": "string"},
+						"description": map[string]interface{}{"type": "string"},
+						"shared_by":   map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"url", "description"},
+				},
+			},
+			"unanswered": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"asker":    map[string]interface{}{"type": "string"},
+						"question": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"question"},
+				},
+			},
+			"participants": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":   map[string]interface{}{"type": "string"},
+						"points": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+					"required": []string{"name", "points"},
+				},
+			},
+		},
+		"required": []string{"topics", "links", "unanswered", "participants"},
+	},
+}
+
+var linkPattern = regexp.MustCompile(`https?://[^\s\]\)」>，。]+`)
+
+// Digest summarises recorded group messages into topics, links, unanswered
+// questions and who said what. Long stretches are split into windows that
+// are digested concurrently and merged.
+func (a *Analyzer) Digest(ctx context.Context, messages []ChatMessage) (*Digest, error) {
+	if len(messages) == 0 {
+		return &Digest{}, nil
+	}
+
+	var windows [][]ChatMessage
+	for start := 0; start < len(messages); start += digestWindowSize {
+		windows = append(windows, messages[start:min(start+digestWindowSize, len(messages))])
+	}
+
+	a.logger.Info(fmt.Sprintf("生成群聊摘要，共 %d 条消息，%d 个窗口", len(messages), len(windows)))
+
+	results := make([]*Digest, len(windows))
+	errs := make([]error, len(windows))
+	sem := make(chan struct{}, max(1, a.options.Concurrency))
+	var wg sync.WaitGroup
+
+	for i, window := range windows {
+		wg.Add(1)
+		go func(i int, window []ChatMessage) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = a.digestWindow(ctx, window)
+		}(i, window)
+	}
+	wg.Wait()
+
+	digest := &Digest{MessageCount: len(messages)}
+	succeeded := 0
+	for i, result := range results {
+		if errs[i] != nil {
+			a.logger.Error(fmt.Sprintf("摘要窗口 %d 生成失败: %v", i+1, errs[i]))
+			continue
+		}
+		succeeded++
+		mergeDigest(digest, result)
+	}
+
+	if succeeded == 0 {
+		return nil, errs[0]
+	}
+	return digest, nil
+}
+
+func (a *Analyzer) digestWindow(ctx context.Context, messages []ChatMessage) (*Digest, error) {
+	ctx, cancel := withRequestTimeout(ctx, a.options.TimeoutPerRequest)
+	defer cancel()
+
+	var prompt strings.Builder
+	prompt.WriteString(renderTranscript(messages))
+
+	var links []string
+	for _, msg := range messages {
+		for _, link := range linkPattern.FindAllString(msg.Content, -1) {
+			links = append(links, fmt.Sprintf("%s（%s 分享）", link, msg.SenderName))
+		}
+	}
+	if len(links) > 0 {
+		prompt.WriteString("\n对话中出现的链接：\n")
+		prompt.WriteString(strings.Join(links, "\n"))
+		prompt.WriteString("\n")
+	}
+
+	prompt.WriteString(`
+请为没看群的人生成一份摘要：
+1. topics：按话题归纳讨论内容，每个话题给出标题、两三句话的概括和主要参与者
+2. links：对话中分享的有价值链接，说明链接内容或分享目的
+3. unanswered：有人提出但没有得到回答的问题
+4. participants：主要发言者各自说了什么（每人最多5条要点）
+必须基于实际内容，严禁编造；闲聊和表情可以忽略。`)
+
+	var digest Digest
+	err := a.agent.ChatStructured(ctx, fmt.Sprintf("digest_%d", messages[0].MessageID), prompt.String(), nil, digestSchema, &digest, agent.ChatOptions{NoHistory: true})
+	if err != nil {
+		return nil, err
+	}
+	return &digest, nil
+}
+
+func mergeDigest(dst, src *Digest) {
+	dst.Topics = append(dst.Topics, src.Topics...)
+	dst.Unanswered = append(dst.Unanswered, src.Unanswered...)
+
+	for _, link := range src.Links {
+		duplicate := false
+		for _, existing := range dst.Links {
+			if existing.URL == link.URL {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			dst.Links = append(dst.Links, link)
+		}
+	}
+
+	for _, p := range src.Participants {
+		merged := false
+		for i := range dst.Participants {
+			if dst.Participants[i].Name == p.Name {
+				dst.Participants[i].Points = append(dst.Participants[i].Points, p.Points...)
+				if len(dst.Participants[i].Points) > maxDigestPoints {
+					dst.Participants[i].Points = dst.Participants[i].Points[:maxDigestPoints]
+				}
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			dst.Participants = append(dst.Participants, p)
+		}
+	}
+}
+
+// BuildDigestNodes renders a digest as forward nodes, one per section.
+func BuildDigestNodes(digest *Digest, title string, selfID int64) []napcat.ForwardNode {
+	nodes := []napcat.ForwardNode{
+		napcat.NewMixedForwardNode("群聊摘要", selfID, napcat.NewTextSegment(fmt.Sprintf("%s\n共 %d 条消息", title, digest.MessageCount))),
+	}
+
+	section := func(name, text string) {
+		nodes = append(nodes, napcat.NewMixedForwardNode(name, selfID, napcat.NewTextSegment(text)))
+	}
+
+	if len(digest.Topics) > 0 {
+		var sb strings.Builder
+		for i, topic := range digest.Topics {
+			if i > 0 {
+				sb.WriteString("\n\n")
+			}
+			sb.WriteString(fmt.Sprintf("【%s】%s", topic.Title, topic.Summary))
+			if len(topic.Participants) > 0 {
+				sb.WriteString("\n参与：" + strings.Join(topic.Participants, "、"))
+			}
+		}
+		section("话题", sb.String())
+	}
+
+	if len(digest.Links) > 0 {
+		var sb strings.Builder
+		for i, link := range digest.Links {
+			if i > 0 {
+				sb.WriteString("\n\n")
+			}
+			sb.WriteString(link.Description + "\n" + link.URL)
+			if link.SharedBy != "" {
+				sb.WriteString("\n—— " + link.SharedBy)
+			}
+		}
+		section("链接", sb.String())
+	}
+
+	if len(digest.Unanswered) > 0 {
+		var sb strings.Builder
+		for i, q := range digest.Unanswered {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			if q.Asker != "" {
+				sb.WriteString(fmt.Sprintf("- %s：%s", q.Asker, q.Question))
+			} else {
+				sb.WriteString("- " + q.Question)
+			}
+		}
+		section("待回答的问题", sb.String())
+	}
+
+	if len(digest.Participants) > 0 {
+		var sb strings.Builder
+		for i, p := range digest.Participants {
+			if i > 0 {
+				sb.WriteString("\n\n")
+			}
+			sb.WriteString(fmt.Sprintf("【%s】", p.Name))
+			for _, point := range p.Points {
+				sb.WriteString("\n- " + point)
+			}
+		}
+		section("谁说了什么", sb.String())
+	}
+
+	if len(nodes) == 1 {
+		section("话题", "这段时间没有值得总结的讨论。")
+	}
+
+	return nodes
+}
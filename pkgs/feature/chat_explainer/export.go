@@ -0,0 +1,85 @@
+package chat_explainer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BuildMarkdownTranscript renders the forwarded chat as a markdown document
+// for archiving. Nested forwards become nested blockquotes and replies quote
+// the message they answer.
+func BuildMarkdownTranscript(chat *ForwardedChat, exportedAt time.Time) string {
+	flat := FlattenMessages(chat.Messages)
+
+	var sb strings.Builder
+	sb.WriteString("# 聊天记录\n\n")
+	if chat.SourceGroup != "" {
+		sb.WriteString(fmt.Sprintf("- 来源：%s\n", chat.SourceGroup))
+	}
+	if span := timeSpan(flat); span != "" {
+		sb.WriteString(fmt.Sprintf("- 时间：%s\n", span))
+	}
+	sb.WriteString(fmt.Sprintf("- 消息数：%d\n", len(flat)))
+	sb.WriteString(fmt.Sprintf("- 导出时间：%s\n\n---\n", exportedAt.Format("2006-01-02 15:04:05")))
+
+	for _, msg := range flat {
+		prefix := strings.Repeat("> ", msg.Depth)
+
+		header := fmt.Sprintf("**%s**", escapeMarkdown(msg.SenderName))
+		if msg.SenderID != 0 {
+			header += fmt.Sprintf(" (%d)", msg.SenderID)
+		}
+		if msg.Timestamp > 0 {
+			header += " · " + time.Unix(msg.Timestamp, 0).Format("2006-01-02 15:04:05")
+		}
+
+		sb.WriteString("\n" + prefix + header + "\n")
+		sb.WriteString(prefix + "\n")
+
+		if msg.ReplyTo != nil {
+			sb.WriteString(fmt.Sprintf("%s> 回复 %s：%s\n%s\n", prefix, escapeMarkdown(msg.ReplyTo.SenderName), escapeMarkdown(replySnippet(*msg.ReplyTo)), prefix))
+		}
+
+		if msg.Content != "" {
+			for _, line := range strings.Split(msg.Content, "\n") {
+				sb.WriteString(prefix + line + "  \n")
+			}
+		}
+
+		for i, image := range msg.Images {
+			if strings.HasPrefix(image, "http") {
+				sb.WriteString(fmt.Sprintf("%s![图片%d](%s)  \n", prefix, i+1, image))
+			} else {
+				sb.WriteString(fmt.Sprintf("%s[图片%d]  \n", prefix, i+1))
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func timeSpan(messages []ChatMessage) string {
+	var first, last int64
+	for _, msg := range messages {
+		if msg.Timestamp == 0 {
+			continue
+		}
+		if first == 0 || msg.Timestamp < first {
+			first = msg.Timestamp
+		}
+		if msg.Timestamp > last {
+			last = msg.Timestamp
+		}
+	}
+	if first == 0 {
+		return ""
+	}
+
+	const layout = "2006-01-02 15:04"
+	return fmt.Sprintf("%s ~ %s", time.Unix(first, 0).Format(layout), time.Unix(last, 0).Format(layout))
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("*", "\\*", "_", "\\_", "`", "\\`").Replace(s)
+}
@@ -0,0 +1,329 @@
+package chat_explainer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/agent"
+)
+
+type OutputMode string
+
+const (
+	OutputFull     OutputMode = "full"
+	OutputSummary  OutputMode = "summary"
+	OutputGlossary OutputMode = "glossary"
+	OutputTimeline OutputMode = "timeline"
+	OutputStance   OutputMode = "stance"
+	OutputExport   OutputMode = "export"
+)
+
+var outputModeAliases = map[string]OutputMode{
+	"full":     OutputFull,
+	"完整":       OutputFull,
+	"逐条":       OutputFull,
+	"summary":  OutputSummary,
+	"总结":       OutputSummary,
+	"摘要":       OutputSummary,
+	"glossary": OutputGlossary,
+	"术语":       OutputGlossary,
+	"名词":       OutputGlossary,
+	"timeline": OutputTimeline,
+	"时间线":      OutputTimeline,
+	"待办":       OutputTimeline,
+	"stance":   OutputStance,
+	"立场":       OutputStance,
+	"观点":       OutputStance,
+	"export":   OutputExport,
+	"导出":       OutputExport,
+}
+
+// ParseOutputMode maps a command argument, in English or Chinese, to an
+// output mode. An empty argument selects OutputFull.
+func ParseOutputMode(arg string) (OutputMode, bool) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	if arg == "" {
+		return OutputFull, true
+	}
+	mode, ok := outputModeAliases[arg]
+	return mode, ok
+}
+
+func OutputModeTitle(mode OutputMode) string {
+	switch mode {
+	case OutputSummary:
+		return "对话总结"
+	case OutputGlossary:
+		return "术语表"
+	case OutputTimeline:
+		return "时间线与待办"
+	case OutputStance:
+		return "各方观点"
+	case OutputExport:
+		return "聊天记录导出"
+	}
+	return "对话解读"
+}
+
+type glossaryResult struct {
+	Terms []struct {
+		Term        string `json:"term"`
+		Explanation string `json:"explanation"`
+		Context     string `json:"context"`
+	} `json:"terms"`
+}
+
+var glossarySchema = agent.Schema{
+	Name:        "chat_glossary",
+	Description: "Terms, jargon and abbreviations used in a group chat with explanations",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"term":        map[string]interface{}{"type": "string"},
+						"explanation": map[string]interface{}{"type": "string"},
+						"context":     map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"term", "explanation"},
+				},
+			},
+		},
+		"required": []string{"terms"},
+	},
+}
+
+type timelineResult struct {
+	Events []struct {
+		Index       int    `json:"index"`
+		Description string `json:"description"`
+	} `json:"events"`
+	Decisions   []string `json:"decisions"`
+	ActionItems []struct {
+		Owner string `json:"owner"`
+		Task  string `json:"task"`
+	} `json:"action_items"`
+}
+
+var timelineSchema = agent.Schema{
+	Name:        "chat_timeline",
+	Description: "Key events, decisions and action items of a group chat in order",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"events": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"index":       map[string]interface{}{"type": "integer"},
+						"description": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"index", "description"},
+				},
+			},
+			"decisions": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"action_items": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"owner": map[string]interface{}{"type": "string"},
+						"task":  map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"task"},
+				},
+			},
+		},
+		"required": []string{"events", "decisions", "action_items"},
+	},
+}
+
+type stanceResult struct {
+	Participants []struct {
+		Name      string   `json:"name"`
+		Stance    string   `json:"stance"`
+		KeyPoints []string `json:"key_points"`
+	} `json:"participants"`
+	Consensus    string `json:"consensus"`
+	Disagreement string `json:"disagreement"`
+}
+
+var stanceSchema = agent.Schema{
+	Name:        "chat_stances",
+	Description: "Each participant's position in a group chat discussion",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"participants": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":       map[string]interface{}{"type": "string"},
+						"stance":     map[string]interface{}{"type": "string"},
+						"key_points": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+					"required": []string{"name", "stance"},
+				},
+			},
+			"consensus":    map[string]interface{}{"type": "string"},
+			"disagreement": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"participants"},
+	},
+}
+
+// Explain produces a single condensed view of the conversation for the
+// summary, glossary, timeline and stance modes.
+func (a *Analyzer) Explain(ctx context.Context, messages []ChatMessage, mode OutputMode) (string, error) {
+	flat := FlattenMessages(messages)
+	if len(flat) == 0 {
+		return "", fmt.Errorf("no messages")
+	}
+
+	ctx, cancel := withRequestTimeout(ctx, a.options.TimeoutPerRequest)
+	defer cancel()
+
+	transcript := renderTranscript(flat)
+	conversationID := fmt.Sprintf("explain_%s_%d", mode, flat[0].MessageID)
+	a.logger.Info(fmt.Sprintf("以 %s 模式解读 %d 条消息", mode, len(flat)))
+
+	switch mode {
+	case OutputSummary:
+		prompt := transcript + "\n请总结这段对话：\n1. 整体脉络（发生了什么、讨论了什么话题）\n2. 得出的结论或仍未解决的问题\n必须基于实际内容，严禁编造，不要逐条复述。"
+		result, err := a.agent.ChatWithOptions(ctx, conversationID, prompt, agent.ChatOptions{NoHistory: true})
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(parseAnalysisResult(result.Content)), nil
+
+	case OutputGlossary:
+		var result glossaryResult
+		prompt := transcript + "\n列出对话中出现的专业术语、行话、缩写、梗和圈内黑话，逐个用通俗的话解释，context 简述它在对话中是怎么被用到的。常识性词语不要列出。"
+		if err := a.agent.ChatStructured(ctx, conversationID, prompt, nil, glossarySchema, &result, agent.ChatOptions{NoHistory: true}); err != nil {
+			return "", err
+		}
+		return renderGlossary(result), nil
+
+	case OutputTimeline:
+		var result timelineResult
+		prompt := transcript + "\n按时间顺序梳理对话中的关键事件（index 为对应消息序号），并列出达成的决定和待办事项（owner 为负责人，不明确时留空）。"
+		if err := a.agent.ChatStructured(ctx, conversationID, prompt, nil, timelineSchema, &result, agent.ChatOptions{NoHistory: true}); err != nil {
+			return "", err
+		}
+		return renderTimeline(result), nil
+
+	case OutputStance:
+		var result stanceResult
+		prompt := transcript + "\n归纳每位主要参与者在讨论中的立场和关键论点，并说明大家的共识与分歧。只写对话中实际表达过的观点。"
+		if err := a.agent.ChatStructured(ctx, conversationID, prompt, nil, stanceSchema, &result, agent.ChatOptions{NoHistory: true}); err != nil {
+			return "", err
+		}
+		return renderStances(result), nil
+	}
+
+	return "", fmt.Errorf("unsupported explain mode: %s", mode)
+}
+
+func renderTranscript(messages []ChatMessage) string {
+	var sb strings.Builder
+	sb.WriteString("你是群聊对话解读助手。以下是一段群聊记录，每行以 #序号 开头，带缩进和 ↳ 的行是嵌套转发的聊天记录：\n\n")
+	for i, msg := range messages {
+		line := transcriptLine(msg)
+		if len(msg.Images) > 0 && msg.Content != "" {
+			line += " [图片]"
+		}
+		sb.WriteString(formatTranscriptEntry(i, msg, line))
+	}
+	return sb.String()
+}
+
+func renderGlossary(result glossaryResult) string {
+	if len(result.Terms) == 0 {
+		return "这段对话中没有需要解释的术语。"
+	}
+
+	var sb strings.Builder
+	for i, term := range result.Terms {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("【%s】%s", term.Term, strings.TrimSpace(term.Explanation)))
+		if term.Context != "" {
+			sb.WriteString(fmt.Sprintf("\n对话中：%s", strings.TrimSpace(term.Context)))
+		}
+	}
+	return sb.String()
+}
+
+func renderTimeline(result timelineResult) string {
+	var sb strings.Builder
+
+	sb.WriteString("时间线：")
+	if len(result.Events) == 0 {
+		sb.WriteString("\n（无）")
+	}
+	for _, event := range result.Events {
+		if event.Index > 0 {
+			sb.WriteString(fmt.Sprintf("\n#%d %s", event.Index, event.Description))
+		} else {
+			sb.WriteString("\n- " + event.Description)
+		}
+	}
+
+	sb.WriteString("\n\n决定：")
+	if len(result.Decisions) == 0 {
+		sb.WriteString("\n（无）")
+	}
+	for _, decision := range result.Decisions {
+		sb.WriteString("\n- " + decision)
+	}
+
+	sb.WriteString("\n\n待办：")
+	if len(result.ActionItems) == 0 {
+		sb.WriteString("\n（无）")
+	}
+	for _, item := range result.ActionItems {
+		if item.Owner != "" {
+			sb.WriteString(fmt.Sprintf("\n- [%s] %s", item.Owner, item.Task))
+		} else {
+			sb.WriteString("\n- " + item.Task)
+		}
+	}
+
+	return sb.String()
+}
+
+func renderStances(result stanceResult) string {
+	var sb strings.Builder
+
+	for i, p := range result.Participants {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("【%s】%s", p.Name, p.Stance))
+		for _, point := range p.KeyPoints {
+			sb.WriteString("\n- " + point)
+		}
+	}
+
+	if result.Consensus != "" {
+		sb.WriteString("\n\n共识：" + result.Consensus)
+	}
+	if result.Disagreement != "" {
+		sb.WriteString("\n\n分歧：" + result.Disagreement)
+	}
+
+	if sb.Len() == 0 {
+		return "这段对话中没有明显的立场表达。"
+	}
+	return sb.String()
+}
@@ -9,10 +9,50 @@ import (
 	"github.com/crayon/wrap-bot/pkgs/napcat"
 )
 
-type Parser struct{}
+const (
+	defaultMaxDepth   = 3
+	maxParsedMessages = 300
+)
+
+// MessageFetcher loads messages that are referenced but not included in a
+// forward bundle: nested forwards without inline content and replies to
+// messages outside the bundle.
+type MessageFetcher interface {
+	GetMsgRaw(messageID int64) (map[string]interface{}, error)
+	GetForwardMsg(messageID string) (map[string]interface{}, error)
+}
+
+type Parser struct {
+	fetcher  MessageFetcher
+	maxDepth int
+}
 
 func NewParser() *Parser {
-	return &Parser{}
+	return &Parser{maxDepth: defaultMaxDepth}
+}
+
+func (p *Parser) SetFetcher(fetcher MessageFetcher) {
+	p.fetcher = fetcher
+}
+
+// WithFetcher returns a copy of the parser that fetches through fetcher, for
+// parsing the messages of one bot account.
+func (p *Parser) WithFetcher(fetcher MessageFetcher) *Parser {
+	clone := *p
+	clone.fetcher = fetcher
+	return &clone
+}
+
+// SetMaxDepth limits how many levels of nested forwards are expanded. Deeper
+// forwards are kept as a placeholder.
+func (p *Parser) SetMaxDepth(depth int) {
+	if depth > 0 {
+		p.maxDepth = depth
+	}
+}
+
+type parseState struct {
+	count int
 }
 
 func (p *Parser) ParseForwardMessage(data map[string]interface{}) (*ForwardedChat, error) {
@@ -26,44 +66,88 @@ func (p *Parser) ParseForwardMessage(data map[string]interface{}) (*ForwardedCha
 		chat.SourceGroup = groupName
 	}
 
+	state := &parseState{}
+	chat.Messages = p.parseMessages(messages, 0, state)
+	p.resolveReplies(chat.Messages)
+
+	return &chat, nil
+}
+
+// ParseMessage parses a single OneBot message, such as a message event or a
+// get_msg result. Its reply is recorded in ReplyID but not resolved.
+func (p *Parser) ParseMessage(data map[string]interface{}) ChatMessage {
+	return *p.parseSingleMessage(data, 0, &parseState{})
+}
+
+func (p *Parser) parseMessages(messages []interface{}, depth int, state *parseState) []ChatMessage {
 	parsedMessages := make([]ChatMessage, 0, len(messages))
 
 	for _, msg := range messages {
+		if state.count >= maxParsedMessages {
+			break
+		}
+
 		msgMap, ok := msg.(map[string]interface{})
 		if !ok {
 			continue
 		}
 
-		chatMsg := p.parseSingleMessage(msgMap)
+		state.count++
+		chatMsg := p.parseSingleMessage(msgMap, depth, state)
 		parsedMessages = append(parsedMessages, *chatMsg)
 	}
 
-	for i := range parsedMessages {
-		if replyID, ok := p.getReplyIDFromRaw(i, messages); ok {
-			parsedMessages[i].ReplyTo = p.FindMessageByID(parsedMessages, replyID)
-		}
-	}
-
-	chat.Messages = parsedMessages
-
-	return &chat, nil
+	return parsedMessages
 }
 
-func (p *Parser) getReplyIDFromRaw(index int, messages []interface{}) (int64, bool) {
-	if index >= len(messages) {
-		return 0, false
+// resolveReplies links every reply to the message it quotes, looking through
+// all nesting levels first and falling back to get_msg for messages that are
+// not part of the bundle.
+func (p *Parser) resolveReplies(messages []ChatMessage) {
+	byID := make(map[int64]*ChatMessage)
+	var all []*ChatMessage
+	var walk func(msgs []ChatMessage)
+	walk = func(msgs []ChatMessage) {
+		for i := range msgs {
+			if msgs[i].MessageID != 0 {
+				byID[msgs[i].MessageID] = &msgs[i]
+			}
+			all = append(all, &msgs[i])
+			walk(msgs[i].Children)
+		}
 	}
+	walk(messages)
 
-	msgMap, ok := messages[index].(map[string]interface{})
-	if !ok {
-		return 0, false
-	}
+	fetched := make(map[int64]*ChatMessage)
+	for _, msg := range all {
+		if msg.ReplyID == 0 {
+			continue
+		}
+		if target, ok := byID[msg.ReplyID]; ok {
+			msg.ReplyTo = target
+			continue
+		}
+		if target, ok := fetched[msg.ReplyID]; ok {
+			msg.ReplyTo = target
+			continue
+		}
+		if p.fetcher == nil {
+			continue
+		}
 
-	return p.GetReplyID(msgMap)
+		data, err := p.fetcher.GetMsgRaw(msg.ReplyID)
+		fetched[msg.ReplyID] = nil
+		if err != nil || data == nil {
+			continue
+		}
+		target := p.parseSingleMessage(data, msg.Depth, &parseState{count: maxParsedMessages})
+		fetched[msg.ReplyID] = target
+		msg.ReplyTo = target
+	}
 }
 
-func (p *Parser) parseSingleMessage(data map[string]interface{}) *ChatMessage {
-	msg := &ChatMessage{}
+func (p *Parser) parseSingleMessage(data map[string]interface{}, depth int, state *parseState) *ChatMessage {
+	msg := &ChatMessage{Depth: depth}
 
 	if sender, ok := data["sender"].(map[string]interface{}); ok {
 		if nickname, ok := sender["nickname"].(string); ok {
@@ -117,11 +201,16 @@ func (p *Parser) parseSingleMessage(data map[string]interface{}) *ChatMessage {
 		}
 	}
 
-	content := p.extractContent(data)
+	content := p.extractContent(data, depth, state)
 	msg.Content = content.Text
 	msg.Images = content.Images
+	msg.ImageFiles = content.ImageFiles
+	msg.Children = content.Children
+	msg.ReplyID = content.ReplyID
 
-	if len(msg.Images) > 0 && msg.Content != "" {
+	if len(msg.Children) > 0 {
+		msg.MessageType = "forward"
+	} else if len(msg.Images) > 0 && msg.Content != "" {
 		msg.MessageType = "mixed"
 	} else if len(msg.Images) > 0 {
 		msg.MessageType = "image"
@@ -133,47 +222,124 @@ func (p *Parser) parseSingleMessage(data map[string]interface{}) *ChatMessage {
 }
 
 type extractedContent struct {
-	Text   string
-	Images []string
+	Text       string
+	Images     []string
+	ImageFiles map[string]string
+	Children   []ChatMessage
+	ReplyID    int64
 }
 
-func (p *Parser) extractContent(data map[string]interface{}) extractedContent {
+func (p *Parser) extractContent(data map[string]interface{}, depth int, state *parseState) extractedContent {
 	var result extractedContent
 
-	if rawMsg, ok := data["raw_message"].(string); ok && rawMsg != "" {
-		result.Text = p.cleanCQCode(rawMsg)
-		result.Images = p.extractImageURLs(rawMsg)
+	message, ok := data["message"].([]interface{})
+	if !ok {
+		message, ok = data["content"].([]interface{})
+	}
+	if !ok {
+		if rawMsg, ok := data["raw_message"].(string); ok && rawMsg != "" {
+			result.Text = strings.TrimSpace(describeCQCodes(rawMsg))
+			result.Images = p.extractImageURLs(rawMsg)
+			result.ImageFiles = p.extractImageFiles(rawMsg)
+			result.ReplyID, _ = p.GetReplyID(data)
+		}
 		return result
 	}
 
-	if message, ok := data["message"].([]interface{}); ok {
-		for _, seg := range message {
-			segMap, ok := seg.(map[string]interface{})
-			if !ok {
-				continue
-			}
+	var text strings.Builder
+	for _, seg := range message {
+		segMap, ok := seg.(map[string]interface{})
+		if !ok {
+			continue
+		}
 
-			msgType, _ := segMap["type"].(string)
-			data, _ := segMap["data"].(map[string]interface{})
+		msgType, _ := segMap["type"].(string)
+		data, _ := segMap["data"].(map[string]interface{})
 
-			switch msgType {
-			case "text":
-				if text, ok := data["text"].(string); ok {
-					result.Text += text
-				}
-			case "image":
-				if url, ok := data["url"].(string); ok {
-					result.Images = append(result.Images, url)
-				} else if file, ok := data["file"].(string); ok {
-					result.Images = append(result.Images, file)
+		switch msgType {
+		case "text":
+			if t, ok := data["text"].(string); ok {
+				text.WriteString(t)
+			}
+		case "image":
+			url, file := stringField(data, "url"), stringField(data, "file")
+			if url != "" {
+				result.Images = append(result.Images, url)
+				if file != "" {
+					if result.ImageFiles == nil {
+						result.ImageFiles = make(map[string]string)
+					}
+					result.ImageFiles[url] = file
 				}
+			} else if file != "" {
+				result.Images = append(result.Images, file)
+			}
+			if summary := stringField(data, "summary"); summary != "" && summary != "[图片]" {
+				text.WriteString(fmt.Sprintf("[表情:%s]", strings.Trim(summary, "[]")))
 			}
+		case "reply":
+			if id, err := strconv.ParseInt(stringField(data, "id"), 10, 64); err == nil {
+				result.ReplyID = id
+			}
+		case "forward":
+			children, note := p.expandForward(data, depth, state)
+			result.Children = append(result.Children, children...)
+			text.WriteString(note)
+		default:
+			text.WriteString(describeSegment(msgType, data))
 		}
 	}
 
+	result.Text = strings.TrimSpace(text.String())
 	return result
 }
 
+// expandForward parses a nested forward segment, using its inline content
+// when NapCat provides it and get_forward_msg otherwise.
+func (p *Parser) expandForward(data map[string]interface{}, depth int, state *parseState) ([]ChatMessage, string) {
+	if depth+1 > p.maxDepth {
+		return nil, "[嵌套的合并转发，层级过深未展开]"
+	}
+
+	nested, ok := data["content"].([]interface{})
+	if !ok && p.fetcher != nil {
+		if id := stringField(data, "id"); id != "" {
+			if forward, err := p.fetcher.GetForwardMsg(id); err == nil {
+				nested, ok = forward["messages"].([]interface{})
+			}
+		}
+	}
+	if !ok || len(nested) == 0 {
+		return nil, "[合并转发，内容无法读取]"
+	}
+
+	children := p.parseMessages(nested, depth+1, state)
+	return children, fmt.Sprintf("[合并转发：%d条消息]", len(children))
+}
+
+// FlattenMessages returns the messages depth-first, each nested forward
+// followed by its contents. Depth on each message records the nesting.
+func FlattenMessages(messages []ChatMessage) []ChatMessage {
+	var flat []ChatMessage
+	for _, msg := range messages {
+		flat = append(flat, msg)
+		flat = append(flat, FlattenMessages(msg.Children)...)
+	}
+	return flat
+}
+
+// ImageFiles collects the QQ file id of every image URL in messages and
+// their nested forwards, for vision.WithImageFiles.
+func ImageFiles(messages []ChatMessage) map[string]string {
+	files := make(map[string]string)
+	for _, msg := range FlattenMessages(messages) {
+		for url, file := range msg.ImageFiles {
+			files[url] = file
+		}
+	}
+	return files
+}
+
 func (p *Parser) cleanCQCode(text string) string {
 	re := regexp.MustCompile(`\[CQ:[^\]]+\]`)
 	return re.ReplaceAllString(text, "")
@@ -192,6 +358,27 @@ func (p *Parser) extractImageURLs(text string) []string {
 	return urls
 }
 
+func (p *Parser) extractImageFiles(text string) map[string]string {
+	files := make(map[string]string)
+	re := regexp.MustCompile(`\[CQ:image,([^\]]*)\]`)
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		var url, file string
+		for _, param := range strings.Split(match[1], ",") {
+			key, value, _ := strings.Cut(param, "=")
+			switch key {
+			case "url":
+				url = strings.ReplaceAll(value, "&amp;", "&")
+			case "file":
+				file = value
+			}
+		}
+		if url != "" && file != "" {
+			files[url] = file
+		}
+	}
+	return files
+}
+
 func (p *Parser) IsForwardMessage(event map[string]interface{}) bool {
 	if message, ok := event["message"].([]interface{}); ok && len(message) > 0 {
 		if firstSeg, ok := message[0].(map[string]interface{}); ok {
@@ -307,7 +494,7 @@ func (p *Parser) FindMessageByID(messages []ChatMessage, id int64) *ChatMessage
 }
 
 func (p *Parser) IsMergeable(msg ChatMessage) bool {
-	return msg.MessageType == "text" && msg.ReplyTo == nil && len(msg.Images) == 0
+	return msg.MessageType == "text" && msg.ReplyTo == nil && len(msg.Images) == 0 && len(msg.Children) == 0
 }
 
 func (p *Parser) MergeConsecutiveMessages(messages []ChatMessage) MessageGroup {
@@ -328,8 +515,9 @@ func (p *Parser) MergeConsecutiveMessages(messages []ChatMessage) MessageGroup {
 					MessageIDs:  []int64{msg.MessageID},
 					Timestamps:  []int64{msg.Timestamp},
 					Contents:    []string{msg.Content},
+					Depth:       msg.Depth,
 				}
-			} else if current.SenderName == msg.SenderName {
+			} else if current.SenderName == msg.SenderName && current.Depth == msg.Depth {
 				current.Contents = append(current.Contents, msg.Content)
 				current.MessageIDs = append(current.MessageIDs, msg.MessageID)
 				current.Timestamps = append(current.Timestamps, msg.Timestamp)
@@ -344,6 +532,7 @@ func (p *Parser) MergeConsecutiveMessages(messages []ChatMessage) MessageGroup {
 					MessageIDs:  []int64{msg.MessageID},
 					Timestamps:  []int64{msg.Timestamp},
 					Contents:    []string{msg.Content},
+					Depth:       msg.Depth,
 				}
 			}
 		} else {
@@ -359,6 +548,9 @@ func (p *Parser) MergeConsecutiveMessages(messages []ChatMessage) MessageGroup {
 				MessageType: msg.MessageType,
 				MessageIDs:  []int64{msg.MessageID},
 				Timestamps:  []int64{msg.Timestamp},
+				ReplyTo:     msg.ReplyTo,
+				Depth:       msg.Depth,
+				Forward:     len(msg.Children) > 0,
 			})
 		}
 	}
@@ -375,78 +567,111 @@ func (p *Parser) MergeConsecutiveMessages(messages []ChatMessage) MessageGroup {
 }
 
 func BuildForwardNodesWithMerge(messages []ChatMessage, analyses []MessageAnalysis, summary string, selfID int64, mergedInfo *MessageGroup) []napcat.ForwardNode {
-	var nodes []napcat.ForwardNode
+	if mergedInfo == nil {
+		flat := FlattenMessages(messages)
+		mergedInfo = &MessageGroup{OriginalCount: len(flat), MergedCount: len(flat)}
+		for i, msg := range flat {
+			merged := MergedMessage{
+				SenderName:  msg.SenderName,
+				SenderID:    msg.SenderID,
+				Contents:    []string{msg.Content},
+				Images:      msg.Images,
+				MessageType: msg.MessageType,
+				MessageIDs:  []int64{msg.MessageID},
+				Timestamps:  []int64{msg.Timestamp},
+				ReplyTo:     msg.ReplyTo,
+				Depth:       msg.Depth,
+				Forward:     len(msg.Children) > 0,
+			}
+			if i < len(analyses) {
+				merged.AnalysisContent = analyses[i].Content
+			}
+			mergedInfo.MergedMessages = append(mergedInfo.MergedMessages, merged)
+		}
+	}
 
-	if mergedInfo != nil {
-		for _, merged := range mergedInfo.MergedMessages {
-			var segments []napcat.MessageSegment
+	pos := 0
+	nodes := buildNestedNodes(mergedInfo.MergedMessages, &pos, 0)
 
-			content := strings.Join(merged.Contents, "\n")
-			if content != "" {
-				segments = append(segments, napcat.NewTextSegment(content))
-			}
+	if summary != "" {
+		summaryNode := napcat.NewMixedForwardNode(
+			"整体总结",
+			selfID,
+			napcat.NewTextSegment(summary),
+		)
+		nodes = append(nodes, summaryNode)
+	}
 
-			for _, imageURL := range merged.Images {
-				segments = append(segments, napcat.NewImageSegment(imageURL))
-			}
+	return nodes
+}
 
-			analysisContent := merged.AnalysisContent
-			if len(merged.Contents) > 1 {
-				analysisContent = fmt.Sprintf("【连续消息 x%d】%s", len(merged.Contents), analysisContent)
-			}
+// buildNestedNodes consumes merged messages at the given depth starting at
+// pos. A nested forward becomes a node carrying its own explanation followed
+// by a nested forward node holding the messages it contained.
+func buildNestedNodes(messages []MergedMessage, pos *int, depth int) []napcat.ForwardNode {
+	var nodes []napcat.ForwardNode
 
-			if analysisContent != "" {
-				segments = append(segments, napcat.NewTextSegment("\n-------\n"+analysisContent))
-			}
+	for *pos < len(messages) && messages[*pos].Depth >= depth {
+		merged := messages[*pos]
+		*pos++
 
-			if len(segments) == 0 {
-				segments = append(segments, napcat.NewTextSegment("[无内容]"))
-			}
+		nodes = append(nodes, buildMergedNode(merged))
 
-			node := napcat.NewMixedForwardNode(
-				merged.SenderName,
-				merged.SenderID,
-				segments...,
-			)
-			nodes = append(nodes, node)
+		if merged.Forward {
+			children := buildNestedNodes(messages, pos, merged.Depth+1)
+			if len(children) > 0 {
+				nodes = append(nodes, napcat.NewCustomForwardNode(merged.SenderName, merged.SenderID, children))
+			}
 		}
-	} else {
-		for i, msg := range messages {
-			var segments []napcat.MessageSegment
+	}
 
-			if msg.Content != "" {
-				segments = append(segments, napcat.NewTextSegment(msg.Content))
-			}
+	return nodes
+}
 
-			for _, imageURL := range msg.Images {
-				segments = append(segments, napcat.NewImageSegment(imageURL))
-			}
+func buildMergedNode(merged MergedMessage) napcat.ForwardNode {
+	var segments []napcat.MessageSegment
 
-			if i < len(analyses) && analyses[i].Content != "" {
-				segments = append(segments, napcat.NewTextSegment("\n-------\n"+analyses[i].Content))
-			}
+	content := strings.Join(merged.Contents, "\n")
+	if merged.ReplyTo != nil {
+		content = fmt.Sprintf("[回复 %s：%s]\n%s", merged.ReplyTo.SenderName, replySnippet(*merged.ReplyTo), content)
+	}
+	if content != "" {
+		segments = append(segments, napcat.NewTextSegment(content))
+	}
 
-			if len(segments) == 0 {
-				segments = append(segments, napcat.NewTextSegment("[无内容]"))
-			}
+	for _, imageURL := range merged.Images {
+		segments = append(segments, napcat.NewImageSegment(imageURL))
+	}
 
-			node := napcat.NewMixedForwardNode(
-				msg.SenderName,
-				msg.SenderID,
-				segments...,
-			)
-			nodes = append(nodes, node)
-		}
+	analysisContent := merged.AnalysisContent
+	if len(merged.Contents) > 1 {
+		analysisContent = fmt.Sprintf("【连续消息 x%d】%s", len(merged.Contents), analysisContent)
 	}
 
-	if summary != "" {
-		summaryNode := napcat.NewMixedForwardNode(
-			"整体总结",
-			selfID,
-			napcat.NewTextSegment(summary),
-		)
-		nodes = append(nodes, summaryNode)
+	if analysisContent != "" {
+		segments = append(segments, napcat.NewTextSegment("\n-------\n"+analysisContent))
 	}
 
-	return nodes
+	if len(segments) == 0 {
+		segments = append(segments, napcat.NewTextSegment("[无内容]"))
+	}
+
+	return napcat.NewMixedForwardNode(
+		merged.SenderName,
+		merged.SenderID,
+		segments...,
+	)
+}
+
+// replySnippet is a one-line preview of a quoted message.
+func replySnippet(msg ChatMessage) string {
+	text := strings.ReplaceAll(BuildOriginalContent(msg), "\n", " ")
+	runes := []rune(text)
+	if len(runes) > 40 {
+		return string(runes[:40]) + "..."
+	}
+	if len(runes) == 0 {
+		return "[无内容]"
+	}
+	return text
 }
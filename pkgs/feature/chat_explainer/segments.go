@@ -0,0 +1,214 @@
+package chat_explainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var faceNames = map[int]string{
+	0: "惊讶", 1: "撇嘴", 2: "色", 3: "发呆", 4: "得意", 5: "流泪", 6: "害羞", 7: "闭嘴",
+	8: "睡", 9: "大哭", 10: "尴尬", 11: "发怒", 12: "调皮", 13: "呲牙", 14: "微笑", 15: "难过",
+	16: "酷", 18: "抓狂", 19: "吐", 20: "偷笑", 21: "可爱", 22: "白眼", 23: "傲慢", 24: "饥饿",
+	25: "困", 26: "惊恐", 27: "流汗", 28: "憨笑", 29: "悠闲", 30: "奋斗", 31: "咒骂", 32: "疑问",
+	33: "嘘", 34: "晕", 35: "折磨", 36: "衰", 37: "骷髅", 38: "敲打", 39: "再见", 41: "发抖",
+	42: "爱情", 43: "跳跳", 46: "猪头", 49: "拥抱", 53: "蛋糕", 59: "便便", 63: "玫瑰", 64: "凋谢",
+	66: "爱心", 67: "心碎", 74: "太阳", 75: "月亮", 76: "赞", 77: "踩", 78: "握手", 79: "胜利",
+	85: "飞吻", 89: "西瓜", 96: "冷汗", 97: "擦汗", 98: "抠鼻", 99: "鼓掌", 100: "糗大了", 101: "坏笑",
+	102: "左哼哼", 103: "右哼哼", 104: "哈欠", 105: "鄙视", 106: "委屈", 107: "快哭了", 108: "阴险", 109: "左亲亲",
+	110: "吓", 111: "可怜", 112: "菜刀", 114: "篮球", 116: "示爱", 118: "抱拳", 119: "勾引", 120: "拳头",
+	121: "差劲", 123: "NO", 124: "OK", 125: "转圈", 129: "挥手", 144: "喝彩", 146: "爆筋", 147: "棒棒糖",
+	169: "手枪", 171: "茶", 172: "眨眼睛", 173: "泪奔", 174: "无奈", 175: "卖萌", 176: "小纠结", 177: "喷血",
+	178: "斜眼笑", 179: "doge", 180: "惊喜", 181: "戳一戳", 182: "笑哭", 183: "我最美", 185: "羊驼", 187: "幽灵",
+	201: "点赞", 212: "托腮", 214: "啵啵", 219: "蹭一蹭", 222: "抱抱", 227: "拍手", 232: "佛系", 240: "喷脸",
+	243: "甩头", 246: "加油抱抱", 262: "脑阔疼", 263: "沧桑", 264: "捂脸", 265: "辣眼睛", 266: "哦哟", 267: "头秃",
+	268: "问号脸", 269: "暗中观察", 270: "emm", 271: "吃瓜", 272: "呵呵哒", 273: "我酸了", 277: "汪汪", 281: "无眼笑",
+	282: "敬礼", 284: "面无表情", 285: "摸鱼", 287: "哦", 289: "睁眼", 293: "摸锦鲤", 294: "期待", 297: "拜谢",
+	298: "元宝", 299: "牛啊", 305: "右亲亲", 306: "牛气冲天", 307: "喵喵", 314: "仔细分析", 315: "加油", 318: "崇拜",
+	319: "比心", 320: "庆祝", 322: "拒绝", 323: "嫌弃", 324: "吃糖", 326: "生气",
+}
+
+// describeSegment renders a non-text, non-image segment as a short bracketed
+// description so the model still sees that something was sent.
+func describeSegment(segType string, data map[string]interface{}) string {
+	switch segType {
+	case "face":
+		return describeFace(data)
+	case "mface":
+		if summary := stringField(data, "summary"); summary != "" {
+			return fmt.Sprintf("[表情:%s]", strings.Trim(summary, "[]"))
+		}
+		return "[表情]"
+	case "at":
+		if qq := stringField(data, "qq"); qq == "all" {
+			return "@全体成员"
+		}
+		if name := stringField(data, "name"); name != "" {
+			return "@" + name
+		}
+		return "@" + stringField(data, "qq")
+	case "file":
+		return describeFile(data)
+	case "json":
+		return describeCard(stringField(data, "data"))
+	case "xml":
+		return "[XML卡片]"
+	case "record":
+		return "[语音]"
+	case "video":
+		return "[视频]"
+	case "markdown":
+		if content := stringField(data, "content"); content != "" {
+			return content
+		}
+		return "[Markdown消息]"
+	case "poke":
+		return "[戳一戳]"
+	case "dice":
+		if result := stringField(data, "result"); result != "" {
+			return fmt.Sprintf("[骰子:%s点]", result)
+		}
+		return "[骰子]"
+	case "rps":
+		return "[猜拳]"
+	case "location":
+		if title := stringField(data, "title"); title != "" {
+			return fmt.Sprintf("[位置:%s]", title)
+		}
+		return "[位置]"
+	case "music":
+		if title := stringField(data, "title"); title != "" {
+			return fmt.Sprintf("[音乐分享:%s]", title)
+		}
+		return "[音乐分享]"
+	case "share":
+		if title := stringField(data, "title"); title != "" {
+			return fmt.Sprintf("[链接分享:%s]", title)
+		}
+		return "[链接分享]"
+	case "contact":
+		return "[名片推荐]"
+	}
+	return ""
+}
+
+func describeFace(data map[string]interface{}) string {
+	if raw, ok := data["raw"].(map[string]interface{}); ok {
+		if text := stringField(raw, "faceText"); text != "" {
+			return fmt.Sprintf("[表情:%s]", strings.TrimPrefix(text, "/"))
+		}
+	}
+	if id, err := strconv.Atoi(stringField(data, "id")); err == nil {
+		if name, ok := faceNames[id]; ok {
+			return fmt.Sprintf("[表情:%s]", name)
+		}
+	}
+	return "[表情]"
+}
+
+func describeFile(data map[string]interface{}) string {
+	name := stringField(data, "file")
+	if name == "" {
+		name = stringField(data, "name")
+	}
+	if name == "" {
+		return "[文件]"
+	}
+
+	size, _ := strconv.ParseInt(stringField(data, "file_size"), 10, 64)
+	if size > 0 {
+		return fmt.Sprintf("[文件:%s (%s)]", name, formatSize(size))
+	}
+	return fmt.Sprintf("[文件:%s]", name)
+}
+
+// describeCard extracts a human readable title from a QQ ark (json) card,
+// such as a mini-program share or a link preview.
+func describeCard(raw string) string {
+	var card struct {
+		Prompt string                            `json:"prompt"`
+		Meta   map[string]map[string]interface{} `json:"meta"`
+	}
+	if raw == "" || json.Unmarshal([]byte(raw), &card) != nil {
+		return "[卡片消息]"
+	}
+
+	var parts []string
+	for _, meta := range card.Meta {
+		for _, key := range []string{"title", "desc", "tag"} {
+			if v := stringField(meta, key); v != "" && !containsString(parts, v) {
+				parts = append(parts, v)
+			}
+		}
+		if len(parts) > 0 {
+			break
+		}
+	}
+
+	if len(parts) == 0 && card.Prompt != "" {
+		parts = append(parts, strings.Trim(card.Prompt, "[]"))
+	}
+	if len(parts) == 0 {
+		return "[卡片消息]"
+	}
+	return fmt.Sprintf("[卡片:%s]", strings.Join(parts, " - "))
+}
+
+var cqCodeRe = regexp.MustCompile(`\[CQ:([a-z]+)((?:,[^\]]*)?)\]`)
+
+// describeCQCodes is the raw_message counterpart of describeSegment: images
+// and replies are dropped, other CQ codes become bracketed descriptions.
+func describeCQCodes(text string) string {
+	return cqCodeRe.ReplaceAllStringFunc(text, func(code string) string {
+		match := cqCodeRe.FindStringSubmatch(code)
+		segType := match[1]
+		if segType == "image" || segType == "reply" {
+			return ""
+		}
+
+		data := make(map[string]interface{})
+		for _, kv := range strings.Split(strings.TrimPrefix(match[2], ","), ",") {
+			if key, value, ok := strings.Cut(kv, "="); ok {
+				data[key] = unescapeCQ(value)
+			}
+		}
+		return describeSegment(segType, data)
+	})
+}
+
+func unescapeCQ(s string) string {
+	return strings.NewReplacer("&#44;", ",", "&#91;", "[", "&#93;", "]", "&amp;", "&").Replace(s)
+}
+
+func stringField(data map[string]interface{}, key string) string {
+	switch v := data[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -10,9 +10,13 @@ type ChatMessage struct {
 	SenderID    int64
 	Content     string
 	Images      []string
+	ImageFiles  map[string]string
 	ReplyTo     *ChatMessage
+	ReplyID     int64
 	Timestamp   int64
 	MessageType string
+	Depth       int
+	Children    []ChatMessage
 }
 
 type ForwardedChat struct {
@@ -41,10 +45,42 @@ type MessageProcessingStatus struct {
 	Timestamp    time.Time
 }
 
+type AnalysisMode string
+
+const (
+	// ModeAuto analyses short chats in a single call and longer ones in
+	// concurrent windows.
+	ModeAuto     AnalysisMode = "auto"
+	ModeChain    AnalysisMode = "chain"
+	ModeSingle   AnalysisMode = "single"
+	ModeWindowed AnalysisMode = "windowed"
+)
+
+type AnalyzerOptions struct {
+	Mode              AnalysisMode
+	WindowSize        int
+	Concurrency       int
+	TimeoutPerRequest time.Duration
+}
+
+// ProgressFunc is called as messages are analysed with the number done so
+// far and the total.
+type ProgressFunc func(done, total int)
+
 type ChainRequestConfig struct {
 	ConversationID    string
 	Messages          []ChatMessage
 	TimeoutPerRequest time.Duration
+	Mode              AnalysisMode
+	WindowSize        int
+	Concurrency       int
+	OnProgress        ProgressFunc
+}
+
+func (c *ChainRequestConfig) reportProgress(done int) {
+	if c.OnProgress != nil {
+		c.OnProgress(done, len(c.Messages))
+	}
 }
 
 type ChainRequestResult struct {
@@ -65,6 +101,9 @@ type MergedMessage struct {
 	MessageIDs      []int64
 	Timestamps      []int64
 	AnalysisContent string
+	ReplyTo         *ChatMessage
+	Depth           int
+	Forward         bool
 }
 
 type MessageGroup struct {
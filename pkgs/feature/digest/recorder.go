@@ -0,0 +1,250 @@
+package digest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/feature/chat_explainer"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+// Recorder keeps recent messages of opted-in groups in memory for digests.
+// Messages older than the retention period or beyond the per-group limit are
+// dropped, and users who opt out are never recorded.
+type Recorder struct {
+	mu          sync.RWMutex
+	groups      map[int64][]chat_explainer.ChatMessage
+	enabled     map[int64]bool
+	retention   time.Duration
+	maxPerGroup int
+	optOut      map[int64]bool
+	optOutPath  string
+}
+
+type optOutFile struct {
+	Users []int64 `json:"users"`
+}
+
+func NewRecorder(groups []int64, retention time.Duration, maxPerGroup int, optOutPath string) *Recorder {
+	r := &Recorder{
+		groups:      make(map[int64][]chat_explainer.ChatMessage),
+		enabled:     make(map[int64]bool),
+		retention:   retention,
+		maxPerGroup: maxPerGroup,
+		optOut:      make(map[int64]bool),
+		optOutPath:  optOutPath,
+	}
+
+	for _, id := range groups {
+		r.enabled[id] = true
+	}
+
+	if err := r.loadOptOut(); err != nil && !os.IsNotExist(err) {
+		logger.Warn(fmt.Sprintf("[Digest] Failed to load opt-out list: %v", err))
+	}
+
+	return r
+}
+
+var defaultRecorder *Recorder
+
+func SetDefault(r *Recorder) {
+	defaultRecorder = r
+}
+
+// Default returns the recorder shared by the digest plugin and task, or nil
+// when digests are disabled.
+func Default() *Recorder {
+	return defaultRecorder
+}
+
+func (r *Recorder) Enabled(groupID int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.enabled[groupID]
+}
+
+func (r *Recorder) Groups() []int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]int64, 0, len(r.enabled))
+	for id := range r.enabled {
+		groups = append(groups, id)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return groups
+}
+
+func (r *Recorder) Add(groupID int64, msg chat_explainer.ChatMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.enabled[groupID] || r.optOut[msg.SenderID] {
+		return
+	}
+
+	msgs := append(r.groups[groupID], msg)
+	r.groups[groupID] = r.prune(msgs)
+}
+
+// Since returns the group's messages sent at or after since, oldest first,
+// with replies linked to the recorded messages they quote.
+func (r *Recorder) Since(groupID int64, since time.Time) []chat_explainer.ChatMessage {
+	r.mu.Lock()
+	r.groups[groupID] = r.prune(r.groups[groupID])
+	recorded := r.groups[groupID]
+
+	var result []chat_explainer.ChatMessage
+	for _, msg := range recorded {
+		if msg.Timestamp >= since.Unix() {
+			result = append(result, msg)
+		}
+	}
+	r.mu.Unlock()
+
+	byID := make(map[int64]*chat_explainer.ChatMessage, len(result))
+	for i := range result {
+		byID[result[i].MessageID] = &result[i]
+	}
+	for i := range result {
+		if target, ok := byID[result[i].ReplyID]; ok && result[i].ReplyID != 0 {
+			result[i].ReplyTo = target
+		}
+	}
+
+	return result
+}
+
+func (r *Recorder) IsOptedOut(userID int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.optOut[userID]
+}
+
+// SetOptOut records the user's choice. Opting out also forgets everything
+// already recorded from the user.
+func (r *Recorder) SetOptOut(userID int64, optOut bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if optOut {
+		r.optOut[userID] = true
+		for groupID, msgs := range r.groups {
+			kept := msgs[:0]
+			for _, msg := range msgs {
+				if msg.SenderID != userID {
+					kept = append(kept, msg)
+				}
+			}
+			r.groups[groupID] = kept
+		}
+	} else {
+		delete(r.optOut, userID)
+	}
+
+	return r.saveOptOut()
+}
+
+func (r *Recorder) prune(msgs []chat_explainer.ChatMessage) []chat_explainer.ChatMessage {
+	if r.retention > 0 {
+		cutoff := time.Now().Add(-r.retention).Unix()
+		start := 0
+		for start < len(msgs) && msgs[start].Timestamp < cutoff {
+			start++
+		}
+		msgs = msgs[start:]
+	}
+
+	if r.maxPerGroup > 0 && len(msgs) > r.maxPerGroup {
+		msgs = msgs[len(msgs)-r.maxPerGroup:]
+	}
+
+	return msgs
+}
+
+func (r *Recorder) loadOptOut() error {
+	if r.optOutPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.optOutPath)
+	if err != nil {
+		return err
+	}
+
+	var file optOutFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	for _, id := range file.Users {
+		r.optOut[id] = true
+	}
+	return nil
+}
+
+func (r *Recorder) saveOptOut() error {
+	if r.optOutPath == "" {
+		return nil
+	}
+
+	file := optOutFile{Users: make([]int64, 0, len(r.optOut))}
+	for id := range r.optOut {
+		file.Users = append(file.Users, id)
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i] < file.Users[j] })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.optOutPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.optOutPath, data, 0644)
+}
+
+// ParseWindow parses the time span argument of /summary, such as "2h",
+// "30m", "1d", "2小时" or a bare number of hours.
+func ParseWindow(arg string) (time.Duration, error) {
+	arg = strings.TrimSpace(strings.ToLower(arg))
+	if arg == "" {
+		return 0, fmt.Errorf("empty window")
+	}
+
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"小时", time.Hour},
+		{"分钟", time.Minute},
+		{"天", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"d", 24 * time.Hour},
+	}
+
+	unit := time.Hour
+	for _, u := range units {
+		if strings.HasSuffix(arg, u.suffix) {
+			arg = strings.TrimSuffix(arg, u.suffix)
+			unit = u.unit
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid window: %q", arg)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
@@ -0,0 +1,189 @@
+package document
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// EstimateTokens gives a rough token count: one token per CJK character and
+// roughly one per four characters of other scripts.
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// Chunk splits text into pieces of at most maxTokens, breaking on paragraph
+// and line boundaries where possible.
+func Chunk(text string, maxTokens int) []string {
+	if maxTokens <= 0 {
+		maxTokens = 800
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentTokens := 0
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+		currentTokens = 0
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		lineTokens := EstimateTokens(line)
+
+		if lineTokens > maxTokens {
+			flush()
+			for _, piece := range splitLongLine(line, maxTokens) {
+				chunks = append(chunks, piece)
+			}
+			continue
+		}
+
+		if currentTokens+lineTokens > maxTokens {
+			flush()
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		currentTokens += lineTokens + 1
+	}
+	flush()
+
+	return chunks
+}
+
+func splitLongLine(line string, maxTokens int) []string {
+	var pieces []string
+	runes := []rune(line)
+	start := 0
+	tokens := 0
+
+	for i, r := range runes {
+		if isCJK(r) {
+			tokens += 4
+		} else {
+			tokens++
+		}
+		if tokens >= maxTokens*4 {
+			pieces = append(pieces, string(runes[start:i+1]))
+			start = i + 1
+			tokens = 0
+		}
+	}
+	if start < len(runes) {
+		pieces = append(pieces, string(runes[start:]))
+	}
+	return pieces
+}
+
+// SelectChunks picks the chunks most relevant to query that fit in budget
+// tokens and returns them in document order.
+func SelectChunks(chunks []string, query string, budget int) []int {
+	total := 0
+	for _, c := range chunks {
+		total += EstimateTokens(c)
+	}
+
+	if total <= budget {
+		all := make([]int, len(chunks))
+		for i := range chunks {
+			all[i] = i
+		}
+		return all
+	}
+
+	terms := Terms(query)
+	type scored struct {
+		index int
+		score int
+	}
+
+	ranked := make([]scored, len(chunks))
+	for i, c := range chunks {
+		lower := strings.ToLower(c)
+		score := 0
+		for _, t := range terms {
+			score += strings.Count(lower, t)
+		}
+		ranked[i] = scored{index: i, score: score}
+	}
+
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if ranked[a].score != ranked[b].score {
+			return ranked[a].score > ranked[b].score
+		}
+		return ranked[a].index < ranked[b].index
+	})
+
+	var selected []int
+	used := 0
+	for _, r := range ranked {
+		tokens := EstimateTokens(chunks[r.index])
+		if used+tokens > budget {
+			continue
+		}
+		selected = append(selected, r.index)
+		used += tokens
+	}
+
+	sort.Ints(selected)
+	return selected
+}
+
+// Terms lowercases query and splits it into words, emitting overlapping
+// bigrams for CJK runs since they are not space separated.
+func Terms(query string) []string {
+	var terms []string
+	var word []rune
+	var cjkRun []rune
+
+	flushWord := func() {
+		if len(word) > 1 {
+			terms = append(terms, string(word))
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		if len(cjkRun) == 1 {
+			terms = append(terms, string(cjkRun))
+		}
+		for i := 0; i+1 < len(cjkRun); i++ {
+			terms = append(terms, string(cjkRun[i:i+2]))
+		}
+		cjkRun = cjkRun[:0]
+	}
+
+	for _, r := range strings.ToLower(query) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjkRun = append(cjkRun, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,108 @@
+package document
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+type Kind string
+
+const (
+	KindText     Kind = "text"
+	KindMarkdown Kind = "markdown"
+	KindCode     Kind = "code"
+	KindHTML     Kind = "html"
+	KindPDF      Kind = "pdf"
+)
+
+var codeExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".ts": true, ".tsx": true, ".jsx": true,
+	".java": true, ".kt": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true,
+	".cs": true, ".rs": true, ".rb": true, ".php": true, ".swift": true, ".lua": true,
+	".sh": true, ".bash": true, ".sql": true, ".vue": true, ".css": true, ".scss": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".xml": true, ".ini": true,
+}
+
+var textExtensions = map[string]bool{
+	".txt": true, ".log": true, ".csv": true, ".conf": true, ".env": true, "": true,
+}
+
+// DetectKind guesses the document kind from the file name, falling back to
+// content sniffing for unknown extensions.
+func DetectKind(name string, data []byte) (Kind, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	switch {
+	case ext == ".pdf":
+		return KindPDF, nil
+	case ext == ".md" || ext == ".markdown":
+		return KindMarkdown, nil
+	case ext == ".html" || ext == ".htm":
+		return KindHTML, nil
+	case codeExtensions[ext]:
+		return KindCode, nil
+	case textExtensions[ext]:
+		return KindText, nil
+	}
+
+	sniffed := http.DetectContentType(data)
+	switch {
+	case strings.HasPrefix(sniffed, "application/pdf"):
+		return KindPDF, nil
+	case strings.HasPrefix(sniffed, "text/html"):
+		return KindHTML, nil
+	case strings.HasPrefix(sniffed, "text/"):
+		return KindText, nil
+	}
+
+	return "", fmt.Errorf("unsupported file type: %s (%s)", name, sniffed)
+}
+
+func Extract(name string, data []byte) (string, Kind, error) {
+	kind, err := DetectKind(name, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	var text string
+	switch kind {
+	case KindPDF:
+		text, err = ExtractPDF(data)
+		if err != nil {
+			return "", kind, err
+		}
+	case KindHTML:
+		text = extractHTML(string(data))
+	default:
+		if !utf8.Valid(data) {
+			return "", kind, fmt.Errorf("file is not valid UTF-8 text")
+		}
+		text = string(data)
+		if kind == KindCode {
+			text = fmt.Sprintf("```%s\n%s\n```", strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), "."), text)
+		}
+	}
+
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return "", kind, fmt.Errorf("no text could be extracted from %s", name)
+	}
+
+	return text, kind, nil
+}
+
+func extractHTML(htmlStr string) string {
+	s := regexp.MustCompile(`(?is)<(script|style|noscript)[^>]*>.*?</(script|style|noscript)>`).ReplaceAllString(htmlStr, "")
+	s = regexp.MustCompile(`(?i)<br\s*/?>`).ReplaceAllString(s, "\n")
+	s = regexp.MustCompile(`(?i)</(p|div|li|h[1-6]|tr|section|article)>`).ReplaceAllString(s, "\n")
+	s = regexp.MustCompile(`(?s)<[^>]*>`).ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = regexp.MustCompile(`[ \t]+`).ReplaceAllString(s, " ")
+	s = regexp.MustCompile(`\n\s*\n+`).ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,440 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxInflatedBytes caps the decompressed size of all streams of one PDF, so
+// a small file of highly compressed streams cannot exhaust memory.
+const maxInflatedBytes = 64 * 1024 * 1024
+
+var (
+	streamStartRe = regexp.MustCompile(`stream\r?\n`)
+	bfCharRe      = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>`)
+	bfRangeRe     = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>`)
+)
+
+// ExtractPDF pulls the text out of a PDF without external dependencies. It
+// inflates every FlateDecode stream, collects ToUnicode CMaps and then walks
+// the text operators (Tj, TJ, ', ") of each content stream. Layout is only
+// approximated, which is enough to feed the text to a language model.
+func ExtractPDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data[:min(len(data), 1024)]), []byte("%PDF")) {
+		return "", fmt.Errorf("not a PDF file")
+	}
+
+	streams, err := readStreams(data)
+	if err != nil {
+		return "", err
+	}
+	if len(streams) == 0 {
+		return "", fmt.Errorf("no readable streams in PDF")
+	}
+
+	cmap := make(map[uint16]string)
+	for _, s := range streams {
+		if bytes.Contains(s, []byte("begincmap")) {
+			parseToUnicode(s, cmap)
+		}
+	}
+
+	var out strings.Builder
+	for _, s := range streams {
+		if bytes.Contains(s, []byte("begincmap")) || !bytes.Contains(s, []byte("BT")) {
+			continue
+		}
+		extractTextOperators(s, cmap, &out)
+	}
+
+	text := strings.TrimSpace(out.String())
+	if text == "" {
+		return "", fmt.Errorf("PDF contains no extractable text (scanned document?)")
+	}
+
+	return text, nil
+}
+
+func readStreams(data []byte) ([][]byte, error) {
+	var streams [][]byte
+	budget := int64(maxInflatedBytes)
+
+	offset := 0
+	for {
+		loc := streamStartRe.FindIndex(data[offset:])
+		if loc == nil {
+			break
+		}
+
+		start := offset + loc[1]
+		endRel := bytes.Index(data[start:], []byte("endstream"))
+		if endRel < 0 {
+			break
+		}
+		end := start + endRel
+
+		dictStart := bytes.LastIndex(data[offset:offset+loc[0]], []byte("obj"))
+		dict := data[offset+loc[0]-min(loc[0], 512) : offset+loc[0]]
+		if dictStart >= 0 {
+			dict = data[offset+dictStart : offset+loc[0]]
+		}
+
+		raw := bytes.TrimRight(data[start:end], "\r\n")
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			inflated, err := inflate(raw, budget)
+			if errors.Is(err, errInflateLimit) {
+				return nil, fmt.Errorf("PDF streams expand to more than %d bytes", maxInflatedBytes)
+			}
+			if err == nil {
+				budget -= int64(len(inflated))
+				streams = append(streams, inflated)
+			}
+		case !bytes.Contains(dict, []byte("/Filter")):
+			streams = append(streams, raw)
+		}
+
+		offset = end + len("endstream")
+	}
+
+	return streams, nil
+}
+
+var errInflateLimit = errors.New("inflated stream exceeds limit")
+
+// inflate decompresses a FlateDecode stream of at most limit bytes.
+func inflate(raw []byte, limit int64) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// Truncated streams are common; keep whatever decompressed cleanly.
+	out, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if int64(len(out)) > limit {
+		return nil, errInflateLimit
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return nil, err
+}
+
+func parseToUnicode(stream []byte, cmap map[uint16]string) {
+	text := string(stream)
+
+	for _, block := range sections(text, "beginbfchar", "endbfchar") {
+		for _, m := range bfCharRe.FindAllStringSubmatch(block, -1) {
+			code, err := strconv.ParseUint(m[1], 16, 16)
+			if err != nil {
+				continue
+			}
+			cmap[uint16(code)] = decodeUTF16Hex(m[2])
+		}
+	}
+
+	for _, block := range sections(text, "beginbfrange", "endbfrange") {
+		for _, m := range bfRangeRe.FindAllStringSubmatch(block, -1) {
+			lo, err1 := strconv.ParseUint(m[1], 16, 16)
+			hi, err2 := strconv.ParseUint(m[2], 16, 16)
+			dst, err3 := strconv.ParseUint(m[3], 16, 32)
+			if err1 != nil || err2 != nil || err3 != nil || hi < lo || hi-lo > 0xFFFF {
+				continue
+			}
+			for code := lo; code <= hi; code++ {
+				cmap[uint16(code)] = string(rune(dst + code - lo))
+			}
+		}
+	}
+}
+
+func sections(text, begin, end string) []string {
+	var result []string
+	for {
+		i := strings.Index(text, begin)
+		if i < 0 {
+			return result
+		}
+		text = text[i+len(begin):]
+		j := strings.Index(text, end)
+		if j < 0 {
+			return append(result, text)
+		}
+		result = append(result, text[:j])
+		text = text[j+len(end):]
+	}
+}
+
+func decodeUTF16Hex(h string) string {
+	b, err := hex.DecodeString(h)
+	if err != nil || len(b)%2 != 0 {
+		return ""
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+type pdfToken struct {
+	kind  byte // 's' string, 'h' hex string, 'n' number, 'o' operator, '[' and ']'
+	value string
+}
+
+func extractTextOperators(stream []byte, cmap map[uint16]string, out *strings.Builder) {
+	var operands []pdfToken
+	inText := false
+
+	for _, tok := range tokenize(stream) {
+		if tok.kind != 'o' {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch tok.value {
+		case "BT":
+			inText = true
+		case "ET":
+			inText = false
+			out.WriteString("\n")
+		case "Tj":
+			if inText && len(operands) > 0 {
+				out.WriteString(decodePDFString(operands[len(operands)-1], cmap))
+			}
+		case "'", "\"":
+			if inText && len(operands) > 0 {
+				out.WriteString("\n")
+				out.WriteString(decodePDFString(operands[len(operands)-1], cmap))
+			}
+		case "TJ":
+			if inText {
+				writeTJ(operands, cmap, out)
+			}
+		case "T*":
+			out.WriteString("\n")
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if y, err := strconv.ParseFloat(operands[len(operands)-1].value, 64); err == nil && y != 0 {
+					out.WriteString("\n")
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func writeTJ(operands []pdfToken, cmap map[uint16]string, out *strings.Builder) {
+	start := -1
+	for i := len(operands) - 1; i >= 0; i-- {
+		if operands[i].kind == '[' {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+
+	for _, tok := range operands[start+1:] {
+		switch tok.kind {
+		case 's', 'h':
+			out.WriteString(decodePDFString(tok, cmap))
+		case 'n':
+			if n, err := strconv.ParseFloat(tok.value, 64); err == nil && n < -200 {
+				out.WriteString(" ")
+			}
+		}
+	}
+}
+
+func decodePDFString(tok pdfToken, cmap map[uint16]string) string {
+	raw := []byte(tok.value)
+
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	if len(cmap) > 0 && tok.kind == 'h' && len(raw)%2 == 0 {
+		var sb strings.Builder
+		mapped := true
+		for i := 0; i+1 < len(raw); i += 2 {
+			s, ok := cmap[uint16(raw[i])<<8|uint16(raw[i+1])]
+			if !ok {
+				mapped = false
+				break
+			}
+			sb.WriteString(s)
+		}
+		if mapped {
+			return sb.String()
+		}
+	}
+
+	if len(cmap) > 0 {
+		var sb strings.Builder
+		mapped := true
+		for _, b := range raw {
+			s, ok := cmap[uint16(b)]
+			if !ok {
+				mapped = false
+				break
+			}
+			sb.WriteString(s)
+		}
+		if mapped {
+			return sb.String()
+		}
+	}
+
+	runes := make([]rune, 0, len(raw))
+	for _, b := range raw {
+		if b >= 0x20 || b == '\n' || b == '\t' {
+			runes = append(runes, rune(b))
+		}
+	}
+	return string(runes)
+}
+
+func tokenize(data []byte) []pdfToken {
+	var tokens []pdfToken
+	i := 0
+
+	for i < len(data) {
+		c := data[i]
+		switch {
+		case isPDFSpace(c):
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := readLiteralString(data, i+1)
+			tokens = append(tokens, pdfToken{kind: 's', value: s})
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			tokens = append(tokens, pdfToken{kind: 'o', value: "<<"})
+			i += 2
+		case c == '>' && i+1 < len(data) && data[i+1] == '>':
+			tokens = append(tokens, pdfToken{kind: 'o', value: ">>"})
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(data[i:], '>')
+			if end < 0 {
+				return tokens
+			}
+			h := strings.Map(func(r rune) rune {
+				if isPDFSpace(byte(r)) {
+					return -1
+				}
+				return r
+			}, string(data[i+1:i+end]))
+			if len(h)%2 == 1 {
+				h += "0"
+			}
+			b, _ := hex.DecodeString(h)
+			tokens = append(tokens, pdfToken{kind: 'h', value: string(b)})
+			i += end + 1
+		case c == '[' || c == ']':
+			tokens = append(tokens, pdfToken{kind: c})
+			i++
+		case c == '/':
+			j := i + 1
+			for j < len(data) && !isPDFSpace(data[j]) && !isPDFDelimiter(data[j]) {
+				j++
+			}
+			tokens = append(tokens, pdfToken{kind: 'n', value: string(data[i:j])})
+			i = j
+		case (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.':
+			j := i + 1
+			for j < len(data) && ((data[j] >= '0' && data[j] <= '9') || data[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, pdfToken{kind: 'n', value: string(data[i:j])})
+			i = j
+		default:
+			j := i + 1
+			for j < len(data) && !isPDFSpace(data[j]) && !isPDFDelimiter(data[j]) {
+				j++
+			}
+			tokens = append(tokens, pdfToken{kind: 'o', value: string(data[i:j])})
+			i = j
+		}
+	}
+
+	return tokens
+}
+
+func readLiteralString(data []byte, i int) (string, int) {
+	var sb strings.Builder
+	depth := 1
+
+	for i < len(data) {
+		c := data[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(data) {
+				return sb.String(), i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7' {
+						j++
+					}
+					v, _ := strconv.ParseUint(string(data[i:j]), 8, 8)
+					sb.WriteByte(byte(v))
+					i = j - 1
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+		case '(':
+			depth++
+			sb.WriteByte(c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return sb.String(), i + 1
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+		i++
+	}
+
+	return sb.String(), i
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
@@ -0,0 +1,159 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Document struct {
+	Name     string
+	Kind     Kind
+	Chunks   []string
+	Tokens   int
+	LoadedAt time.Time
+}
+
+// maxConversations caps how many conversations keep documents at once; the
+// one whose latest document is oldest is dropped first.
+const maxConversations = 500
+
+type Store struct {
+	mu        sync.RWMutex
+	docs      map[string][]*Document
+	ttl       time.Duration
+	maxDocs   int
+	chunkSize int
+	lastSweep time.Time
+}
+
+func NewStore(ttl time.Duration, maxDocs, chunkSize int) *Store {
+	return &Store{
+		docs:      make(map[string][]*Document),
+		ttl:       ttl,
+		maxDocs:   maxDocs,
+		chunkSize: chunkSize,
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *Store) Add(conversationID, name string, kind Kind, text string) *Document {
+	doc := &Document{
+		Name:     name,
+		Kind:     kind,
+		Chunks:   Chunk(text, s.chunkSize),
+		Tokens:   EstimateTokens(text),
+		LoadedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := s.liveDocs(conversationID)
+	filtered := docs[:0]
+	for _, d := range docs {
+		if d.Name != name {
+			filtered = append(filtered, d)
+		}
+	}
+	docs = append(filtered, doc)
+	if s.maxDocs > 0 && len(docs) > s.maxDocs {
+		docs = docs[len(docs)-s.maxDocs:]
+	}
+	s.docs[conversationID] = docs
+	s.prune(conversationID)
+
+	return doc
+}
+
+func (s *Store) Has(conversationID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.liveDocs(conversationID)) > 0
+}
+
+func (s *Store) Clear(conversationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.docs, conversationID)
+}
+
+// BuildContext renders the parts of the conversation's documents relevant to
+// query, spending at most budget tokens across all documents.
+func (s *Store) BuildContext(conversationID, query string, budget int) string {
+	s.mu.Lock()
+	docs := append([]*Document(nil), s.liveDocs(conversationID)...)
+	s.mu.Unlock()
+
+	if len(docs) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("用户在本次对话中提供了以下文件，回答时请以文件内容为依据，并在无法从文件中找到答案时说明。\n")
+
+	perDoc := budget / len(docs)
+	for _, doc := range docs {
+		selected := SelectChunks(doc.Chunks, query, perDoc)
+		sb.WriteString(fmt.Sprintf("\n【文件：%s】", doc.Name))
+		if len(selected) < len(doc.Chunks) {
+			sb.WriteString(fmt.Sprintf("（节选 %d/%d 段）", len(selected), len(doc.Chunks)))
+		}
+		sb.WriteString("\n")
+		for _, idx := range selected {
+			sb.WriteString(doc.Chunks[idx])
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
+
+func (s *Store) liveDocs(conversationID string) []*Document {
+	docs := s.docs[conversationID]
+	if s.ttl <= 0 || len(docs) == 0 {
+		return docs
+	}
+
+	live := docs[:0]
+	for _, d := range docs {
+		if time.Since(d.LoadedAt) < s.ttl {
+			live = append(live, d)
+		}
+	}
+
+	if len(live) == 0 {
+		delete(s.docs, conversationID)
+		return nil
+	}
+	s.docs[conversationID] = live
+	return live
+}
+
+// prune drops the expired documents of every conversation, at most once per
+// ttl, then the stalest conversations other than keep beyond
+// maxConversations. Callers must hold s.mu.
+func (s *Store) prune(keep string) {
+	if s.ttl > 0 && time.Since(s.lastSweep) >= s.ttl {
+		s.lastSweep = time.Now()
+		for id := range s.docs {
+			s.liveDocs(id)
+		}
+	}
+
+	for len(s.docs) > maxConversations {
+		var oldestID string
+		var oldest time.Time
+		for id, docs := range s.docs {
+			if id == keep {
+				continue
+			}
+			latest := docs[len(docs)-1].LoadedAt
+			if oldestID == "" || latest.Before(oldest) {
+				oldestID, oldest = id, latest
+			}
+		}
+		delete(s.docs, oldestID)
+	}
+}
@@ -0,0 +1,301 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+const maxHistory = 50
+
+var (
+	ErrTooManyJobs = errors.New("too many running jobs")
+	ErrJobNotFound = errors.New("job not found")
+	ErrNotOwner    = errors.New("job belongs to another user")
+)
+
+type Info struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	UserID     int64     `json:"user_id"`
+	GroupID    int64     `json:"group_id"`
+	Status     Status    `json:"status"`
+	Done       int       `json:"done"`
+	Total      int       `json:"total"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// Job is a long-running operation started on behalf of a user. Work should
+// run under Context so that cancellation through the manager reaches it.
+type Job struct {
+	manager *Manager
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu   sync.Mutex
+	info Info
+}
+
+func (j *Job) ID() string {
+	return j.info.ID
+}
+
+func (j *Job) Context() context.Context {
+	return j.ctx
+}
+
+func (j *Job) Cancelled() bool {
+	return errors.Is(j.ctx.Err(), context.Canceled)
+}
+
+func (j *Job) SetProgress(done, total int) {
+	j.mu.Lock()
+	j.info.Done = done
+	j.info.Total = total
+	j.info.UpdatedAt = time.Now()
+	j.mu.Unlock()
+
+	j.manager.notify()
+}
+
+func (j *Job) Progress() (done, total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info.Done, j.info.Total
+}
+
+func (j *Job) Info() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+// Finish records the outcome of the job and releases its slot. A job whose
+// context was cancelled is reported as cancelled regardless of err.
+func (j *Job) Finish(err error) {
+	j.mu.Lock()
+	if j.info.Status != StatusRunning {
+		j.mu.Unlock()
+		return
+	}
+	switch {
+	case j.Cancelled():
+		j.info.Status = StatusCancelled
+	case err != nil:
+		j.info.Status = StatusFailed
+		j.info.Error = err.Error()
+	default:
+		j.info.Status = StatusCompleted
+	}
+	j.info.FinishedAt = time.Now()
+	j.info.UpdatedAt = j.info.FinishedAt
+	info := j.info
+	j.mu.Unlock()
+
+	j.cancel()
+	j.manager.finish(info)
+}
+
+type Manager struct {
+	mu         sync.RWMutex
+	running    map[string]*Job
+	history    []Info
+	maxPerUser int
+	onChange   func([]Info)
+}
+
+func NewManager(maxPerUser int) *Manager {
+	return &Manager{
+		running:    make(map[string]*Job),
+		maxPerUser: maxPerUser,
+	}
+}
+
+var defaultManager = NewManager(1)
+
+func Default() *Manager {
+	return defaultManager
+}
+
+func (m *Manager) SetMaxPerUser(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxPerUser = n
+}
+
+// SetOnChange registers a callback invoked with the current job list whenever
+// a job starts, reports progress or finishes.
+func (m *Manager) SetOnChange(fn func([]Info)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+func (m *Manager) Start(parent context.Context, name string, userID, groupID int64) (*Job, error) {
+	m.mu.Lock()
+	if m.maxPerUser > 0 && m.countLocked(userID) >= m.maxPerUser {
+		m.mu.Unlock()
+		return nil, ErrTooManyJobs
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	now := time.Now()
+	job := &Job{
+		manager: m,
+		ctx:     ctx,
+		cancel:  cancel,
+		info: Info{
+			ID:        m.newIDLocked(),
+			Name:      name,
+			UserID:    userID,
+			GroupID:   groupID,
+			Status:    StatusRunning,
+			StartedAt: now,
+			UpdatedAt: now,
+		},
+	}
+	m.running[job.info.ID] = job
+	m.mu.Unlock()
+
+	m.notify()
+	return job, nil
+}
+
+// Cancel stops the job with the given ID. Unless force is set, only the user
+// who started the job may cancel it.
+func (m *Manager) Cancel(id string, userID int64, force bool) error {
+	m.mu.RLock()
+	job, ok := m.running[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+	if !force && job.info.UserID != userID {
+		return ErrNotOwner
+	}
+
+	job.cancel()
+	return nil
+}
+
+// CancelUser stops every running job of the user and returns how many were
+// cancelled.
+func (m *Manager) CancelUser(userID int64) int {
+	m.mu.RLock()
+	var jobs []*Job
+	for _, job := range m.running {
+		if job.info.UserID == userID {
+			jobs = append(jobs, job)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, job := range jobs {
+		job.cancel()
+	}
+	return len(jobs)
+}
+
+func (m *Manager) Running(userID int64) []Info {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Info
+	for _, job := range m.running {
+		if job.info.UserID == userID {
+			result = append(result, job.Info())
+		}
+	}
+	sortByStart(result)
+	return result
+}
+
+// List returns running jobs followed by recently finished ones.
+func (m *Manager) List() []Info {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.listLocked()
+}
+
+func (m *Manager) listLocked() []Info {
+	result := make([]Info, 0, len(m.running)+len(m.history))
+	for _, job := range m.running {
+		result = append(result, job.Info())
+	}
+	sortByStart(result)
+
+	for i := len(m.history) - 1; i >= 0; i-- {
+		result = append(result, m.history[i])
+	}
+	return result
+}
+
+func (m *Manager) finish(info Info) {
+	m.mu.Lock()
+	delete(m.running, info.ID)
+	m.history = append(m.history, info)
+	if len(m.history) > maxHistory {
+		m.history = m.history[len(m.history)-maxHistory:]
+	}
+	m.mu.Unlock()
+
+	m.notify()
+}
+
+func (m *Manager) notify() {
+	m.mu.RLock()
+	fn := m.onChange
+	var list []Info
+	if fn != nil {
+		list = m.listLocked()
+	}
+	m.mu.RUnlock()
+
+	if fn != nil {
+		fn(list)
+	}
+}
+
+func (m *Manager) countLocked(userID int64) int {
+	count := 0
+	for _, job := range m.running {
+		if job.info.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *Manager) newIDLocked() string {
+	buf := make([]byte, 3)
+	for {
+		rand.Read(buf)
+		id := hex.EncodeToString(buf)
+		if _, exists := m.running[id]; !exists {
+			return id
+		}
+	}
+}
+
+func sortByStart(infos []Info) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.Before(infos[j].StartedAt)
+	})
+}
@@ -0,0 +1,50 @@
+package outbound
+
+import (
+	"context"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+)
+
+// Client is a bot.APIClient whose message sends go through a dispatcher, so
+// replies to events keep the same spacing and retries as scheduled pushes.
+// Every other action goes straight to the wrapped client.
+type Client struct {
+	bot.APIClient
+	dispatcher *Dispatcher
+}
+
+// NewClient wraps api so its sends are queued on d.
+func NewClient(api bot.APIClient, d *Dispatcher) *Client {
+	if c, ok := api.(*Client); ok {
+		api = c.APIClient
+	}
+	return &Client{APIClient: api, dispatcher: d}
+}
+
+func (c *Client) SendGroupMessage(groupID int64, message interface{}) (int32, error) {
+	result := c.dispatcher.Send(context.Background(), GroupMessage(c.APIClient, groupID, message, "reply"))
+	return int32(result.Delivery.MessageID), result.Err
+}
+
+func (c *Client) SendPrivateMessage(userID int64, message interface{}) (int32, error) {
+	result := c.dispatcher.Send(context.Background(), PrivateMessage(c.APIClient, userID, message, "reply"))
+	return int32(result.Delivery.MessageID), result.Err
+}
+
+func (c *Client) SendGroupForwardMsg(groupID int64, nodes []bot.ForwardNode) (map[string]interface{}, error) {
+	result := c.dispatcher.Send(context.Background(), GroupForward(c.APIClient, groupID, nodes, "reply"))
+	return forwardResult(result)
+}
+
+func (c *Client) SendPrivateForwardMsg(userID int64, nodes []bot.ForwardNode) (map[string]interface{}, error) {
+	result := c.dispatcher.Send(context.Background(), PrivateForward(c.APIClient, userID, nodes, "reply"))
+	return forwardResult(result)
+}
+
+func forwardResult(result Result) (map[string]interface{}, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return map[string]interface{}{"message_id": float64(result.Delivery.MessageID)}, nil
+}
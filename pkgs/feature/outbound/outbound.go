@@ -0,0 +1,547 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+	"github.com/crayon/wrap-bot/pkgs/napcat"
+)
+
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusSending  Status = "sending"
+	StatusRetrying Status = "retrying"
+	StatusSent     Status = "sent"
+	StatusFailed   Status = "failed"
+)
+
+const (
+	maxHistory    = 100
+	maxRetryDelay = time.Minute
+)
+
+var (
+	ErrClosed         = errors.New("outbound dispatcher closed")
+	errInvalidMessage = errors.New("invalid outbound message")
+)
+
+// Sender is the part of napcat.Client the dispatcher sends through.
+type Sender interface {
+	SendGroupMessage(groupID int64, message interface{}) (int32, error)
+	SendPrivateMessage(userID int64, message interface{}) (int32, error)
+	SendGroupForwardMsg(groupID int64, nodes []napcat.ForwardNode) (map[string]interface{}, error)
+	SendPrivateForwardMsg(userID int64, nodes []napcat.ForwardNode) (map[string]interface{}, error)
+}
+
+// Message is a send waiting in the queue. Exactly one of Message and Forward
+// should be set; MessageType is "group" or "private".
+type Message struct {
+	Client      Sender
+	MessageType string
+	TargetID    int64
+	Message     interface{}
+	Forward     []napcat.ForwardNode
+	Source      string
+}
+
+func GroupForward(client Sender, groupID int64, nodes []napcat.ForwardNode, source string) Message {
+	return Message{Client: client, MessageType: "group", TargetID: groupID, Forward: nodes, Source: source}
+}
+
+func PrivateForward(client Sender, userID int64, nodes []napcat.ForwardNode, source string) Message {
+	return Message{Client: client, MessageType: "private", TargetID: userID, Forward: nodes, Source: source}
+}
+
+func GroupMessage(client Sender, groupID int64, message interface{}, source string) Message {
+	return Message{Client: client, MessageType: "group", TargetID: groupID, Message: message, Source: source}
+}
+
+func PrivateMessage(client Sender, userID int64, message interface{}, source string) Message {
+	return Message{Client: client, MessageType: "private", TargetID: userID, Message: message, Source: source}
+}
+
+// Delivery describes a queued or finished send for the admin UI.
+type Delivery struct {
+	ID          string    `json:"id"`
+	Source      string    `json:"source"`
+	MessageType string    `json:"message_type"`
+	TargetID    int64     `json:"target_id"`
+	Status      Status    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MessageID   int64     `json:"message_id,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Category    string    `json:"error_category,omitempty"`
+	QueuedAt    time.Time `json:"queued_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Result is reported to the caller once a send succeeded or gave up.
+type Result struct {
+	Delivery Delivery
+	Err      error
+}
+
+type Stats struct {
+	Queued  int `json:"queued"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Retried int `json:"retried"`
+}
+
+type Config struct {
+	// GlobalInterval is the minimum time between any two sends.
+	GlobalInterval time.Duration
+	// TargetInterval is the minimum time between two sends to the same
+	// group or user.
+	TargetInterval time.Duration
+	// MaxRetries is how often a temporary failure is retried.
+	MaxRetries int
+	// RetryDelay is the wait before the first retry; it doubles for every
+	// further attempt.
+	RetryDelay time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		GlobalInterval: time.Second,
+		TargetInterval: 3 * time.Second,
+		MaxRetries:     3,
+		RetryDelay:     2 * time.Second,
+	}
+}
+
+type target struct {
+	messageType string
+	id          int64
+}
+
+type item struct {
+	msg       Message
+	info      Delivery
+	seq       uint64
+	notBefore time.Time
+	result    chan Result
+}
+
+// Dispatcher sends messages one at a time in queue order, keeping the
+// configured gaps between sends to stay clear of QQ risk control. Sends to
+// one target keep their order, even across retries.
+type Dispatcher struct {
+	cfg Config
+
+	mu         sync.Mutex
+	queue      []*item
+	inFlight   *item
+	seq        uint64
+	lastSent   time.Time
+	lastTarget map[target]time.Time
+	history    []Delivery
+	stats      Stats
+	onChange   func([]Delivery)
+	closed     bool
+
+	wake      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewDispatcher(cfg Config) *Dispatcher {
+	d := &Dispatcher{
+		cfg:        cfg,
+		lastTarget: make(map[target]time.Time),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+var (
+	defaultMu         sync.Mutex
+	defaultDispatcher *Dispatcher
+)
+
+func SetDefault(d *Dispatcher) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultDispatcher = d
+}
+
+// Default returns the dispatcher set with SetDefault, creating one with
+// DefaultConfig on first use.
+func Default() *Dispatcher {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultDispatcher == nil {
+		defaultDispatcher = NewDispatcher(DefaultConfig())
+	}
+	return defaultDispatcher
+}
+
+// SetOnChange registers a callback invoked with the current delivery list
+// whenever a send is queued, attempted or finished.
+func (d *Dispatcher) SetOnChange(fn func([]Delivery)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onChange = fn
+}
+
+// Enqueue queues msg and returns a channel that receives its result.
+func (d *Dispatcher) Enqueue(msg Message) <-chan Result {
+	result := make(chan Result, 1)
+	now := time.Now()
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		result <- Result{Err: ErrClosed}
+		return result
+	}
+
+	d.seq++
+	it := &item{
+		msg:    msg,
+		seq:    d.seq,
+		result: result,
+		info: Delivery{
+			ID:          fmt.Sprintf("%d", d.seq),
+			Source:      msg.Source,
+			MessageType: msg.MessageType,
+			TargetID:    msg.TargetID,
+			Status:      StatusQueued,
+			QueuedAt:    now,
+			UpdatedAt:   now,
+		},
+	}
+	d.queue = append(d.queue, it)
+	d.stats.Queued = len(d.queue)
+	d.mu.Unlock()
+
+	d.signal()
+	d.notify()
+	return result
+}
+
+// Send queues msg and waits for its result. Cancelling ctx stops the wait;
+// the message stays queued.
+func (d *Dispatcher) Send(ctx context.Context, msg Message) Result {
+	select {
+	case result := <-d.Enqueue(msg):
+		return result
+	case <-ctx.Done():
+		return Result{Err: ctx.Err()}
+	}
+}
+
+// SendAll queues every message at once and waits for all results, returned
+// in the order of msgs.
+func (d *Dispatcher) SendAll(ctx context.Context, msgs []Message) []Result {
+	pending := make([]<-chan Result, len(msgs))
+	for i, msg := range msgs {
+		pending[i] = d.Enqueue(msg)
+	}
+
+	results := make([]Result, len(msgs))
+	for i, ch := range pending {
+		select {
+		case results[i] = <-ch:
+		case <-ctx.Done():
+			results[i] = Result{Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+// List returns queued sends followed by recently finished ones.
+func (d *Dispatcher) List() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.listLocked()
+}
+
+func (d *Dispatcher) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// Close stops the dispatcher and waits until it has, or until ctx is done.
+// A send already in progress is finished; messages still queued are dropped
+// and fail with ErrClosed rather than being flushed, as flushing them would
+// have to ignore the rate limits.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.closeOnce.Do(func() { close(d.done) })
+
+	select {
+	case <-d.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.stopped)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			d.drain()
+			return
+		default:
+		}
+
+		it, wait := d.next(time.Now())
+		if it != nil {
+			d.deliver(it)
+			continue
+		}
+
+		if wait <= 0 {
+			wait = time.Hour
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-d.wake:
+		case <-timer.C:
+		case <-d.done:
+			d.drain()
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// next removes and returns the first message that may be sent now. When
+// none may, it returns how long until one can, or zero if the queue is
+// empty.
+func (d *Dispatcher) next(now time.Time) (*item, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.queue) == 0 {
+		return nil, 0
+	}
+
+	globalReady := d.lastSent.Add(d.cfg.GlobalInterval)
+	if now.Before(globalReady) {
+		return nil, globalReady.Sub(now)
+	}
+
+	var wait time.Duration
+	blocked := make(map[target]bool)
+	for i, it := range d.queue {
+		t := target{it.msg.MessageType, it.msg.TargetID}
+		if blocked[t] {
+			continue
+		}
+
+		ready := d.lastTarget[t].Add(d.cfg.TargetInterval)
+		if it.notBefore.After(ready) {
+			ready = it.notBefore
+		}
+		if now.Before(ready) {
+			blocked[t] = true
+			if wait == 0 || ready.Sub(now) < wait {
+				wait = ready.Sub(now)
+			}
+			continue
+		}
+
+		d.queue = append(d.queue[:i], d.queue[i+1:]...)
+		d.stats.Queued = len(d.queue)
+		d.lastSent = now
+		d.lastTarget[t] = now
+		d.inFlight = it
+		return it, 0
+	}
+	return nil, wait
+}
+
+func (d *Dispatcher) deliver(it *item) {
+	d.update(it, func(info *Delivery) {
+		info.Status = StatusSending
+		info.Attempts++
+	})
+
+	messageID, err := send(it.msg)
+	if err == nil {
+		d.finish(it, StatusSent, messageID, nil)
+		return
+	}
+
+	if !errors.Is(err, errInvalidMessage) && napcat.Temporary(err) && it.info.Attempts <= d.cfg.MaxRetries {
+		delay := min(d.cfg.RetryDelay<<(it.info.Attempts-1), maxRetryDelay)
+		logger.Warn(fmt.Sprintf("[Outbound] Send to %s %d failed, retrying in %v (attempt %d/%d): %v",
+			it.msg.MessageType, it.msg.TargetID, delay, it.info.Attempts, d.cfg.MaxRetries+1, err))
+
+		d.mu.Lock()
+		it.notBefore = time.Now().Add(delay)
+		it.info.Status = StatusRetrying
+		it.info.Error = err.Error()
+		it.info.Category = string(napcat.CategoryOf(err))
+		it.info.UpdatedAt = time.Now()
+		d.inFlight = nil
+		d.requeueLocked(it)
+		d.stats.Retried++
+		d.mu.Unlock()
+
+		d.notify()
+		return
+	}
+
+	logger.Error(fmt.Sprintf("[Outbound] Send to %s %d failed: %v", it.msg.MessageType, it.msg.TargetID, err))
+	d.finish(it, StatusFailed, 0, err)
+}
+
+// requeueLocked puts a message being retried back at its original position
+// so later sends to the same target do not overtake it.
+func (d *Dispatcher) requeueLocked(it *item) {
+	i := 0
+	for i < len(d.queue) && d.queue[i].seq < it.seq {
+		i++
+	}
+	d.queue = append(d.queue, nil)
+	copy(d.queue[i+1:], d.queue[i:])
+	d.queue[i] = it
+	d.stats.Queued = len(d.queue)
+}
+
+func (d *Dispatcher) update(it *item, fn func(*Delivery)) {
+	d.mu.Lock()
+	fn(&it.info)
+	it.info.UpdatedAt = time.Now()
+	d.mu.Unlock()
+
+	d.notify()
+}
+
+func (d *Dispatcher) finish(it *item, status Status, messageID int64, err error) {
+	d.mu.Lock()
+	it.info.Status = status
+	it.info.MessageID = messageID
+	it.info.Error = ""
+	it.info.Category = ""
+	if err != nil {
+		it.info.Error = err.Error()
+		it.info.Category = string(napcat.CategoryOf(err))
+		d.stats.Failed++
+	} else {
+		d.stats.Sent++
+	}
+	it.info.UpdatedAt = time.Now()
+	info := it.info
+	if d.inFlight == it {
+		d.inFlight = nil
+	}
+
+	d.history = append(d.history, info)
+	if len(d.history) > maxHistory {
+		d.history = d.history[len(d.history)-maxHistory:]
+	}
+	d.mu.Unlock()
+
+	it.result <- Result{Delivery: info, Err: err}
+	d.notify()
+}
+
+func (d *Dispatcher) drain() {
+	d.mu.Lock()
+	queue := d.queue
+	d.queue = nil
+	d.closed = true
+	d.stats.Queued = 0
+	d.mu.Unlock()
+
+	for _, it := range queue {
+		d.finish(it, StatusFailed, 0, ErrClosed)
+	}
+}
+
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) listLocked() []Delivery {
+	result := make([]Delivery, 0, len(d.queue)+len(d.history)+1)
+	if d.inFlight != nil {
+		result = append(result, d.inFlight.info)
+	}
+	for _, it := range d.queue {
+		result = append(result, it.info)
+	}
+	for i := len(d.history) - 1; i >= 0; i-- {
+		result = append(result, d.history[i])
+	}
+	return result
+}
+
+func (d *Dispatcher) notify() {
+	d.mu.Lock()
+	fn := d.onChange
+	var list []Delivery
+	if fn != nil {
+		list = d.listLocked()
+	}
+	d.mu.Unlock()
+
+	if fn != nil {
+		fn(list)
+	}
+}
+
+func send(msg Message) (int64, error) {
+	if msg.Client == nil {
+		return 0, fmt.Errorf("%w: no client for %s %d", errInvalidMessage, msg.MessageType, msg.TargetID)
+	}
+	// A queued send through a dispatching client would wait on this very
+	// queue, so send through the client it wraps.
+	if c, ok := msg.Client.(*Client); ok {
+		msg.Client = c.APIClient
+	}
+
+	switch {
+	case msg.MessageType == "group" && msg.Forward != nil:
+		result, err := msg.Client.SendGroupForwardMsg(msg.TargetID, msg.Forward)
+		return resultMessageID(result), err
+	case msg.MessageType == "private" && msg.Forward != nil:
+		result, err := msg.Client.SendPrivateForwardMsg(msg.TargetID, msg.Forward)
+		return resultMessageID(result), err
+	case msg.MessageType == "group":
+		id, err := msg.Client.SendGroupMessage(msg.TargetID, msg.Message)
+		return int64(id), err
+	case msg.MessageType == "private":
+		id, err := msg.Client.SendPrivateMessage(msg.TargetID, msg.Message)
+		return int64(id), err
+	default:
+		return 0, fmt.Errorf("%w: unknown message type %q", errInvalidMessage, msg.MessageType)
+	}
+}
+
+func resultMessageID(result map[string]interface{}) int64 {
+	if id, ok := result["message_id"].(float64); ok {
+		return int64(id)
+	}
+	return 0
+}
@@ -0,0 +1,365 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+// Role is what a user may do. Roles are ordered: every role may do what the
+// roles below it may.
+type Role int
+
+const (
+	RoleBlocked Role = iota
+	RoleMember
+	RoleGroupAdmin
+	RoleGroupOwner
+	RoleBotAdmin
+	RoleSuperuser
+)
+
+var roleNames = map[Role]string{
+	RoleBlocked:    "blocked",
+	RoleMember:     "member",
+	RoleGroupAdmin: "group_admin",
+	RoleGroupOwner: "group_owner",
+	RoleBotAdmin:   "bot_admin",
+	RoleSuperuser:  "superuser",
+}
+
+var roleLabels = map[Role]string{
+	RoleBlocked:    "已屏蔽",
+	RoleMember:     "成员",
+	RoleGroupAdmin: "群管理员",
+	RoleGroupOwner: "群主",
+	RoleBotAdmin:   "机器人管理员",
+	RoleSuperuser:  "超级用户",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// Label is the role's name shown in chat.
+func (r Role) Label() string {
+	if label, ok := roleLabels[r]; ok {
+		return label
+	}
+	return r.String()
+}
+
+func ParseRole(name string) (Role, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for role, n := range roleNames {
+		if n == name {
+			return role, nil
+		}
+	}
+	return RoleBlocked, fmt.Errorf("unknown role %q", name)
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// Rules are the user roles and grants of one scope: everywhere, or one
+// group. A grant maps a plugin name or a command such as /summary to the
+// lowest role allowed to use it.
+type Rules struct {
+	Users  map[int64]Role  `json:"users,omitempty"`
+	Grants map[string]Role `json:"grants,omitempty"`
+}
+
+type store struct {
+	Rules
+	Groups map[int64]*Rules `json:"groups,omitempty"`
+}
+
+// Manager resolves roles and grants and enforces them as the engine's
+// authorizer. Superusers from the configuration cannot be demoted; bot
+// admins from the configuration can be overridden by roles set in chat.
+// Every change is saved to the permissions file.
+type Manager struct {
+	mu         sync.RWMutex
+	superusers map[int64]bool
+	admins     map[int64]bool
+	prefix     string
+	path       string
+	data       store
+}
+
+func NewManager(superusers, admins []int64, commandPrefix, path string) *Manager {
+	m := &Manager{
+		superusers: make(map[int64]bool),
+		admins:     make(map[int64]bool),
+		prefix:     commandPrefix,
+		path:       path,
+	}
+	for _, id := range superusers {
+		m.superusers[id] = true
+	}
+	for _, id := range admins {
+		m.admins[id] = true
+	}
+
+	if err := m.load(); err != nil {
+		logger.Warn(fmt.Sprintf("[Permission] Failed to load %s: %v", path, err))
+	}
+	return m
+}
+
+var (
+	defaultMu      sync.Mutex
+	defaultManager *Manager
+)
+
+func SetDefault(m *Manager) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultManager = m
+}
+
+// Default returns the manager set with SetDefault, or one without
+// superusers or saved rules when none was set.
+func Default() *Manager {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultManager == nil {
+		defaultManager = NewManager(nil, nil, "/", "")
+	}
+	return defaultManager
+}
+
+// RoleOf returns the role of userID in groupID, which is zero for private
+// chats. senderRole is the group role NapCat reports: owner, admin or
+// empty.
+func (m *Manager) RoleOf(userID, groupID int64, senderRole string) Role {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.superusers[userID] {
+		return RoleSuperuser
+	}
+	if group := m.data.Groups[groupID]; groupID != 0 && group != nil {
+		if role, ok := group.Users[userID]; ok {
+			return role
+		}
+	}
+	if role, ok := m.data.Users[userID]; ok {
+		return role
+	}
+	if m.admins[userID] {
+		return RoleBotAdmin
+	}
+
+	switch senderRole {
+	case "owner":
+		return RoleGroupOwner
+	case "admin":
+		return RoleGroupAdmin
+	default:
+		return RoleMember
+	}
+}
+
+// ContextRole returns the role of the event's sender in its chat.
+func (m *Manager) ContextRole(ctx *bot.Context) Role {
+	senderRole := ""
+	if ctx.Event.IsGroupMessage() && ctx.Event.Sender != nil {
+		senderRole = ctx.Event.Sender.Role
+	}
+	return m.RoleOf(ctx.Event.UserID, ctx.Event.GroupID, senderRole)
+}
+
+// Required returns the lowest role allowed to use the first of keys that
+// has a grant in groupID, that key, and whether a grant was found. Without
+// one, RoleMember is required for the last key.
+func (m *Manager) Required(groupID int64, keys ...string) (Role, string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scopes := []*Rules{&m.data.Rules}
+	if group := m.data.Groups[groupID]; groupID != 0 && group != nil {
+		scopes = []*Rules{group, &m.data.Rules}
+	}
+
+	for _, scope := range scopes {
+		for _, key := range keys {
+			if role, ok := scope.Grants[key]; ok && key != "" {
+				return role, key, true
+			}
+		}
+	}
+	return RoleMember, keys[len(keys)-1], false
+}
+
+// Authorize implements bot.Authorizer. A grant on the command in the
+// message wins over one on the plugin, and group grants win over global
+// ones. Plugins at bot.PriorityMonitor only record messages, so they are
+// only restricted by an explicit grant. Refused commands are answered
+// unless the sender is blocked.
+func (m *Manager) Authorize(ctx *bot.Context, plugin *bot.PluginInfo) bool {
+	command := m.command(ctx)
+	required, key, explicit := m.Required(ctx.Event.GroupID, command, plugin.Name)
+	if !explicit && plugin.Priority >= bot.PriorityMonitor {
+		return true
+	}
+
+	role := m.ContextRole(ctx)
+	if role >= required {
+		return true
+	}
+
+	if role > RoleBlocked && (plugin.Consume || key == command) {
+		ctx.ReplyText(fmt.Sprintf("没有权限使用 %s，需要%s及以上", key, required.Label()))
+	}
+	return false
+}
+
+// command returns the command word of the message, such as /summary, or
+// an empty string.
+func (m *Manager) command(ctx *bot.Context) string {
+	fields := strings.Fields(ctx.Event.GetText())
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], m.prefix) {
+		return ""
+	}
+	return fields[0]
+}
+
+// SetUserRole gives userID a role everywhere, or only in groupID when it
+// is not zero.
+func (m *Manager) SetUserRole(userID, groupID int64, role Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules := m.rulesLocked(groupID)
+	if rules.Users == nil {
+		rules.Users = make(map[int64]Role)
+	}
+	rules.Users[userID] = role
+	return m.saveLocked()
+}
+
+// ResetUserRole removes a role set with SetUserRole.
+func (m *Manager) ResetUserRole(userID, groupID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rulesLocked(groupID).Users, userID)
+	return m.saveLocked()
+}
+
+// SetGrant makes key usable from role upwards, everywhere or only in
+// groupID when it is not zero.
+func (m *Manager) SetGrant(key string, groupID int64, role Role) error {
+	if role == RoleBlocked {
+		return fmt.Errorf("a grant needs at least the %s role", RoleMember)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules := m.rulesLocked(groupID)
+	if rules.Grants == nil {
+		rules.Grants = make(map[string]Role)
+	}
+	rules.Grants[key] = role
+	return m.saveLocked()
+}
+
+// RevokeGrant removes a grant set with SetGrant.
+func (m *Manager) RevokeGrant(key string, groupID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rulesLocked(groupID).Grants, key)
+	return m.saveLocked()
+}
+
+// Rules returns a copy of the roles and grants set everywhere, or only in
+// groupID when it is not zero.
+func (m *Manager) Rules(groupID int64) Rules {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules := &m.data.Rules
+	if groupID != 0 {
+		rules = m.data.Groups[groupID]
+	}
+
+	result := Rules{Users: make(map[int64]Role), Grants: make(map[string]Role)}
+	if rules != nil {
+		for id, role := range rules.Users {
+			result.Users[id] = role
+		}
+		for key, role := range rules.Grants {
+			result.Grants[key] = role
+		}
+	}
+	return result
+}
+
+func (m *Manager) rulesLocked(groupID int64) *Rules {
+	if groupID == 0 {
+		return &m.data.Rules
+	}
+	if m.data.Groups == nil {
+		m.data.Groups = make(map[int64]*Rules)
+	}
+	rules, ok := m.data.Groups[groupID]
+	if !ok {
+		rules = &Rules{}
+		m.data.Groups[groupID] = rules
+	}
+	return rules
+}
+
+func (m *Manager) load() error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &m.data)
+}
+
+func (m *Manager) saveLocked() error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, data, 0644)
+}
@@ -1,16 +1,16 @@
 package rss
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/feature/outbound"
 	"github.com/crayon/wrap-bot/pkgs/logger"
 	"github.com/crayon/wrap-bot/pkgs/napcat"
-	"github.com/crayon/wrap-bot/pkgs/utils"
 )
 
 type AIAnalyzer interface {
@@ -49,8 +49,8 @@ func (rp *RssPush) SendRssPush() error {
 		return fmt.Errorf("no RSS data to send")
 	}
 
-	var sendErr error
-	feedIndex := 0
+	var msgs []outbound.Message
+	var msgFeeds []string
 	for feedID, rss := range feeds {
 		if rss.Channel == nil || len(rss.Channel.Items) == 0 {
 			logger.Warn(fmt.Sprintf("Skipping empty feed: %s", feedID))
@@ -76,39 +76,24 @@ func (rp *RssPush) SendRssPush() error {
 			}
 		}
 
-		for groupIndex, groupID := range rp.cfg.RssPushGroups {
-			err := utils.Retry(func() error {
-				_, err := napcatClient.SendGroupForwardMsg(groupID, forwardNodes)
-				return err
-			})
-			if err != nil {
-				logger.Error(fmt.Sprintf("Failed to send RSS %s to group %d: %v", feedID, groupID, err))
-				sendErr = err
-			}
-
-			if groupIndex < len(rp.cfg.RssPushGroups)-1 || len(rp.cfg.RssPushUsers) > 0 {
-				time.Sleep(2 * time.Second)
-			}
+		for _, groupID := range rp.cfg.RssPushGroups {
+			client := napcat.ClientForTarget(rp.cfg.PushAccounts, groupID, napcatClient)
+			msgs = append(msgs, outbound.GroupForward(client, groupID, forwardNodes, "rss"))
+			msgFeeds = append(msgFeeds, feedID)
 		}
 
-		for userIndex, userID := range rp.cfg.RssPushUsers {
-			err := utils.Retry(func() error {
-				_, err := napcatClient.SendPrivateForwardMsg(userID, forwardNodes)
-				return err
-			})
-			if err != nil {
-				logger.Error(fmt.Sprintf("Failed to send RSS %s to user %d: %v", feedID, userID, err))
-				sendErr = err
-			}
-
-			if userIndex < len(rp.cfg.RssPushUsers)-1 {
-				time.Sleep(2 * time.Second)
-			}
+		for _, userID := range rp.cfg.RssPushUsers {
+			client := napcat.ClientForTarget(rp.cfg.PushAccounts, userID, napcatClient)
+			msgs = append(msgs, outbound.PrivateForward(client, userID, forwardNodes, "rss"))
+			msgFeeds = append(msgFeeds, feedID)
 		}
+	}
 
-		feedIndex++
-		if feedIndex < len(feeds) {
-			time.Sleep(1 * time.Second)
+	var sendErr error
+	for i, result := range outbound.Default().SendAll(context.Background(), msgs) {
+		if result.Err != nil {
+			logger.Error(fmt.Sprintf("Failed to send RSS %s to %s %d: %v", msgFeeds[i], msgs[i].MessageType, msgs[i].TargetID, result.Err))
+			sendErr = result.Err
 		}
 	}
 
@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -44,8 +45,10 @@ func (s *Scheduler) Start() {
 	s.cron.Start()
 }
 
-func (s *Scheduler) Stop() {
-	s.cron.Stop()
+// Stop stops starting new runs. The returned context is done once the runs
+// already in progress have finished.
+func (s *Scheduler) Stop() context.Context {
+	return s.cron.Stop()
 }
 
 type TimeTaskBuilder struct {
@@ -1,9 +1,11 @@
 package tech_push
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/feature/outbound"
 	"github.com/crayon/wrap-bot/pkgs/feature/tech_push/handlers"
 	"github.com/crayon/wrap-bot/pkgs/logger"
 	"github.com/crayon/wrap-bot/pkgs/napcat"
@@ -54,20 +56,21 @@ func (tp *TechPush) SendTechPush(cachedData map[string][]byte) error {
 		return fmt.Errorf("no data to send")
 	}
 
-	var sendErr error
+	var msgs []outbound.Message
 	for _, groupID := range tp.cfg.TechPushGroups {
-		_, err := napcatClient.SendGroupForwardMsg(groupID, forwardNodes)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to send to group %d: %v", groupID, err))
-			sendErr = err
-		}
+		client := napcat.ClientForTarget(tp.cfg.PushAccounts, groupID, napcatClient)
+		msgs = append(msgs, outbound.GroupForward(client, groupID, forwardNodes, "tech_push"))
 	}
-
 	for _, userID := range tp.cfg.TechPushUsers {
-		_, err := napcatClient.SendPrivateForwardMsg(userID, forwardNodes)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to send to user %d: %v", userID, err))
-			sendErr = err
+		client := napcat.ClientForTarget(tp.cfg.PushAccounts, userID, napcatClient)
+		msgs = append(msgs, outbound.PrivateForward(client, userID, forwardNodes, "tech_push"))
+	}
+
+	var sendErr error
+	for i, result := range outbound.Default().SendAll(context.Background(), msgs) {
+		if result.Err != nil {
+			logger.Error(fmt.Sprintf("Failed to send to %s %d: %v", msgs[i].MessageType, msgs[i].TargetID, result.Err))
+			sendErr = result.Err
 		}
 	}
 
@@ -0,0 +1,84 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+// StopFunc stops one component. It should return once the component has
+// stopped or ctx is done, whichever comes first.
+type StopFunc func(ctx context.Context) error
+
+type component struct {
+	name string
+	stop StopFunc
+}
+
+// Manager stops components in the order they were added, all sharing one
+// deadline. A component that misses the deadline does not keep the ones
+// after it from being stopped; they get an expired context instead.
+type Manager struct {
+	mu         sync.Mutex
+	components []component
+	once       sync.Once
+	err        error
+}
+
+func New() *Manager {
+	return &Manager{}
+}
+
+func (m *Manager) Add(name string, stop StopFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Shutdown stops every component within timeout and returns their errors
+// joined. Only the first call has an effect.
+func (m *Manager) Shutdown(timeout time.Duration) error {
+	m.once.Do(func() {
+		m.err = m.shutdown(timeout)
+	})
+	return m.err
+}
+
+func (m *Manager) shutdown(timeout time.Duration) error {
+	m.mu.Lock()
+	components := make([]component, len(m.components))
+	copy(components, m.components)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for _, c := range components {
+		start := time.Now()
+		if err := c.stop(ctx); err != nil {
+			logger.Error(fmt.Sprintf("Failed to stop %s: %v", c.name, err))
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		logger.Info(fmt.Sprintf("Stopped %s in %s", c.name, time.Since(start).Round(time.Millisecond)))
+	}
+	return errors.Join(errs...)
+}
+
+// Wait adapts a context that is done when a component has stopped, such as
+// the one returned by cron's Stop, to a StopFunc.
+func Wait(stop func() context.Context) StopFunc {
+	return func(ctx context.Context) error {
+		select {
+		case <-stop().Done():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package napcat
+
+import "sync"
+
+var (
+	accountsMu     sync.RWMutex
+	accountClients = make(map[string]*Client)
+)
+
+// RegisterAccount makes an account's client available to scheduled pushes
+// and other code that does not handle an incoming event.
+func RegisterAccount(name string, client *Client) {
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	accountClients[name] = client
+}
+
+func AccountClient(name string) (*Client, bool) {
+	accountsMu.RLock()
+	defer accountsMu.RUnlock()
+	client, ok := accountClients[name]
+	return client, ok
+}
+
+// ClientForTarget returns the client of the account routes assigns to the
+// group or user targetID, or fallback when no route or account matches.
+func ClientForTarget(routes map[int64]string, targetID int64, fallback *Client) *Client {
+	if name, ok := routes[targetID]; ok {
+		if client, ok := AccountClient(name); ok {
+			return client
+		}
+	}
+	return fallback
+}
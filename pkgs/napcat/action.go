@@ -0,0 +1,131 @@
+package napcat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+const defaultActionTimeout = 30 * time.Second
+
+type actionRequest struct {
+	Action string      `json:"action"`
+	Params interface{} `json:"params"`
+	Echo   string      `json:"echo"`
+}
+
+type actionResult struct {
+	resp *Response
+	err  error
+}
+
+// actionCaller correlates OneBot actions sent over a WebSocket with their
+// responses through the echo field.
+type actionCaller struct {
+	pending   map[string]chan actionResult
+	pendingMu sync.Mutex
+	echoSeq   atomic.Uint64
+	timeout   time.Duration
+}
+
+func newActionCaller() *actionCaller {
+	return &actionCaller{
+		pending: make(map[string]chan actionResult),
+		timeout: defaultActionTimeout,
+	}
+}
+
+func (a *actionCaller) setTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		a.timeout = timeout
+	}
+}
+
+func (a *actionCaller) call(action string, params interface{}, done <-chan struct{}, send func(actionRequest) error) (*Response, error) {
+	echo := strconv.FormatUint(a.echoSeq.Add(1), 10)
+	ch := make(chan actionResult, 1)
+
+	a.pendingMu.Lock()
+	a.pending[echo] = ch
+	a.pendingMu.Unlock()
+
+	defer func() {
+		a.pendingMu.Lock()
+		delete(a.pending, echo)
+		a.pendingMu.Unlock()
+	}()
+
+	if err := send(actionRequest{Action: action, Params: params, Echo: echo}); err != nil {
+		return nil, newTransportError(action, CategoryDisconnected, fmt.Errorf("failed to send action %s: %w", action, err))
+	}
+
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-ch:
+		if result.err != nil {
+			return nil, newTransportError(action, CategoryDisconnected, result.err)
+		}
+		if result.resp.RetCode != 0 {
+			return result.resp, newAPIError(action, result.resp)
+		}
+		return result.resp, nil
+	case <-timer.C:
+		return nil, newTransportError(action, CategoryTimeout, fmt.Errorf("action %s timed out after %v", action, a.timeout))
+	case <-done:
+		return nil, newTransportError(action, CategoryDisconnected, fmt.Errorf("websocket closed"))
+	}
+}
+
+// resolve delivers an action response to its caller. It reports false when
+// the message is not a response, meaning it is an event.
+func (a *actionCaller) resolve(message []byte) bool {
+	var envelope struct {
+		Echo json.RawMessage `json:"echo"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil || len(envelope.Echo) == 0 || string(envelope.Echo) == "null" {
+		return false
+	}
+
+	var echo string
+	if err := json.Unmarshal(envelope.Echo, &echo); err != nil {
+		echo = string(envelope.Echo)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(message, &resp); err != nil {
+		logger.Error(fmt.Sprintf("Failed to unmarshal action response: %v", err))
+		return true
+	}
+
+	a.pendingMu.Lock()
+	ch, ok := a.pending[echo]
+	a.pendingMu.Unlock()
+
+	if ok {
+		select {
+		case ch <- actionResult{resp: &resp}:
+		default:
+		}
+	}
+	return true
+}
+
+func (a *actionCaller) failPending(err error) {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	for echo, ch := range a.pending {
+		select {
+		case ch <- actionResult{err: err}:
+		default:
+		}
+		delete(a.pending, echo)
+	}
+}
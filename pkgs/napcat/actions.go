@@ -0,0 +1,115 @@
+package napcat
+
+import (
+	"encoding/json"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+)
+
+func (c *Client) SetFriendAddRequest(flag string, approve bool, remark string) error {
+	payload := map[string]interface{}{
+		"flag":    flag,
+		"approve": approve,
+	}
+	if remark != "" {
+		payload["remark"] = remark
+	}
+
+	_, err := c.post("/set_friend_add_request", payload)
+	return err
+}
+
+func (c *Client) GetStrangerInfo(userID int64, noCache bool) (*bot.StrangerInfo, error) {
+	payload := map[string]interface{}{
+		"user_id":  userID,
+		"no_cache": noCache,
+	}
+
+	resp, err := c.post("/get_stranger_info", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var info bot.StrangerInfo
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (c *Client) SendLike(userID int64, times int) error {
+	payload := map[string]interface{}{
+		"user_id": userID,
+		"times":   times,
+	}
+
+	_, err := c.post("/send_like", payload)
+	return err
+}
+
+// SetMsgEmojiLike adds or removes an emoji reaction on a message. emojiID is
+// a QQ face ID such as "76".
+func (c *Client) SetMsgEmojiLike(messageID int64, emojiID string, set bool) error {
+	payload := map[string]interface{}{
+		"message_id": messageID,
+		"emoji_id":   emojiID,
+		"set":        set,
+	}
+
+	_, err := c.post("/set_msg_emoji_like", payload)
+	return err
+}
+
+func (c *Client) MarkMsgAsRead(messageID int64) error {
+	payload := map[string]interface{}{
+		"message_id": messageID,
+	}
+
+	_, err := c.post("/mark_msg_as_read", payload)
+	return err
+}
+
+func (c *Client) CanSendImage() (bool, error) {
+	resp, err := c.get("/can_send_image")
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Yes bool `json:"yes"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return false, err
+	}
+
+	return result.Yes, nil
+}
+
+func (c *Client) GetStatus() (*bot.OneBotStatus, error) {
+	resp, err := c.get("/get_status")
+	if err != nil {
+		return nil, err
+	}
+
+	var status bot.OneBotStatus
+	if err := json.Unmarshal(resp.Data, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (c *Client) GetVersionInfo() (*bot.VersionInfo, error) {
+	resp, err := c.get("/get_version_info")
+	if err != nil {
+		return nil, err
+	}
+
+	var info bot.VersionInfo
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
@@ -6,13 +6,32 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
 )
 
 type Client struct {
 	baseURL    string
 	token      string
 	httpClient *http.Client
+	transport  Transport
+}
+
+// Transport sends a OneBot action by name and returns its response. Clients
+// without a transport post actions to the HTTP API.
+type Transport interface {
+	Call(action string, params interface{}) (*Response, error)
+}
+
+var defaultTransport Transport
+
+// SetDefaultTransport routes the actions of every Client without its own
+// transport through t, so plugins that create clients with NewClient share
+// a single WebSocket connection. Pass nil to go back to HTTP.
+func SetDefaultTransport(t Transport) {
+	defaultTransport = t
 }
 
 type Response struct {
@@ -33,7 +52,26 @@ func NewClient(baseURL, token string) *Client {
 	}
 }
 
+// NewHTTPClient returns a client that always posts actions to baseURL, even
+// when a default transport is set. Extra accounts use it so their actions
+// never go out through the default account's connection.
+func NewHTTPClient(baseURL, token string) *Client {
+	c := NewClient(baseURL, token)
+	c.transport = httpTransport{client: c}
+	return c
+}
+
+type httpTransport struct {
+	client *Client
+}
+
+func (t httpTransport) Call(action string, params interface{}) (*Response, error) {
+	return t.client.doRequest("/"+action, http.MethodPost, params)
+}
+
 func (c *Client) doRequest(endpoint string, method string, payload interface{}) (*Response, error) {
+	action := strings.TrimPrefix(endpoint, "/")
+
 	var body io.Reader
 	if payload != nil {
 		data, err := json.Marshal(payload)
@@ -56,7 +94,7 @@ func (c *Client) doRequest(endpoint string, method string, payload interface{})
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to do request: %w", err)
+		return nil, networkError(action, err)
 	}
 	defer resp.Body.Close()
 
@@ -65,26 +103,46 @@ func (c *Client) doRequest(endpoint string, method string, payload interface{})
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return nil, newTransportError(action, CategoryRateLimited, fmt.Errorf("HTTP %d: %s", resp.StatusCode, respBody))
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, newTransportError(action, CategoryUnauthorized, fmt.Errorf("HTTP %d: %s", resp.StatusCode, respBody))
+	}
+
 	var apiResp Response
 	if err := json.Unmarshal(respBody, &apiResp); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if apiResp.RetCode != 0 {
-		return &apiResp, fmt.Errorf("API error: %s (code: %d)", apiResp.Message, apiResp.RetCode)
+		return &apiResp, newAPIError(action, &apiResp)
 	}
 
 	return &apiResp, nil
 }
 
 func (c *Client) post(endpoint string, payload interface{}) (*Response, error) {
+	if t := c.actionTransport(); t != nil {
+		return t.Call(strings.TrimPrefix(endpoint, "/"), payload)
+	}
 	return c.doRequest(endpoint, http.MethodPost, payload)
 }
 
 func (c *Client) get(endpoint string) (*Response, error) {
+	if t := c.actionTransport(); t != nil {
+		return t.Call(strings.TrimPrefix(endpoint, "/"), map[string]interface{}{})
+	}
 	return c.doRequest(endpoint, http.MethodGet, nil)
 }
 
+func (c *Client) actionTransport() Transport {
+	if c.transport != nil {
+		return c.transport
+	}
+	return defaultTransport
+}
+
 type LoginInfo struct {
 	UserID   int64  `json:"user_id"`
 	Nickname string `json:"nickname"`
@@ -103,3 +161,5 @@ func (c *Client) GetLoginInfo() (*LoginInfo, error) {
 
 	return &info, nil
 }
+
+var _ bot.APIClient = (*Client)(nil)
@@ -0,0 +1,219 @@
+package napcat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Category groups NapCat failures by what the caller can do about them.
+type Category string
+
+const (
+	CategoryUnknown        Category = "unknown"
+	CategoryBadRequest     Category = "bad_request"
+	CategoryUnauthorized   Category = "unauthorized"
+	CategoryPermission     Category = "permission_denied"
+	CategoryNotFound       Category = "not_found"
+	CategoryMuted          Category = "muted"
+	CategoryMessageTooLong Category = "message_too_long"
+	CategoryRateLimited    Category = "rate_limited"
+	CategoryNotFriend      Category = "not_friend"
+	CategoryTimeout        Category = "timeout"
+	CategoryDisconnected   Category = "disconnected"
+	CategoryNetwork        Category = "network"
+)
+
+// Sentinel errors for use with errors.Is. Every APIError and TransportError
+// matches the sentinel of its category.
+var (
+	ErrBadRequest       = errors.New("bad request")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
+	ErrMuted            = errors.New("bot is muted")
+	ErrMessageTooLong   = errors.New("message too long")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrNotFriend        = errors.New("not a friend")
+	ErrTimeout          = errors.New("timeout")
+	ErrDisconnected     = errors.New("disconnected")
+	ErrNetwork          = errors.New("network error")
+)
+
+var categorySentinels = map[Category]error{
+	CategoryBadRequest:     ErrBadRequest,
+	CategoryUnauthorized:   ErrUnauthorized,
+	CategoryPermission:     ErrPermissionDenied,
+	CategoryNotFound:       ErrNotFound,
+	CategoryMuted:          ErrMuted,
+	CategoryMessageTooLong: ErrMessageTooLong,
+	CategoryRateLimited:    ErrRateLimited,
+	CategoryNotFriend:      ErrNotFriend,
+	CategoryTimeout:        ErrTimeout,
+	CategoryDisconnected:   ErrDisconnected,
+	CategoryNetwork:        ErrNetwork,
+}
+
+// temporaryCategories are failures that may go away when the action is
+// repeated later. Unknown failures are not among them: they include errors
+// that never reached NapCat, such as encoding errors, which fail again.
+var temporaryCategories = map[Category]bool{
+	CategoryRateLimited:  true,
+	CategoryTimeout:      true,
+	CategoryDisconnected: true,
+	CategoryNetwork:      true,
+}
+
+// APIError is returned when NapCat answers an action with a non-zero
+// retcode.
+type APIError struct {
+	Action   string
+	RetCode  int
+	Status   string
+	Message  string
+	Wording  string
+	Category Category
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = e.Wording
+	}
+	return fmt.Sprintf("API error: %s (code: %d)", message, e.RetCode)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target != nil && categorySentinels[e.Category] == target
+}
+
+func newAPIError(action string, resp *Response) *APIError {
+	return &APIError{
+		Action:   action,
+		RetCode:  resp.RetCode,
+		Status:   resp.Status,
+		Message:  resp.Message,
+		Wording:  resp.Wording,
+		Category: classify(resp.RetCode, resp.Message+" "+resp.Wording),
+	}
+}
+
+// TransportError is returned when an action could not be delivered to
+// NapCat or its response never arrived.
+type TransportError struct {
+	Action   string
+	Category Category
+	Err      error
+}
+
+func (e *TransportError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TransportError) Is(target error) bool {
+	return target != nil && categorySentinels[e.Category] == target
+}
+
+func newTransportError(action string, category Category, err error) *TransportError {
+	return &TransportError{Action: action, Category: category, Err: err}
+}
+
+// networkError wraps a failed HTTP request, telling timeouts apart from
+// other network failures.
+func networkError(action string, err error) *TransportError {
+	category := CategoryNetwork
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		category = CategoryTimeout
+	}
+	return newTransportError(action, category, fmt.Errorf("failed to do request: %w", err))
+}
+
+// CategoryOf returns the category of a NapCat error, or CategoryUnknown for
+// errors that did not come from an action.
+func CategoryOf(err error) Category {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Category
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return transportErr.Category
+	}
+	return CategoryUnknown
+}
+
+// Temporary reports whether an action that failed with err may succeed when
+// retried: timeouts, lost connections and rate limiting. A send that timed
+// out is not temporary, since NapCat may have delivered it and repeating it
+// could post the message twice.
+func Temporary(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	category := CategoryOf(err)
+	if category == CategoryTimeout && strings.HasPrefix(actionOf(err), "send_") {
+		return false
+	}
+	return temporaryCategories[category]
+}
+
+func actionOf(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Action
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return transportErr.Action
+	}
+	return ""
+}
+
+// messageCategories maps fragments of NapCat's message and wording fields
+// to categories. NapCat reports most send failures with a generic retcode,
+// so the text is the only way to tell them apart.
+var messageCategories = []struct {
+	category Category
+	keywords []string
+}{
+	{CategoryMuted, []string{"禁言", "muted", "shut up"}},
+	{CategoryMessageTooLong, []string{"过长", "太长", "too long", "too large"}},
+	{CategoryRateLimited, []string{"频繁", "风控", "rate limit", "too many requests", "frequency"}},
+	{CategoryNotFriend, []string{"不是好友", "非好友", "not friend", "not a friend"}},
+	{CategoryPermission, []string{"权限", "permission", "not admin"}},
+	{CategoryNotFound, []string{"不存在", "找不到", "not found", "not exist"}},
+	{CategoryTimeout, []string{"超时", "timeout", "timed out"}},
+}
+
+func classify(retCode int, text string) Category {
+	text = strings.ToLower(text)
+	for _, entry := range messageCategories {
+		for _, keyword := range entry.keywords {
+			if strings.Contains(text, keyword) {
+				return entry.category
+			}
+		}
+	}
+
+	switch retCode {
+	case 100, 1400:
+		return CategoryBadRequest
+	case 104, 1401:
+		return CategoryUnauthorized
+	case 1403:
+		return CategoryPermission
+	case 1404:
+		return CategoryNotFound
+	case 429:
+		return CategoryRateLimited
+	default:
+		return CategoryUnknown
+	}
+}
@@ -0,0 +1,112 @@
+package napcat
+
+import (
+	"encoding/json"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+)
+
+// SetGroupBan mutes a member for duration seconds. A zero duration lifts
+// the mute.
+func (c *Client) SetGroupBan(groupID, userID int64, duration int) error {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+		"user_id":  userID,
+		"duration": duration,
+	}
+
+	_, err := c.post("/set_group_ban", payload)
+	return err
+}
+
+func (c *Client) SetGroupKick(groupID, userID int64, rejectAddRequest bool) error {
+	payload := map[string]interface{}{
+		"group_id":           groupID,
+		"user_id":            userID,
+		"reject_add_request": rejectAddRequest,
+	}
+
+	_, err := c.post("/set_group_kick", payload)
+	return err
+}
+
+func (c *Client) SetGroupCard(groupID, userID int64, card string) error {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+		"user_id":  userID,
+		"card":     card,
+	}
+
+	_, err := c.post("/set_group_card", payload)
+	return err
+}
+
+func (c *Client) SetGroupWholeBan(groupID int64, enable bool) error {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+		"enable":   enable,
+	}
+
+	_, err := c.post("/set_group_whole_ban", payload)
+	return err
+}
+
+func (c *Client) SetGroupAddRequest(flag, subType string, approve bool, reason string) error {
+	payload := map[string]interface{}{
+		"flag":     flag,
+		"sub_type": subType,
+		"approve":  approve,
+	}
+	if reason != "" {
+		payload["reason"] = reason
+	}
+
+	_, err := c.post("/set_group_add_request", payload)
+	return err
+}
+
+func (c *Client) GetGroupMemberInfo(groupID, userID int64, noCache bool) (*bot.GroupMemberInfo, error) {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+		"user_id":  userID,
+		"no_cache": noCache,
+	}
+
+	resp, err := c.post("/get_group_member_info", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var info bot.GroupMemberInfo
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// GetGroupFiles lists a folder of the group's file list, or the root when
+// folderID is empty.
+func (c *Client) GetGroupFiles(groupID int64, folderID string) (*bot.GroupFiles, error) {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+	}
+
+	endpoint := "/get_group_root_files"
+	if folderID != "" {
+		endpoint = "/get_group_files_by_folder"
+		payload["folder_id"] = folderID
+	}
+
+	resp, err := c.post(endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var files bot.GroupFiles
+	if err := json.Unmarshal(resp.Data, &files); err != nil {
+		return nil, err
+	}
+
+	return &files, nil
+}
@@ -0,0 +1,119 @@
+package napcat
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+const maxPostBodyBytes = 10 << 20
+
+// HTTPPostServer receives events from a OneBot implementation's HTTP POST
+// reporting. When a secret is configured, each request must carry an
+// X-Signature header of the form "sha1=<hex HMAC-SHA1 of the body>".
+// Actions still go out through the HTTP API or another transport.
+type HTTPPostServer struct {
+	addr   string
+	path   string
+	secret string
+	server *http.Server
+	events chan<- *bot.Event
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewHTTPPostServer(addr, path, secret string) *HTTPPostServer {
+	s := &HTTPPostServer{
+		addr:   addr,
+		path:   path,
+		secret: secret,
+		done:   make(chan struct{}),
+	}
+
+	// The server exists before Start so that Close can stop it from any
+	// goroutine, even before it listens.
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.handle)
+	s.server = &http.Server{Addr: addr, Handler: mux}
+	return s
+}
+
+// Connect only updates the signature secret; the server accepts requests
+// once Start is called.
+func (s *HTTPPostServer) Connect(url string, secret string) error {
+	s.secret = secret
+	return nil
+}
+
+// Start serves until Close is called. It returns at once if Close was
+// called first.
+func (s *HTTPPostServer) Start(eventChan chan<- *bot.Event) error {
+	s.events = eventChan
+	logger.Info(fmt.Sprintf("HTTP POST event server listening on %s%s", s.addr, s.path))
+
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http post server failed: %w", err)
+	}
+	return nil
+}
+
+func (s *HTTPPostServer) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return s.server.Close()
+}
+
+func (s *HTTPPostServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPostBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if !verifySignature(body, r.Header.Get("X-Signature"), s.secret) {
+		logger.Warn(fmt.Sprintf("Rejected HTTP POST event with invalid signature from %s", r.RemoteAddr))
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event bot.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		logger.Error(fmt.Sprintf("Failed to unmarshal event: %v", err))
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case s.events <- &event:
+		w.WriteHeader(http.StatusNoContent)
+	case <-s.done:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+func verifySignature(body []byte, signature, secret string) bool {
+	if secret == "" {
+		return true
+	}
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
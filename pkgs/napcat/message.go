@@ -6,15 +6,9 @@ import (
 	"github.com/crayon/wrap-bot/pkgs/bot"
 )
 
-type ForwardNode struct {
-	Type string                 `json:"type"`
-	Data map[string]interface{} `json:"data"`
-}
+type ForwardNode = bot.ForwardNode
 
-type MessageSegment struct {
-	Type string                 `json:"type"`
-	Data map[string]interface{} `json:"data"`
-}
+type MessageSegment = bot.MessageSegment
 
 func (c *Client) SendGroupMessage(groupID int64, message interface{}) (int32, error) {
 	payload := map[string]interface{}{
@@ -35,6 +29,7 @@ func (c *Client) SendGroupMessage(groupID int64, message interface{}) (int32, er
 		return 0, err
 	}
 
+	notifySent(SentMessage{MessageType: "group", GroupID: groupID, MessageID: int64(result.MessageID), Message: message})
 	return result.MessageID, nil
 }
 
@@ -57,6 +52,7 @@ func (c *Client) SendPrivateMessage(userID int64, message interface{}) (int32, e
 		return 0, err
 	}
 
+	notifySent(SentMessage{MessageType: "private", UserID: userID, MessageID: int64(result.MessageID), Message: message})
 	return result.MessageID, nil
 }
 
@@ -134,66 +130,34 @@ func (c *Client) GetFriendList() ([]bot.Friend, error) {
 }
 
 func NewTextSegment(text string) MessageSegment {
-	return MessageSegment{
-		Type: "text",
-		Data: map[string]interface{}{
-			"text": text,
-		},
-	}
+	return bot.TextSegment(text)
 }
 
+// NewImageSegment sends file unchanged: a URL, a base64:// or file:// URI,
+// or a QQ file id. Callers holding a local path pass it through
+// bot.MediaFile first.
 func NewImageSegment(file string) MessageSegment {
-	return MessageSegment{
-		Type: "image",
-		Data: map[string]interface{}{
-			"file": file,
-		},
-	}
+	return MessageSegment{Type: "image", Data: map[string]interface{}{"file": file}}
 }
 
 func NewAtSegment(qq int64) MessageSegment {
-	return MessageSegment{
-		Type: "at",
-		Data: map[string]interface{}{
-			"qq": qq,
-		},
-	}
+	return bot.AtSegment(qq)
 }
 
 func NewAtAllSegment() MessageSegment {
-	return MessageSegment{
-		Type: "at",
-		Data: map[string]interface{}{
-			"qq": "all",
-		},
-	}
+	return bot.AtAllSegment()
 }
 
 func NewFaceSegment(id int) MessageSegment {
-	return MessageSegment{
-		Type: "face",
-		Data: map[string]interface{}{
-			"id": id,
-		},
-	}
+	return bot.FaceSegment(id)
 }
 
 func NewVideoSegment(file string) MessageSegment {
-	return MessageSegment{
-		Type: "video",
-		Data: map[string]interface{}{
-			"file": file,
-		},
-	}
+	return MessageSegment{Type: "video", Data: map[string]interface{}{"file": file}}
 }
 
 func NewRecordSegment(file string) MessageSegment {
-	return MessageSegment{
-		Type: "record",
-		Data: map[string]interface{}{
-			"file": file,
-		},
-	}
+	return MessageSegment{Type: "record", Data: map[string]interface{}{"file": file}}
 }
 
 func NewCustomForwardNode(name string, uin int64, content interface{}) ForwardNode {
@@ -208,19 +172,7 @@ func NewCustomForwardNode(name string, uin int64, content interface{}) ForwardNo
 }
 
 func NewMixedForwardNode(name string, uin int64, segments ...MessageSegment) ForwardNode {
-	content := make([]interface{}, len(segments))
-	for i, seg := range segments {
-		content[i] = seg
-	}
-
-	return ForwardNode{
-		Type: "node",
-		Data: map[string]interface{}{
-			"nickname": name,
-			"user_id":  uin,
-			"content":  content,
-		},
-	}
+	return bot.NewForwardNode(name, uin, segments...)
 }
 
 func NewMessageForwardNode(messageID int32) ForwardNode {
@@ -248,6 +200,7 @@ func (c *Client) SendGroupForwardMsg(groupID int64, nodes []ForwardNode) (map[st
 		return nil, err
 	}
 
+	notifySent(SentMessage{MessageType: "group", GroupID: groupID, MessageID: forwardMessageID(result), Message: nodes})
 	return result, nil
 }
 
@@ -267,6 +220,7 @@ func (c *Client) SendPrivateForwardMsg(userID int64, nodes []ForwardNode) (map[s
 		return nil, err
 	}
 
+	notifySent(SentMessage{MessageType: "private", UserID: userID, MessageID: forwardMessageID(result), Message: nodes})
 	return result, nil
 }
 
@@ -288,6 +242,71 @@ func (c *Client) GetForwardMsg(messageID string) (map[string]interface{}, error)
 	return result, nil
 }
 
+// GetMsgRaw returns the get_msg response untouched, for callers that walk
+// nested segments such as forwarded chats.
+func (c *Client) GetMsgRaw(messageID int64) (map[string]interface{}, error) {
+	payload := map[string]interface{}{
+		"message_id": messageID,
+	}
+
+	resp, err := c.post("/get_msg", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *Client) GetMsg(messageID int64) (*bot.MessageInfo, error) {
+	payload := map[string]interface{}{
+		"message_id": messageID,
+	}
+
+	resp, err := c.post("/get_msg", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var info bot.MessageInfo
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// UploadGroupFile uploads file to the group's file list. file may be a path
+// on the NapCat host, an http(s) URL or a base64:// payload.
+func (c *Client) UploadGroupFile(groupID int64, file, name, folder string) error {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+		"file":     file,
+		"name":     name,
+	}
+	if folder != "" {
+		payload["folder"] = folder
+	}
+
+	_, err := c.post("/upload_group_file", payload)
+	return err
+}
+
+func (c *Client) UploadPrivateFile(userID int64, file, name string) error {
+	payload := map[string]interface{}{
+		"user_id": userID,
+		"file":    file,
+		"name":    name,
+	}
+
+	_, err := c.post("/upload_private_file", payload)
+	return err
+}
+
 func (c *Client) ForwardMsgToGroup(groupID int64, messageID int32) error {
 	payload := map[string]interface{}{
 		"group_id":   groupID,
@@ -307,3 +326,86 @@ func (c *Client) ForwardMsgToPrivate(userID int64, messageID int32) error {
 	_, err := c.post("/forward_friend_single_msg", payload)
 	return err
 }
+
+type RecordFile = bot.RecordFile
+
+func (c *Client) GetRecord(file string, outFormat string) (*RecordFile, error) {
+	payload := map[string]interface{}{
+		"file":       file,
+		"out_format": outFormat,
+	}
+
+	resp, err := c.post("/get_record", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var record RecordFile
+	if err := json.Unmarshal(resp.Data, &record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+type ImageFile = bot.ImageFile
+
+func (c *Client) GetImage(file string) (*ImageFile, error) {
+	payload := map[string]interface{}{
+		"file": file,
+	}
+
+	resp, err := c.post("/get_image", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var image ImageFile
+	if err := json.Unmarshal(resp.Data, &image); err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+type FileInfo = bot.FileInfo
+
+func (c *Client) GetFile(fileID string) (*FileInfo, error) {
+	payload := map[string]interface{}{
+		"file_id": fileID,
+	}
+
+	resp, err := c.post("/get_file", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var info FileInfo
+	if err := json.Unmarshal(resp.Data, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (c *Client) GetGroupFileURL(groupID int64, fileID string, busid int) (string, error) {
+	payload := map[string]interface{}{
+		"group_id": groupID,
+		"file_id":  fileID,
+		"busid":    busid,
+	}
+
+	resp, err := c.post("/get_group_file_url", payload)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		return "", err
+	}
+
+	return result.URL, nil
+}
@@ -0,0 +1,317 @@
+package napcat
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	roleUniversal = "Universal"
+	roleAPI       = "API"
+	roleEvent     = "Event"
+)
+
+// ReverseWSServer listens for reverse WebSocket connections from NapCat or
+// another OneBot implementation. A connection's role comes from its
+// X-Client-Role header, or from the /api and /event suffix of the path for
+// split deployments; Universal connections carry both events and actions.
+// API and Universal connections are tracked by their X-Self-ID header: the
+// clients from ForSelf send actions to the matching connection, and the
+// server's own client to the most recent one.
+type ReverseWSServer struct {
+	*Client
+
+	addr             string
+	path             string
+	token            string
+	server           *http.Server
+	events           chan<- *bot.Event
+	upgrader         websocket.Upgrader
+	heartbeatTimeout time.Duration
+	actionTimeout    time.Duration
+	onConnect        func(selfID int64)
+
+	mu       sync.Mutex
+	apiConn  *websocket.Conn
+	apiConns map[int64]*websocket.Conn
+	writeMu  sync.Mutex
+	// conns holds each open connection with the caller awaiting responses
+	// to the actions sent over it.
+	conns map[*websocket.Conn]*actionCaller
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewReverseWSServer(addr, path, token string) *ReverseWSServer {
+	s := &ReverseWSServer{
+		addr:  addr,
+		path:  strings.TrimSuffix(path, "/"),
+		token: token,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		heartbeatTimeout: defaultHeartbeatTimeout,
+		actionTimeout:    defaultActionTimeout,
+		apiConns:         make(map[int64]*websocket.Conn),
+		conns:            make(map[*websocket.Conn]*actionCaller),
+		done:             make(chan struct{}),
+	}
+	s.Client = &Client{transport: s}
+
+	// The server exists before Start so that Close can stop it from any
+	// goroutine, even before it listens.
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.path, s.handle)
+	mux.HandleFunc(s.path+"/api", s.handle)
+	mux.HandleFunc(s.path+"/event", s.handle)
+	s.server = &http.Server{Addr: addr, Handler: mux}
+	return s
+}
+
+// Connect only updates the access token; the server accepts connections
+// once Start is called.
+func (s *ReverseWSServer) Connect(url string, token string) error {
+	s.token = token
+	return nil
+}
+
+// SetActionTimeout sets how long Call waits for an action response. It must
+// be set before Start.
+func (s *ReverseWSServer) SetActionTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.actionTimeout = timeout
+	}
+}
+
+// SetHeartbeatTimeout sets how long a connection may stay silent before it
+// is dropped. It should exceed the OneBot heartbeat interval.
+func (s *ReverseWSServer) SetHeartbeatTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.heartbeatTimeout = timeout
+	}
+}
+
+// OnConnect registers a callback run when an API or Universal connection
+// with an X-Self-ID header is accepted, before any of its events are read.
+// It must be set before Start.
+func (s *ReverseWSServer) OnConnect(fn func(selfID int64)) {
+	s.onConnect = fn
+}
+
+// ForSelf returns a client whose actions go to the connection of the bot
+// logged in as selfID.
+func (s *ReverseWSServer) ForSelf(selfID int64) *Client {
+	return &Client{transport: selfTransport{server: s, selfID: selfID}}
+}
+
+type selfTransport struct {
+	server *ReverseWSServer
+	selfID int64
+}
+
+func (t selfTransport) Call(action string, params interface{}) (*Response, error) {
+	return t.server.call(action, params, func() *websocket.Conn {
+		return t.server.apiConns[t.selfID]
+	})
+}
+
+// Start serves until Close is called. It returns at once if Close was
+// called first.
+func (s *ReverseWSServer) Start(eventChan chan<- *bot.Event) error {
+	s.events = eventChan
+	logger.Info(fmt.Sprintf("Reverse WebSocket server listening on %s%s", s.addr, s.path))
+
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("reverse websocket server failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ReverseWSServer) Call(action string, params interface{}) (*Response, error) {
+	return s.call(action, params, func() *websocket.Conn { return s.apiConn })
+}
+
+// call sends an action over the connection pick returns; pick runs with
+// s.mu held.
+func (s *ReverseWSServer) call(action string, params interface{}, pick func() *websocket.Conn) (*Response, error) {
+	s.mu.Lock()
+	conn := pick()
+	actions := s.conns[conn]
+	s.mu.Unlock()
+
+	if conn == nil || actions == nil {
+		return nil, newTransportError(action, CategoryDisconnected, fmt.Errorf("no reverse websocket API connection"))
+	}
+
+	return actions.call(action, params, s.done, func(req actionRequest) error {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		return conn.WriteJSON(req)
+	})
+}
+
+func (s *ReverseWSServer) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	return s.server.Close()
+}
+
+func (s *ReverseWSServer) handle(w http.ResponseWriter, r *http.Request) {
+	if !checkAccessToken(r, s.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	role := r.Header.Get("X-Client-Role")
+	switch {
+	case role != "":
+	case strings.HasSuffix(r.URL.Path, "/api"):
+		role = roleAPI
+	case strings.HasSuffix(r.URL.Path, "/event"):
+		role = roleEvent
+	default:
+		role = roleUniversal
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Reverse WebSocket upgrade failed: %v", err))
+		return
+	}
+
+	selfID, _ := strconv.ParseInt(r.Header.Get("X-Self-ID"), 10, 64)
+	logger.Info(fmt.Sprintf("Reverse WebSocket connected: role=%s self_id=%d", role, selfID))
+
+	conn.SetReadDeadline(time.Now().Add(s.heartbeatTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.heartbeatTimeout))
+	})
+
+	actions := newActionCaller()
+	actions.setTimeout(s.actionTimeout)
+
+	s.mu.Lock()
+	s.conns[conn] = actions
+	if role != roleEvent {
+		s.apiConn = conn
+		s.apiConns[selfID] = conn
+	}
+	s.mu.Unlock()
+
+	if role != roleEvent && selfID != 0 && s.onConnect != nil {
+		s.onConnect(selfID)
+	}
+
+	defer s.disconnect(conn, actions, role, selfID)
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go s.heartbeat(conn, stopPing)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				logger.Warn(fmt.Sprintf("Reverse WebSocket (%s, self_id=%d) disconnected: %v", role, selfID, err))
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(s.heartbeatTimeout))
+
+		if actions.resolve(message) || role == roleAPI {
+			continue
+		}
+
+		var event bot.Event
+		if err := json.Unmarshal(message, &event); err != nil {
+			logger.Error(fmt.Sprintf("Failed to unmarshal event: %v", err))
+			continue
+		}
+
+		select {
+		case s.events <- &event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// heartbeat pings the connection so a peer that stops answering is noticed
+// through the read deadline even when no events are flowing.
+func (s *ReverseWSServer) heartbeat(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.heartbeatTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.writeMu.Lock()
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			s.writeMu.Unlock()
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Reverse WebSocket heartbeat failed: %v", err))
+				conn.Close()
+				return
+			}
+		case <-stop:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *ReverseWSServer) disconnect(conn *websocket.Conn, actions *actionCaller, role string, selfID int64) {
+	conn.Close()
+
+	s.mu.Lock()
+	delete(s.conns, conn)
+	if s.apiConns[selfID] == conn {
+		delete(s.apiConns, selfID)
+	}
+	if s.apiConn == conn {
+		s.apiConn = nil
+	}
+	s.mu.Unlock()
+
+	actions.failPending(fmt.Errorf("reverse websocket %s connection lost", role))
+}
+
+// checkAccessToken accepts the token as a bearer Authorization header or an
+// access_token query parameter, as OneBot 11 implementations send either.
+func checkAccessToken(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "Token "} {
+		if got, ok := strings.CutPrefix(auth, scheme); ok && tokenEqual(got, token) {
+			return true
+		}
+	}
+	return tokenEqual(r.URL.Query().Get("access_token"), token)
+}
+
+func tokenEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
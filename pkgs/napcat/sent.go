@@ -0,0 +1,42 @@
+package napcat
+
+import "sync"
+
+// SentMessage describes a message successfully sent through any Client.
+type SentMessage struct {
+	MessageType string
+	GroupID     int64
+	UserID      int64
+	MessageID   int64
+	Message     interface{}
+}
+
+var (
+	sentHooksMu sync.RWMutex
+	sentHooks   []func(SentMessage)
+)
+
+// OnMessageSent registers a hook that is called after every message,
+// including forward messages, is sent by the bot.
+func OnMessageSent(hook func(SentMessage)) {
+	sentHooksMu.Lock()
+	defer sentHooksMu.Unlock()
+	sentHooks = append(sentHooks, hook)
+}
+
+func notifySent(msg SentMessage) {
+	sentHooksMu.RLock()
+	hooks := sentHooks
+	sentHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(msg)
+	}
+}
+
+func forwardMessageID(result map[string]interface{}) int64 {
+	if id, ok := result["message_id"].(float64); ok {
+		return int64(id)
+	}
+	return 0
+}
@@ -3,8 +3,10 @@ package napcat
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/crayon/wrap-bot/pkgs/bot"
@@ -12,23 +14,98 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// WSClient receives events over a forward WebSocket. Through its embedded
+// Client it also implements bot.APIClient, sending actions over the same
+// connection and matching responses to callers by their echo field.
+//
+// Lost connections are retried forever with exponential backoff. A
+// connection that delivers no message, pong or OneBot heartbeat within the
+// heartbeat timeout is considered dead and replaced.
 type WSClient struct {
+	*Client
+
 	url       string
 	token     string
 	conn      *websocket.Conn
 	mu        sync.Mutex
 	connected bool
 	done      chan struct{}
+	closeOnce sync.Once
+	actions   *actionCaller
+
+	heartbeatTimeout time.Duration
+	selfID           atomic.Int64
+	onState          func(StateChange)
+}
+
+// StateChange reports a change of the WebSocket connection state.
+type StateChange struct {
+	State   bot.ConnectionState
+	URL     string
+	Attempt int
+	Delay   time.Duration
+	Error   string
+	Time    time.Time
 }
 
+const (
+	defaultHeartbeatTimeout = 60 * time.Second
+	minReconnectDelay       = time.Second
+	maxReconnectDelay       = time.Minute
+)
+
 func NewWSClient(url, token string) *WSClient {
-	return &WSClient{
-		url:   url,
-		token: token,
-		done:  make(chan struct{}),
+	ws := &WSClient{
+		url:              url,
+		token:            token,
+		done:             make(chan struct{}),
+		actions:          newActionCaller(),
+		heartbeatTimeout: defaultHeartbeatTimeout,
+	}
+	ws.Client = &Client{transport: ws}
+	return ws
+}
+
+// SetActionTimeout sets how long Call waits for an action response.
+func (ws *WSClient) SetActionTimeout(timeout time.Duration) {
+	ws.actions.setTimeout(timeout)
+}
+
+// SetHeartbeatTimeout sets how long the connection may stay silent before
+// it is dropped and reconnected. It should exceed the OneBot heartbeat
+// interval.
+func (ws *WSClient) SetHeartbeatTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		ws.heartbeatTimeout = timeout
 	}
 }
 
+// OnStateChange registers a callback for connection state changes. It must
+// be set before Start.
+func (ws *WSClient) OnStateChange(fn func(StateChange)) {
+	ws.onState = fn
+}
+
+func (ws *WSClient) Connected() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.connected
+}
+
+// Call sends a OneBot action over the WebSocket and waits for the response
+// carrying the same echo.
+func (ws *WSClient) Call(action string, params interface{}) (*Response, error) {
+	return ws.actions.call(action, params, ws.done, func(req actionRequest) error {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+
+		if !ws.connected || ws.conn == nil {
+			return fmt.Errorf("websocket not connected")
+		}
+		return ws.conn.WriteJSON(req)
+	})
+}
+
 func (ws *WSClient) Connect(url string, token string) error {
 	ws.url = url
 	ws.token = token
@@ -46,6 +123,11 @@ func (ws *WSClient) connect() error {
 		return fmt.Errorf("failed to connect to websocket: %w", err)
 	}
 
+	conn.SetReadDeadline(time.Now().Add(ws.heartbeatTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(ws.heartbeatTimeout))
+	})
+
 	ws.mu.Lock()
 	ws.conn = conn
 	ws.connected = true
@@ -55,93 +137,173 @@ func (ws *WSClient) connect() error {
 	return nil
 }
 
+// Start keeps a connection open until Close is called, reconnecting after
+// failures, and delivers events and connection state changes to eventChan.
 func (ws *WSClient) Start(eventChan chan<- *bot.Event) error {
-	if err := ws.connect(); err != nil {
-		return err
-	}
-
-	go ws.heartbeat()
-
+	attempt := 0
 	for {
-		select {
-		case <-ws.done:
-			return nil
-		default:
-			_, message, err := ws.conn.ReadMessage()
-			if err != nil {
-				logger.Error(fmt.Sprintf("WebSocket read error: %v", err))
-				if ws.reconnect() != nil {
-					return err
-				}
-				continue
+		if err := ws.connect(); err != nil {
+			if ws.closed() {
+				return nil
 			}
 
-			var event bot.Event
-			if err := json.Unmarshal(message, &event); err != nil {
-				logger.Error(fmt.Sprintf("Failed to unmarshal event: %v", err))
-				continue
-			}
+			attempt++
+			delay := reconnectDelay(attempt)
+			logger.Warn(fmt.Sprintf("WebSocket connect failed, retrying in %v (attempt %d): %v", delay.Round(time.Millisecond), attempt, err))
+			ws.changeState(eventChan, StateChange{State: bot.ConnectionReconnecting, Attempt: attempt, Delay: delay, Error: err.Error()})
 
 			select {
-			case eventChan <- &event:
+			case <-time.After(delay):
+				continue
 			case <-ws.done:
 				return nil
 			}
 		}
+
+		attempt = 0
+		ws.changeState(eventChan, StateChange{State: bot.ConnectionConnected})
+
+		err := ws.serve(eventChan)
+		ws.disconnect()
+		if ws.closed() {
+			return nil
+		}
+
+		logger.Error(fmt.Sprintf("WebSocket read error: %v", err))
+		ws.changeState(eventChan, StateChange{State: bot.ConnectionDisconnected, Error: err.Error()})
 	}
 }
 
-func (ws *WSClient) reconnect() error {
+// serve reads from the current connection until it fails.
+func (ws *WSClient) serve(eventChan chan<- *bot.Event) error {
 	ws.mu.Lock()
-	ws.connected = false
-	if ws.conn != nil {
-		ws.conn.Close()
-	}
+	conn := ws.conn
 	ws.mu.Unlock()
 
-	for i := 0; i < 10; i++ {
-		logger.Warn(fmt.Sprintf("Attempting to reconnect... (attempt %d/10)", i+1))
-		if err := ws.connect(); err == nil {
-			logger.Info("Reconnected successfully")
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go ws.heartbeat(conn, stopPing)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(ws.heartbeatTimeout))
+
+		if ws.actions.resolve(message) {
+			continue
+		}
+
+		var event bot.Event
+		if err := json.Unmarshal(message, &event); err != nil {
+			logger.Error(fmt.Sprintf("Failed to unmarshal event: %v", err))
+			continue
+		}
+		if event.SelfID != 0 {
+			ws.selfID.Store(event.SelfID)
+		}
+
+		select {
+		case eventChan <- &event:
+		case <-ws.done:
 			return nil
 		}
-		time.Sleep(time.Second * time.Duration(i+1))
 	}
+}
+
+func (ws *WSClient) disconnect() {
+	ws.mu.Lock()
+	ws.connected = false
+	if ws.conn != nil {
+		ws.conn.Close()
+		ws.conn = nil
+	}
+	ws.mu.Unlock()
 
-	return fmt.Errorf("failed to reconnect after 10 attempts")
+	ws.actions.failPending(fmt.Errorf("websocket connection lost"))
 }
 
-func (ws *WSClient) heartbeat() {
-	ticker := time.NewTicker(30 * time.Second)
+// heartbeat pings the connection so a peer that stops answering is noticed
+// through the read deadline even when no events are flowing.
+func (ws *WSClient) heartbeat(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(ws.heartbeatTimeout / 2)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			ws.mu.Lock()
-			if ws.connected && ws.conn != nil {
-				if err := ws.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-					logger.Warn(fmt.Sprintf("Heartbeat failed: %v", err))
-					ws.connected = false
-				}
-			}
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
 			ws.mu.Unlock()
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Heartbeat failed: %v", err))
+				conn.Close()
+				return
+			}
+		case <-stop:
+			return
 		case <-ws.done:
 			return
 		}
 	}
 }
 
+func (ws *WSClient) changeState(eventChan chan<- *bot.Event, change StateChange) {
+	change.URL = ws.url
+	change.Time = time.Now()
+
+	if ws.onState != nil {
+		ws.onState(change)
+	}
+
+	event := &bot.Event{
+		Time:     change.Time.Unix(),
+		SelfID:   ws.selfID.Load(),
+		PostType: bot.EventTypeMetaEvent,
+		MetaType: bot.MetaTypeConnection,
+		SubType:  string(change.State),
+	}
+
+	select {
+	case eventChan <- event:
+	case <-ws.done:
+	}
+}
+
+func (ws *WSClient) closed() bool {
+	select {
+	case <-ws.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the client. It is safe to call more than once.
 func (ws *WSClient) Close() error {
-	close(ws.done)
+	ws.closeOnce.Do(func() { close(ws.done) })
 
 	ws.mu.Lock()
 	defer ws.mu.Unlock()
 
+	ws.connected = false
 	if ws.conn != nil {
-		ws.connected = false
-		return ws.conn.Close()
+		err := ws.conn.Close()
+		ws.conn = nil
+		return err
 	}
 
 	return nil
 }
+
+// reconnectDelay doubles the wait for every failed attempt up to a minute,
+// with 20% jitter so many clients do not reconnect in lockstep.
+func reconnectDelay(attempt int) time.Duration {
+	delay := maxReconnectDelay
+	if attempt < 7 {
+		delay = min(minReconnectDelay<<(attempt-1), maxReconnectDelay)
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(delay) * jitter)
+}
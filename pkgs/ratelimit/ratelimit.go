@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Scope decides who shares one budget of a rule.
+type Scope string
+
+const (
+	// ScopeUser gives every user a budget of their own.
+	ScopeUser Scope = "user"
+	// ScopeGroup shares one budget among everyone in a group. Private chats
+	// fall back to the user.
+	ScopeGroup Scope = "group"
+	// ScopeCommand shares one budget among everyone using the command.
+	ScopeCommand Scope = "command"
+)
+
+func (s Scope) Valid() bool {
+	return s == ScopeUser || s == ScopeGroup || s == ScopeCommand
+}
+
+// Rule allows Events per WindowSeconds for each key of its scope.
+type Rule struct {
+	Events        int   `json:"events"`
+	WindowSeconds int   `json:"window_seconds"`
+	Scope         Scope `json:"scope"`
+}
+
+func (r Rule) Window() time.Duration {
+	return time.Duration(r.WindowSeconds) * time.Second
+}
+
+func (r Rule) Validate() error {
+	if r.Events <= 0 {
+		return fmt.Errorf("events must be positive")
+	}
+	if r.WindowSeconds <= 0 {
+		return fmt.Errorf("window_seconds must be positive")
+	}
+	if !r.Scope.Valid() {
+		return fmt.Errorf("unknown scope %q", r.Scope)
+	}
+	return nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%d per %ds per %s", r.Events, r.WindowSeconds, r.Scope)
+}
+
+type entry struct {
+	hits     []time.Time
+	warnedAt time.Time
+}
+
+// Limiter is a sliding-window limiter: a key may pass events times within
+// any window. It is safe for concurrent use and forgets keys that have been
+// idle for a whole window.
+type Limiter struct {
+	mu        sync.Mutex
+	events    int
+	window    time.Duration
+	keys      map[string]*entry
+	nextSweep time.Time
+}
+
+func NewLimiter(events int, window time.Duration) *Limiter {
+	return &Limiter{
+		events: events,
+		window: window,
+		keys:   make(map[string]*entry),
+	}
+}
+
+// Allow counts an event for key and reports whether it is within the limit.
+// A rejected event is not counted; retryAfter tells when the key may pass
+// again.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	if l.events <= 0 || l.window <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+
+	e, exists := l.keys[key]
+	if !exists {
+		e = &entry{}
+		l.keys[key] = e
+	}
+	e.expire(now.Add(-l.window))
+
+	if len(e.hits) >= l.events {
+		return false, e.hits[0].Add(l.window).Sub(now)
+	}
+	e.hits = append(e.hits, now)
+	return true, 0
+}
+
+// Warn reports whether a rejected key should be told to slow down. It
+// returns true at most once per cooldown for each key.
+func (l *Limiter) Warn(key string, cooldown time.Duration) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, exists := l.keys[key]
+	if !exists {
+		return false
+	}
+	if !e.warnedAt.IsZero() && now.Sub(e.warnedAt) < cooldown {
+		return false
+	}
+	e.warnedAt = now
+	return true
+}
+
+// Len returns the number of keys currently tracked.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.keys)
+}
+
+func (e *entry) expire(cutoff time.Time) {
+	i := 0
+	for i < len(e.hits) && !e.hits[i].After(cutoff) {
+		i++
+	}
+	if i > 0 {
+		e.hits = append(e.hits[:0], e.hits[i:]...)
+	}
+}
+
+// sweepLocked drops the keys without events in the current window, at most
+// once per window.
+func (l *Limiter) sweepLocked(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	l.nextSweep = now.Add(l.window)
+
+	cutoff := now.Add(-l.window)
+	for key, e := range l.keys {
+		if len(e.hits) == 0 || !e.hits[len(e.hits)-1].After(cutoff) {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// LoadRules reads rules keyed by plugin name from path. A missing file
+// yields no rules.
+func LoadRules(path string) (map[string]Rule, error) {
+	rules := make(map[string]Rule)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func SaveRules(path string, rules map[string]Rule) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
-	"strings"
 	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/napcat"
 )
 
 type RetryConfig struct {
@@ -24,14 +26,16 @@ func DefaultRetryConfig() RetryConfig {
 
 type ShouldRetryFunc func(error) bool
 
+// IsRateLimitError reports whether NapCat refused an action because the bot
+// sent too much too quickly.
 func IsRateLimitError(err error) bool {
-	if err == nil {
-		return false
-	}
-	errStr := err.Error()
-	return strings.Contains(errStr, "Too Many Requests") ||
-		strings.Contains(errStr, "429") ||
-		strings.Contains(errStr, "rate limit")
+	return errors.Is(err, napcat.ErrRateLimited)
+}
+
+// IsTemporaryError reports whether an action failed for a reason that may go
+// away on its own, such as a timeout, a lost connection or rate limiting.
+func IsTemporaryError(err error) bool {
+	return napcat.Temporary(err)
 }
 
 func RetryWithBackoff(operation func() error, config RetryConfig, shouldRetry ShouldRetryFunc) error {
@@ -66,7 +70,7 @@ func RetryWithBackoff(operation func() error, config RetryConfig, shouldRetry Sh
 }
 
 func Retry(operation func() error) error {
-	return RetryWithBackoff(operation, DefaultRetryConfig(), IsRateLimitError)
+	return RetryWithBackoff(operation, DefaultRetryConfig(), IsTemporaryError)
 }
 
 func pow(base, exp float64) float64 {
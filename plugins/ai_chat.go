@@ -1,7 +1,6 @@
 package plugins
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 
@@ -11,7 +10,6 @@ import (
 	aiconfig "github.com/crayon/wrap-bot/pkgs/feature/ai/config"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/factory"
 	"github.com/crayon/wrap-bot/pkgs/logger"
-	"github.com/crayon/wrap-bot/pkgs/napcat"
 )
 
 func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
@@ -25,19 +23,34 @@ func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
 
 		Model: cfg.AIModel,
 
-		Temperature:      0.7,
-		TopP:             0.9,
-		MaxTokens:        2000,
-		MaxHistory:       20,
-		SystemPromptPath: cfg.SystemPromptPath,
-		SerpAPIKey:       cfg.SerpAPIKey,
-		WeatherAPIKey:    cfg.WeatherAPIKey,
-		ToolsEnabled:     cfg.AIToolsEnabled,
+		Temperature:       0.7,
+		TopP:              0.9,
+		MaxTokens:         2000,
+		MaxHistory:        20,
+		SystemPromptPath:  cfg.SystemPromptPath,
+		SerpAPIKey:        cfg.SerpAPIKey,
+		WeatherAPIKey:     cfg.WeatherAPIKey,
+		ToolsEnabled:      cfg.AIToolsEnabled,
+		ImageDetail:       cfg.AIImageDetail,
+		ImageCacheDir:     cfg.AIImageCacheDir,
+		ImageMaxBytes:     cfg.AIImageMaxBytes,
+		ImageMaxDimension: cfg.AIImageMaxDimension,
+		STTModel:          cfg.AISTTModel,
+		TTSModel:          cfg.AITTSModel,
+		TTSVoice:          cfg.AITTSVoice,
 	}
 
 	factory := factory.NewFactory(aiCfg)
+	factory.ImagePipeline().SetResolver(newNapCatImageResolver(int64(cfg.AIImageMaxBytes)))
 	chatAgent := factory.CreateAgent()
 
+	var voice *voiceSupport
+	if cfg.AIVoiceEnabled {
+		voice = newVoiceSupport(cfg, factory.CreateAudioClient())
+	}
+
+	docs := newDocumentSupport(cfg)
+
 	logger.Info(fmt.Sprintf("[AIChatPlugin] Initialized with %d tools",
 		len(aiCfg.ToolsEnabled)))
 
@@ -50,8 +63,8 @@ func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
 			forwardID := getForwardID(ctx.Event)
 			logger.Info(fmt.Sprintf("[AIChatPlugin] Received forward message, ID: %s", forwardID))
 
-			if napcatClient, ok := ctx.GetAPIClient().(*napcat.Client); ok && forwardID != "" {
-				forwardData, err := napcatClient.GetForwardMsg(forwardID)
+			if api := ctx.GetAPIClient(); api != nil && forwardID != "" {
+				forwardData, err := api.GetForwardMsg(forwardID)
 				if err != nil {
 					logger.Error(fmt.Sprintf("[AIChatPlugin] Failed to get forward message: %v", err))
 				} else {
@@ -63,7 +76,42 @@ func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
 			return
 		}
 
+		conversationID := fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID)
+		if ctx.Event.IsPrivateMessage() {
+			conversationID = fmt.Sprintf("private_%d", ctx.Event.UserID)
+		}
+
+		if files := ctx.Event.GetFiles(); len(files) > 0 {
+			for _, file := range files {
+				doc, err := docs.load(ctx.Context(), ctx.GetAPIClient(), ctx.Event, conversationID, file)
+				if err != nil {
+					logger.Error(fmt.Sprintf("[AIChatPlugin] Failed to load file %s: %v", file.Name, err))
+					ctx.ReplyText(fmt.Sprintf("读不了 %s 呢...", file.Name))
+					continue
+				}
+				ctx.ReplyText(fmt.Sprintf("已读取 %s（约 %d tokens，%d 段），可以针对它提问啦", doc.Name, doc.Tokens, len(doc.Chunks)))
+			}
+			return
+		}
+
 		text := ctx.Event.GetText()
+
+		if records := ctx.Event.GetRecords(); len(records) > 0 {
+			if voice == nil {
+				return
+			}
+
+			transcript, err := voice.transcribe(ctx.Context(), ctx.GetAPIClient(), records[0])
+			if err != nil {
+				logger.Error(fmt.Sprintf("[AIChatPlugin] Failed to transcribe voice message: %v", err))
+				ctx.ReplyText("没听清呢...")
+				return
+			}
+
+			logger.Info(fmt.Sprintf("[AIChatPlugin] Voice transcript: %s", transcript))
+			text = transcript
+		}
+
 		if text == "" {
 			return
 		}
@@ -72,13 +120,9 @@ func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
 			return
 		}
 
-		conversationID := fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID)
-		if ctx.Event.IsPrivateMessage() {
-			conversationID = fmt.Sprintf("private_%d", ctx.Event.UserID)
-		}
-
 		if text == "清除历史" || text == "reset" {
 			chatAgent.ClearHistory(conversationID)
+			docs.clear(conversationID)
 			ctx.ReplyText("空空如也了")
 			return
 		}
@@ -86,11 +130,15 @@ func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
 		var response *agent.ChatResult
 		var err error
 
+		opts := agent.ChatOptions{
+			ExtraContext: docs.contextFor(conversationID, text),
+		}
+
 		imageURLs := ctx.Event.GetImages()
 		if len(imageURLs) > 0 {
-			response, err = chatAgent.ChatWithImages(context.Background(), conversationID, text, imageURLs)
+			response, err = chatAgent.ChatWithImagesAndOptions(eventContext(ctx), conversationID, text, imageURLs, opts)
 		} else {
-			response, err = chatAgent.Chat(context.Background(), conversationID, text)
+			response, err = chatAgent.ChatWithOptions(ctx.Context(), conversationID, text, opts)
 		}
 
 		if err != nil {
@@ -100,27 +148,22 @@ func AIChatPlugin(cfg *config.Config) bot.HandlerFunc {
 		}
 
 		if response.Thinking != "" {
-			apiClient := ctx.GetAPIClient()
-			if napcatClient, ok := apiClient.(*napcat.Client); ok {
-				thinkingMsg := fmt.Sprintf("thinking: \n---\n%s\n---", response.Thinking)
-				node := napcat.NewMixedForwardNode(
-					"AI Thinking",
-					ctx.Event.SelfID,
-					napcat.NewTextSegment(thinkingMsg),
-				)
-
-				if ctx.Event.IsGroupMessage() {
-					_, err := napcatClient.SendGroupForwardMsg(ctx.Event.GroupID, []napcat.ForwardNode{node})
-					if err != nil {
-						logger.Error(fmt.Sprintf("Failed to send forward message: %v", err))
-					}
-				} else {
-					_, err := napcatClient.SendPrivateForwardMsg(ctx.Event.UserID, []napcat.ForwardNode{node})
-					if err != nil {
-						logger.Error(fmt.Sprintf("Failed to send forward message: %v", err))
-					}
-				}
+			thinkingMsg := fmt.Sprintf("thinking: \n---\n%s\n---", response.Thinking)
+			node := bot.NewForwardNode("AI Thinking", ctx.Event.SelfID, bot.TextSegment(thinkingMsg))
+			if err := ctx.ReplyForward([]bot.ForwardNode{node}); err != nil {
+				logger.Error(fmt.Sprintf("Failed to send forward message: %v", err))
+			}
+		}
+
+		if voice != nil && voice.replyEnabled(ctx.Event) {
+			segment, err := voice.synthesize(ctx.Context(), ctx.Event, response.Content)
+			if err == nil {
+				err = ctx.Reply(segment)
+			}
+			if err == nil {
+				return
 			}
+			logger.Warn(fmt.Sprintf("[AIChatPlugin] Voice reply unavailable, falling back to text: %v", err))
 		}
 
 		if ctx.Event.IsGroupMessage() {
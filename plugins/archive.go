@@ -0,0 +1,81 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/archive"
+)
+
+const (
+	searchResultLimit  = 10
+	searchSnippetRunes = 60
+)
+
+func ArchivePlugin(cfg *config.Config) bot.HandlerFunc {
+	store := archive.Default()
+	if store == nil {
+		return func(ctx *bot.Context) {}
+	}
+
+	search := bot.OnCommand(cfg.CommandPrefix, "search", func(ctx *bot.Context) {
+		if !ctx.Event.IsGroupMessage() {
+			ctx.ReplyText("只能在群聊中搜索本群的聊天记录")
+			return
+		}
+
+		keywords := strings.TrimSpace(strings.TrimPrefix(ctx.Event.GetText(), cfg.CommandPrefix+"search"))
+		if keywords == "" {
+			ctx.ReplyText(fmt.Sprintf("用法：%ssearch <关键词>", cfg.CommandPrefix))
+			return
+		}
+
+		records, total := store.Search(archive.Query{
+			Keywords:  keywords,
+			GroupID:   ctx.Event.GroupID,
+			Direction: archive.DirectionIn,
+			Limit:     searchResultLimit + 1,
+		})
+
+		var lines []string
+		for _, record := range records {
+			if record.MessageID == int64(ctx.Event.MessageID) {
+				total--
+				continue
+			}
+			if len(lines) < searchResultLimit {
+				lines = append(lines, formatSearchResult(record))
+			}
+		}
+
+		if len(lines) == 0 {
+			ctx.ReplyText(fmt.Sprintf("没有找到包含「%s」的消息", keywords))
+			return
+		}
+
+		header := fmt.Sprintf("找到 %d 条包含「%s」的消息", total, keywords)
+		if total > len(lines) {
+			header += fmt.Sprintf("，显示最近 %d 条", len(lines))
+		}
+		ctx.ReplyText(header + "：\n" + strings.Join(lines, "\n"))
+	})
+
+	return func(ctx *bot.Context) {
+		if ctx.Event.IsGroupMessage() || ctx.Event.IsPrivateMessage() {
+			store.Add(archive.FromEvent(ctx.Event))
+		}
+
+		search(ctx)
+	}
+}
+
+func formatSearchResult(record archive.Record) string {
+	text := []rune(strings.ReplaceAll(record.Text, "\n", " "))
+	if len(text) > searchSnippetRunes {
+		text = append(text[:searchSnippetRunes], []rune("…")...)
+	}
+	return fmt.Sprintf("[%s] %s：%s", time.Unix(record.Time, 0).Format("01-02 15:04"), record.SenderName, string(text))
+}
@@ -1,50 +1,50 @@
 package plugins
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/crayon/wrap-bot/internal/config"
 	"github.com/crayon/wrap-bot/pkgs/bot"
 	aiconfig "github.com/crayon/wrap-bot/pkgs/feature/ai/config"
 	"github.com/crayon/wrap-bot/pkgs/feature/ai/factory"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/vision"
 	"github.com/crayon/wrap-bot/pkgs/feature/chat_explainer"
+	"github.com/crayon/wrap-bot/pkgs/feature/jobs"
 	"github.com/crayon/wrap-bot/pkgs/logger"
 	"github.com/crayon/wrap-bot/pkgs/napcat"
 )
 
+// matchExplain accepts forwarded chats and /explain commands, so the
+// explainer claims them before AI chat sees them.
+func matchExplain(cfg *config.Config) bot.Matcher {
+	command := cfg.CommandPrefix + "explain"
+	return func(ctx *bot.Context) bool {
+		if !bot.MatchMessage(ctx) {
+			return false
+		}
+		if hasForwardMessage(ctx.Event) {
+			return true
+		}
+		text := strings.TrimSpace(cqCodePattern.ReplaceAllString(ctx.Event.GetText(), ""))
+		return strings.HasPrefix(text, command)
+	}
+}
+
 func ChatExplainerPlugin(cfg *config.Config) bot.HandlerFunc {
 	if !cfg.AIEnabled {
 		return func(ctx *bot.Context) {}
 	}
 
-	aiCfg := &aiconfig.Config{
-		APIURL:           cfg.AIURL,
-		APIKey:           cfg.AIKey,
-		Model:            cfg.AIModel,
-		Temperature:      0.7,
-		TopP:             0.9,
-		MaxTokens:        2000,
-		MaxHistory:       0,
-		SystemPromptPath: cfg.SystemPromptPath,
-		ToolsEnabled:     []string{},
-	}
-
-	factory := factory.NewFactory(aiCfg)
-	chatAgent := factory.CreateAgent()
+	analyzer := newChatExplainerAnalyzer(cfg)
 
-	systemPrompt := ""
-	if cfg.SystemPromptPath != "" {
-		data, err := os.ReadFile(cfg.SystemPromptPath)
-		if err == nil {
-			systemPrompt = string(data)
-		}
-	}
-
-	analyzer := chat_explainer.NewAnalyzer(chatAgent, systemPrompt, 20)
-	parser := chat_explainer.NewParser()
+	baseParser := chat_explainer.NewParser()
+	baseParser.SetMaxDepth(cfg.ExplainerMaxDepth)
 
 	return func(ctx *bot.Context) {
 		if !ctx.Event.IsGroupMessage() && !ctx.Event.IsPrivateMessage() {
@@ -61,24 +61,51 @@ func ChatExplainerPlugin(cfg *config.Config) bot.HandlerFunc {
 			return
 		}
 
-		if !parser.IsForwardMessage(eventMap) {
+		apiClient := ctx.GetAPIClient()
+		if apiClient == nil {
 			return
 		}
+		parser := baseParser.WithFetcher(apiClient)
 
-		forwardID := parser.GetForwardID(eventMap)
-		if forwardID == "" {
-			ctx.ReplyText("无法读取合并转发消息")
-			return
+		mode := chat_explainer.OutputFull
+		var forwardID string
+
+		if parser.IsForwardMessage(eventMap) {
+			forwardID = parser.GetForwardID(eventMap)
+		} else {
+			text := strings.TrimSpace(cqCodePattern.ReplaceAllString(ctx.Event.GetText(), ""))
+			command := cfg.CommandPrefix + "explain"
+			if !strings.HasPrefix(text, command) {
+				return
+			}
+
+			var ok bool
+			mode, ok = chat_explainer.ParseOutputMode(strings.TrimPrefix(text, command))
+			if !ok {
+				ctx.ReplyText(explainUsage(cfg))
+				return
+			}
+
+			replyID, ok := parser.GetReplyID(eventMap)
+			if !ok {
+				ctx.ReplyText(explainUsage(cfg))
+				return
+			}
+
+			replied, err := apiClient.GetMsgRaw(replyID)
+			if err != nil || !parser.IsForwardMessage(replied) {
+				ctx.ReplyText("被回复的消息不是合并转发消息")
+				return
+			}
+			forwardID = parser.GetForwardID(replied)
 		}
 
-		apiClient := ctx.GetAPIClient()
-		napcatClient, ok := apiClient.(*napcat.Client)
-		if !ok {
-			ctx.ReplyText("API客户端不可用")
+		if forwardID == "" {
+			ctx.ReplyText("无法读取合并转发消息")
 			return
 		}
 
-		forwardData, err := napcatClient.GetForwardMsg(forwardID)
+		forwardData, err := apiClient.GetForwardMsg(forwardID)
 		if err != nil {
 			logger.Error(fmt.Sprintf("Failed to get forward message: %v", err))
 			ctx.ReplyText("无法读取合并转发消息内容")
@@ -97,32 +124,134 @@ func ChatExplainerPlugin(cfg *config.Config) bot.HandlerFunc {
 			return
 		}
 
-		ctx.ReplyText("正在分析对话，请稍候...")
+		if mode == chat_explainer.OutputExport {
+			exportTranscript(ctx, apiClient, forwardedChat)
+			return
+		}
 
-		analysis, err := analyzer.AnalyzeAll(context.Background(), forwardedChat.Messages)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to analyze chat: %v", err))
-			ctx.ReplyText("分析失败，请稍后重试")
+		jobCtx := vision.WithImageFiles(eventContext(ctx), chat_explainer.ImageFiles(forwardedChat.Messages))
+		job, err := jobs.Default().Start(jobCtx, "chat_explainer", ctx.Event.UserID, ctx.Event.GroupID)
+		if errors.Is(err, jobs.ErrTooManyJobs) {
+			ctx.ReplyText(fmt.Sprintf("你已有任务在进行中，请等待完成或发送 %scancel 取消", cfg.CommandPrefix))
 			return
 		}
 
-		nodes := chat_explainer.BuildForwardNodesWithMerge(
-			forwardedChat.Messages,
-			analysis.MessageAnalyses,
-			analysis.Summary,
-			ctx.Event.SelfID,
-			analysis.MergedGroup,
-		)
+		ctx.ReplyText(fmt.Sprintf("正在生成%s，共 %d 条消息（任务 %s），发送 %scancel 可取消", chat_explainer.OutputModeTitle(mode), len(forwardedChat.Messages), job.ID(), cfg.CommandPrefix))
+		// The job can take minutes; let the chat's later messages, including
+		// a /cancel for it, through meanwhile.
+		ctx.Release()
 
-		if ctx.Event.IsGroupMessage() {
-			_, err = napcatClient.SendGroupForwardMsg(ctx.Event.GroupID, nodes)
+		var nodes []napcat.ForwardNode
+		stopProgress := reportJobProgress(cfg, ctx, job)
+		if mode == chat_explainer.OutputFull {
+			var analysis *chat_explainer.ChatAnalysis
+			analysis, err = analyzer.AnalyzeAll(job.Context(), forwardedChat.Messages, job.SetProgress)
+			if err == nil {
+				nodes = chat_explainer.BuildForwardNodesWithMerge(
+					forwardedChat.Messages,
+					analysis.MessageAnalyses,
+					analysis.Summary,
+					ctx.Event.SelfID,
+					analysis.MergedGroup,
+				)
+			}
 		} else {
-			_, err = napcatClient.SendPrivateForwardMsg(ctx.Event.UserID, nodes)
+			var explanation string
+			explanation, err = analyzer.Explain(job.Context(), forwardedChat.Messages, mode)
+			if err == nil {
+				nodes = []napcat.ForwardNode{
+					napcat.NewMixedForwardNode(chat_explainer.OutputModeTitle(mode), ctx.Event.SelfID, napcat.NewTextSegment(explanation)),
+				}
+			}
 		}
+		stopProgress()
+		job.Finish(err)
 
+		if job.Cancelled() {
+			ctx.ReplyText(fmt.Sprintf("任务 %s 已取消", job.ID()))
+			return
+		}
 		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to analyze chat: %v", err))
+			ctx.ReplyText("分析失败，请稍后重试")
+			return
+		}
+
+		if err := ctx.ReplyForward(nodes); err != nil {
 			logger.Error(fmt.Sprintf("Failed to send forward message: %v", err))
 			ctx.ReplyText("发送解读结果失败")
 		}
 	}
 }
+
+func newChatExplainerAnalyzer(cfg *config.Config) *chat_explainer.Analyzer {
+	aiCfg := &aiconfig.Config{
+		APIURL:            cfg.AIURL,
+		APIKey:            cfg.AIKey,
+		Model:             cfg.AIModel,
+		Temperature:       0.7,
+		TopP:              0.9,
+		MaxTokens:         2000,
+		MaxHistory:        0,
+		SystemPromptPath:  cfg.SystemPromptPath,
+		ToolsEnabled:      []string{},
+		ImageDetail:       cfg.AIImageDetail,
+		ImageCacheDir:     cfg.AIImageCacheDir,
+		ImageMaxBytes:     cfg.AIImageMaxBytes,
+		ImageMaxDimension: cfg.AIImageMaxDimension,
+	}
+
+	factory := factory.NewFactory(aiCfg)
+	factory.ImagePipeline().SetResolver(newNapCatImageResolver(int64(cfg.AIImageMaxBytes)))
+	chatAgent := factory.CreateAgent()
+
+	systemPrompt := ""
+	if cfg.SystemPromptPath != "" {
+		data, err := os.ReadFile(cfg.SystemPromptPath)
+		if err == nil {
+			systemPrompt = string(data)
+		}
+	}
+
+	analyzer := chat_explainer.NewAnalyzer(chatAgent, systemPrompt, 20)
+	analyzer.SetOptions(chat_explainer.AnalyzerOptions{
+		Mode:              chat_explainer.AnalysisMode(cfg.ExplainerMode),
+		WindowSize:        cfg.ExplainerWindowSize,
+		Concurrency:       cfg.ExplainerConcurrency,
+		TimeoutPerRequest: time.Duration(cfg.ExplainerTimeoutSeconds) * time.Second,
+	})
+	return analyzer
+}
+
+var cqCodePattern = regexp.MustCompile(`\[CQ:[^\]]+\]`)
+
+func explainUsage(cfg *config.Config) string {
+	return fmt.Sprintf(`回复一条合并转发消息并发送：
+%[1]sexplain - 逐条解读并总结
+%[1]sexplain 总结 - 只输出整体总结
+%[1]sexplain 术语 - 术语表
+%[1]sexplain 时间线 - 关键事件、决定与待办
+%[1]sexplain 立场 - 各参与者的观点
+%[1]sexplain 导出 - 导出 Markdown 聊天记录文件`, cfg.CommandPrefix)
+}
+
+func exportTranscript(ctx *bot.Context, client bot.APIClient, chat *chat_explainer.ForwardedChat) {
+	now := time.Now()
+	markdown := chat_explainer.BuildMarkdownTranscript(chat, now)
+	file := bot.MediaBytes([]byte(markdown))
+	name := fmt.Sprintf("聊天记录_%s.md", now.Format("20060102_150405"))
+
+	var err error
+	if ctx.Event.IsGroupMessage() {
+		err = client.UploadGroupFile(ctx.Event.GroupID, file, name, "")
+	} else {
+		err = client.UploadPrivateFile(ctx.Event.UserID, file, name)
+	}
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to upload transcript: %v", err))
+		ctx.ReplyText("导出聊天记录失败")
+		return
+	}
+	ctx.ReplyText(fmt.Sprintf("已导出 %s", name))
+}
@@ -0,0 +1,171 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/vision"
+	"github.com/crayon/wrap-bot/pkgs/feature/chat_explainer"
+	"github.com/crayon/wrap-bot/pkgs/feature/digest"
+	"github.com/crayon/wrap-bot/pkgs/feature/jobs"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+const (
+	defaultSummaryWindow = 2 * time.Hour
+	minDigestMessages    = 5
+)
+
+func DigestPlugin(cfg *config.Config) bot.HandlerFunc {
+	recorder := digest.Default()
+	if recorder == nil {
+		return func(ctx *bot.Context) {}
+	}
+
+	analyzer := newChatExplainerAnalyzer(cfg)
+
+	parser := chat_explainer.NewParser()
+	parser.SetMaxDepth(1)
+
+	summary := bot.OnCommand(cfg.CommandPrefix, "summary", func(ctx *bot.Context) {
+		if !ctx.Event.IsGroupMessage() || !recorder.Enabled(ctx.Event.GroupID) {
+			ctx.ReplyText("本群未开启群聊摘要")
+			return
+		}
+
+		window := defaultSummaryWindow
+		if arg := strings.TrimSpace(strings.TrimPrefix(ctx.Event.GetText(), cfg.CommandPrefix+"summary")); arg != "" {
+			parsed, err := digest.ParseWindow(arg)
+			if err != nil {
+				ctx.ReplyText(fmt.Sprintf("用法：%ssummary [时长]，例如 %[1]ssummary 2h、%[1]ssummary 30m", cfg.CommandPrefix))
+				return
+			}
+			window = parsed
+		}
+
+		retention := time.Duration(cfg.DigestRetentionHours) * time.Hour
+		if window > retention {
+			window = retention
+		}
+
+		messages := recorder.Since(ctx.Event.GroupID, time.Now().Add(-window))
+		if len(messages) < minDigestMessages {
+			ctx.ReplyText(fmt.Sprintf("最近 %s 内的消息太少，无需摘要", formatWindow(window)))
+			return
+		}
+
+		jobCtx := vision.WithImageFiles(eventContext(ctx), chat_explainer.ImageFiles(messages))
+		job, err := jobs.Default().Start(jobCtx, "digest", ctx.Event.UserID, ctx.Event.GroupID)
+		if errors.Is(err, jobs.ErrTooManyJobs) {
+			ctx.ReplyText(fmt.Sprintf("你已有任务在进行中，请等待完成或发送 %scancel 取消", cfg.CommandPrefix))
+			return
+		}
+
+		ctx.ReplyText(fmt.Sprintf("正在总结最近 %s 的 %d 条消息（任务 %s）", formatWindow(window), len(messages), job.ID()))
+		ctx.Release()
+
+		result, err := analyzer.Digest(job.Context(), messages)
+		job.Finish(err)
+
+		if job.Cancelled() {
+			ctx.ReplyText(fmt.Sprintf("任务 %s 已取消", job.ID()))
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("[Digest] Failed to generate digest: %v", err))
+			ctx.ReplyText("生成摘要失败，请稍后重试")
+			return
+		}
+
+		title := fmt.Sprintf("最近 %s 的群聊摘要", formatWindow(window))
+		nodes := chat_explainer.BuildDigestNodes(result, title, ctx.Event.SelfID)
+		if err := ctx.ReplyForward(nodes); err != nil {
+			logger.Error(fmt.Sprintf("[Digest] Failed to send digest: %v", err))
+			ctx.ReplyText("发送摘要失败")
+		}
+	})
+
+	optOut := bot.OnCommand(cfg.CommandPrefix, "digest", func(ctx *bot.Context) {
+		arg := strings.TrimSpace(strings.TrimPrefix(ctx.Event.GetText(), cfg.CommandPrefix+"digest"))
+
+		var err error
+		switch arg {
+		case "off", "关闭":
+			err = recorder.SetOptOut(ctx.Event.UserID, true)
+			if err == nil {
+				ctx.ReplyText("已退出群聊摘要，你的消息不会再被记录，已记录的内容也已删除")
+			}
+		case "on", "开启":
+			err = recorder.SetOptOut(ctx.Event.UserID, false)
+			if err == nil {
+				ctx.ReplyText("已重新加入群聊摘要")
+			}
+		default:
+			status := "已加入"
+			if recorder.IsOptedOut(ctx.Event.UserID) {
+				status = "已退出"
+			}
+			ctx.ReplyText(fmt.Sprintf("群聊摘要：%s\n%sdigest off - 不再记录我的消息\n%[2]sdigest on - 重新加入", status, cfg.CommandPrefix))
+		}
+
+		if err != nil {
+			logger.Error(fmt.Sprintf("[Digest] Failed to save opt-out list: %v", err))
+			ctx.ReplyText("保存设置失败")
+		}
+	})
+
+	return func(ctx *bot.Context) {
+		if ctx.Event.IsGroupMessage() && recorder.Enabled(ctx.Event.GroupID) && !strings.HasPrefix(ctx.Event.GetText(), cfg.CommandPrefix) {
+			recordGroupMessage(recorder, parser.WithFetcher(ctx.GetAPIClient()), ctx.Event)
+		}
+
+		summary(ctx)
+		optOut(ctx)
+	}
+}
+
+func recordGroupMessage(recorder *digest.Recorder, parser *chat_explainer.Parser, event *bot.Event) {
+	if recorder.IsOptedOut(event.UserID) {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	var eventMap map[string]interface{}
+	if err := json.Unmarshal(data, &eventMap); err != nil {
+		return
+	}
+
+	msg := parser.ParseMessage(eventMap)
+	if event.Sender != nil && event.Sender.Card != "" {
+		msg.SenderName = event.Sender.Card
+	}
+	if msg.Timestamp == 0 {
+		msg.Timestamp = time.Now().Unix()
+	}
+	if msg.Content == "" && len(msg.Images) == 0 {
+		return
+	}
+
+	recorder.Add(event.GroupID, msg)
+}
+
+func formatWindow(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d 天", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d 小时", d/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%.1f 小时", d.Hours())
+	}
+	return fmt.Sprintf("%d 分钟", int(d.Minutes()))
+}
@@ -0,0 +1,88 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/document"
+)
+
+const groupFileBusID = 102
+
+type documentSupport struct {
+	cfg        *config.Config
+	store      *document.Store
+	httpClient *http.Client
+}
+
+func newDocumentSupport(cfg *config.Config) *documentSupport {
+	return &documentSupport{
+		cfg:        cfg,
+		store:      document.NewStore(time.Duration(cfg.AIDocTTLMinutes)*time.Minute, 3, 800),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (d *documentSupport) load(ctx context.Context, api bot.APIClient, event *bot.Event, conversationID string, file bot.FileRef) (*document.Document, error) {
+	if file.Size > d.maxBytes() {
+		return nil, fmt.Errorf("file too large: %d bytes", file.Size)
+	}
+
+	// The size in the event is only what the sender claimed; fetch enforces
+	// the limit on the bytes actually read.
+	data, err := d.fetch(ctx, api, event, file)
+	if err != nil {
+		return nil, err
+	}
+
+	text, kind, err := document.Extract(file.Name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.store.Add(conversationID, file.Name, kind, text), nil
+}
+
+func (d *documentSupport) maxBytes() int64 {
+	return int64(d.cfg.AIFileMaxBytes)
+}
+
+func (d *documentSupport) fetch(ctx context.Context, api bot.APIClient, event *bot.Event, file bot.FileRef) ([]byte, error) {
+	if file.URL != "" {
+		if data, err := loadMediaData(ctx, d.httpClient, "", file.URL, "", d.maxBytes()); err == nil {
+			return data, nil
+		}
+	}
+
+	if api == nil || file.FileID == "" {
+		return nil, fmt.Errorf("file cannot be fetched")
+	}
+
+	if event.IsGroupMessage() {
+		url, err := api.GetGroupFileURL(event.GroupID, file.FileID, groupFileBusID)
+		if err == nil && url != "" {
+			if data, err := loadMediaData(ctx, d.httpClient, "", url, "", d.maxBytes()); err == nil {
+				return data, nil
+			}
+		}
+	}
+
+	info, err := api.GetFile(file.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("get_file failed: %w", err)
+	}
+
+	return loadMediaData(ctx, d.httpClient, info.Base64, info.URL, info.File, d.maxBytes())
+}
+
+func (d *documentSupport) contextFor(conversationID, query string) string {
+	return d.store.BuildContext(conversationID, query, d.cfg.AIDocContextTokens)
+}
+
+func (d *documentSupport) clear(conversationID string) {
+	d.store.Clear(conversationID)
+}
@@ -10,7 +10,14 @@ func HelpPlugin(cfg *config.Config) bot.HandlerFunc {
 		help := `Available commands:
 /ping - Check if bot is alive
 /echo <message> - Echo your message
-/help - Show this help message`
+/help - Show this help message
+/explain [mode] - Reply to a forwarded chat to explain it (总结/术语/时间线/立场/导出)
+/summary [2h] - Summarize recent group chat
+/digest on|off - Opt in or out of group digests
+/search <keywords> - Search this group's chat history
+/jobs - List your running jobs
+/cancel [id] - Cancel your running jobs
+/perm show - Show your role (superusers: /perm for management)`
 
 		ctx.ReplyText(help)
 	})
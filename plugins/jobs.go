@@ -0,0 +1,145 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/jobs"
+	"github.com/crayon/wrap-bot/pkgs/feature/permission"
+)
+
+func JobsPlugin(cfg *config.Config) bot.HandlerFunc {
+	manager := jobs.Default()
+
+	cancel := bot.OnCommand(cfg.CommandPrefix, "cancel", func(ctx *bot.Context) {
+		id := strings.TrimSpace(strings.TrimPrefix(ctx.Event.GetText(), cfg.CommandPrefix+"cancel"))
+		userID := ctx.Event.UserID
+
+		if id == "" {
+			if n := manager.CancelUser(userID); n > 0 {
+				ctx.ReplyText(fmt.Sprintf("已取消 %d 个任务", n))
+			} else {
+				ctx.ReplyText("你没有正在进行的任务")
+			}
+			return
+		}
+
+		err := manager.Cancel(id, userID, permission.Default().ContextRole(ctx) >= permission.RoleBotAdmin)
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			ctx.ReplyText(fmt.Sprintf("任务 %s 不存在或已结束", id))
+		case errors.Is(err, jobs.ErrNotOwner):
+			ctx.ReplyText("只能取消自己发起的任务")
+		case err == nil:
+			ctx.ReplyText(fmt.Sprintf("已取消任务 %s", id))
+		}
+	})
+
+	list := bot.OnCommand(cfg.CommandPrefix, "jobs", func(ctx *bot.Context) {
+		running := manager.Running(ctx.Event.UserID)
+		if len(running) == 0 {
+			ctx.ReplyText("你没有正在进行的任务")
+			return
+		}
+
+		var sb strings.Builder
+		sb.WriteString("进行中的任务：")
+		for _, info := range running {
+			sb.WriteString(fmt.Sprintf("\n%s %s %s，已运行 %s", info.ID, info.Name, progressText(info.Done, info.Total), time.Since(info.StartedAt).Round(time.Second)))
+		}
+		ctx.ReplyText(sb.String())
+	})
+
+	return func(ctx *bot.Context) {
+		cancel(ctx)
+		list(ctx)
+	}
+}
+
+// reportJobProgress posts the job's progress to the chat every
+// JobProgressIntervalSeconds while it changes, recalling the previous progress
+// message so that only the latest one stays visible. The returned function
+// stops reporting and must be called once the job ends.
+func reportJobProgress(cfg *config.Config, ctx *bot.Context, job *jobs.Job) func() {
+	interval := time.Duration(cfg.JobProgressIntervalSeconds) * time.Second
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+
+	if interval <= 0 {
+		close(finished)
+		return func() {}
+	}
+
+	go func() {
+		defer close(finished)
+
+		api := ctx.GetAPIClient()
+		if api == nil {
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastMsgID int32
+		lastDone := -1
+
+		for {
+			select {
+			case <-stop:
+				if lastMsgID != 0 {
+					api.DeleteMessage(lastMsgID)
+				}
+				return
+			case <-job.Context().Done():
+				if lastMsgID != 0 {
+					api.DeleteMessage(lastMsgID)
+				}
+				return
+			case <-ticker.C:
+				done, total := job.Progress()
+				if done == lastDone || total == 0 {
+					continue
+				}
+				lastDone = done
+
+				text := fmt.Sprintf("任务 %s 进行中：%s，发送 %scancel %s 可取消", job.ID(), progressText(done, total), cfg.CommandPrefix, job.ID())
+				msgID, err := sendToEventChat(api, ctx.Event, text)
+				if err != nil {
+					continue
+				}
+				if lastMsgID != 0 {
+					api.DeleteMessage(lastMsgID)
+				}
+				lastMsgID = msgID
+			}
+		}
+	}()
+
+	return func() {
+		select {
+		case <-stop:
+		default:
+			close(stop)
+		}
+		<-finished
+	}
+}
+
+func sendToEventChat(api bot.APIClient, event *bot.Event, message interface{}) (int32, error) {
+	if event.IsGroupMessage() {
+		return api.SendGroupMessage(event.GroupID, message)
+	}
+	return api.SendPrivateMessage(event.UserID, message)
+}
+
+func progressText(done, total int) string {
+	if total == 0 {
+		return "准备中"
+	}
+	return fmt.Sprintf("%d/%d 条消息", done, total)
+}
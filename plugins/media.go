@@ -0,0 +1,102 @@
+package plugins
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/vision"
+)
+
+// loadMediaData reads the payload of a NapCat media lookup, preferring inline
+// base64, then the download URL, then the local path on the NapCat host.
+// Payloads larger than maxBytes are rejected without being read in full.
+func loadMediaData(ctx context.Context, client *http.Client, b64, url, file string, maxBytes int64) ([]byte, error) {
+	if b64 != "" {
+		if int64(base64.StdEncoding.DecodedLen(len(b64))) > maxBytes+2 {
+			return nil, fmt.Errorf("media too large: more than %d bytes", maxBytes)
+		}
+		data, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > maxBytes {
+			return nil, fmt.Errorf("media too large: %d bytes (max %d)", len(data), maxBytes)
+		}
+		return data, nil
+	}
+
+	if url != "" {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("failed to download media: status %d", resp.StatusCode)
+		}
+
+		return readLimited(resp.Body, maxBytes)
+	}
+
+	if file != "" {
+		f, err := os.Open(filepath.Clean(file))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readLimited(f, maxBytes)
+	}
+
+	return nil, fmt.Errorf("media has no retrievable data")
+}
+
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("media too large: more than %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
+type apiClientKey struct{}
+
+// eventContext returns ctx.Context() carrying the API client of the account
+// that received the event and the file ids of its images, so images are
+// resolved through that account.
+func eventContext(ctx *bot.Context) context.Context {
+	c := context.WithValue(ctx.Context(), apiClientKey{}, ctx.GetAPIClient())
+	return vision.WithImageFiles(c, ctx.Event.GetImageFiles())
+}
+
+func newNapCatImageResolver(maxBytes int64) vision.Resolver {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+
+	return func(ctx context.Context, source string) ([]byte, error) {
+		api, _ := ctx.Value(apiClientKey{}).(bot.APIClient)
+		if api == nil {
+			return nil, fmt.Errorf("no API client to resolve image")
+		}
+
+		image, err := api.GetImage(vision.ImageFile(ctx, source))
+		if err != nil {
+			return nil, fmt.Errorf("get_image failed: %w", err)
+		}
+		return loadMediaData(ctx, httpClient, image.Base64, image.URL, image.File, maxBytes)
+	}
+}
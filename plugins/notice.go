@@ -0,0 +1,173 @@
+package plugins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/logger"
+)
+
+// NoticePlugin welcomes new group members, says goodbye to leaving ones,
+// logs recalled messages and answers friend and group requests.
+func NoticePlugin(cfg *config.Config) bot.HandlerFunc {
+	handlers := []bot.HandlerFunc{
+		bot.OnNotice(bot.NoticeTypeGroupIncrease, func(ctx *bot.Context) {
+			if !noticeGroupEnabled(cfg, ctx.Event.GroupID) || ctx.Event.UserID == ctx.Event.SelfID {
+				return
+			}
+
+			logger.Info(fmt.Sprintf("[Notice] User %d joined group %d (%s)", ctx.Event.UserID, ctx.Event.GroupID, ctx.Event.SubType))
+			if cfg.WelcomeMessage == "" {
+				return
+			}
+			if err := ctx.SendTo(bot.GroupTarget(ctx.Event.GroupID), renderNoticeTemplate(ctx, cfg.WelcomeMessage)); err != nil {
+				logger.Error(fmt.Sprintf("[Notice] Failed to send welcome message: %v", err))
+			}
+		}),
+
+		bot.OnNotice(bot.NoticeTypeGroupDecrease, func(ctx *bot.Context) {
+			if !noticeGroupEnabled(cfg, ctx.Event.GroupID) {
+				return
+			}
+
+			if ctx.Event.SubType == "kick_me" {
+				logger.Warn(fmt.Sprintf("[Notice] Bot was removed from group %d by %d", ctx.Event.GroupID, ctx.Event.OperatorID))
+				return
+			}
+
+			logger.Info(fmt.Sprintf("[Notice] User %d left group %d (%s, operator %d)", ctx.Event.UserID, ctx.Event.GroupID, ctx.Event.SubType, ctx.Event.OperatorID))
+			if cfg.FarewellMessage == "" {
+				return
+			}
+			if err := ctx.SendTo(bot.GroupTarget(ctx.Event.GroupID), renderNoticeTemplate(ctx, cfg.FarewellMessage)); err != nil {
+				logger.Error(fmt.Sprintf("[Notice] Failed to send farewell message: %v", err))
+			}
+		}),
+
+		bot.OnNotice(bot.NoticeTypeGroupRecall, func(ctx *bot.Context) {
+			if !cfg.AntiRecallEnabled || !noticeGroupEnabled(cfg, ctx.Event.GroupID) {
+				return
+			}
+			logRecall(ctx)
+		}),
+
+		bot.OnRequest("", func(ctx *bot.Context) {
+			handleRequest(cfg, ctx)
+		}),
+	}
+
+	return func(ctx *bot.Context) {
+		if !ctx.Event.IsNotice() && !ctx.Event.IsRequest() {
+			return
+		}
+		for _, handler := range handlers {
+			handler(ctx)
+		}
+	}
+}
+
+func noticeGroupEnabled(cfg *config.Config, groupID int64) bool {
+	return len(cfg.NoticeGroups) == 0 || containsInt64(cfg.NoticeGroups, groupID)
+}
+
+// renderNoticeTemplate fills in {name}, {user_id} and {group_id} and turns
+// each {at} into a mention of the member.
+func renderNoticeTemplate(ctx *bot.Context, template string) *bot.MessageBuilder {
+	userID := ctx.Event.UserID
+	replacer := strings.NewReplacer(
+		"{name}", memberName(ctx, userID),
+		"{user_id}", strconv.FormatInt(userID, 10),
+		"{group_id}", strconv.FormatInt(ctx.Event.GroupID, 10),
+	)
+
+	msg := bot.NewMessage()
+	for i, part := range strings.Split(template, "{at}") {
+		if i > 0 {
+			msg.At(userID)
+		}
+		if text := replacer.Replace(part); text != "" {
+			msg.Text(text)
+		}
+	}
+	return msg
+}
+
+func memberName(ctx *bot.Context, userID int64) string {
+	if api := ctx.GetAPIClient(); api != nil {
+		if info, err := api.GetStrangerInfo(userID, false); err == nil && info.Nickname != "" {
+			return info.Nickname
+		}
+	}
+	return strconv.FormatInt(userID, 10)
+}
+
+func logRecall(ctx *bot.Context) {
+	event := ctx.Event
+	content := "(内容不可用)"
+	if api := ctx.GetAPIClient(); api != nil {
+		if msg, err := api.GetMsg(int64(event.MessageID)); err == nil {
+			content = msg.RawMessage
+		}
+	}
+
+	logger.Info(fmt.Sprintf("[AntiRecall] Message %d of user %d in group %d recalled by %d: %s",
+		event.MessageID, event.UserID, event.GroupID, event.OperatorID, content))
+}
+
+func handleRequest(cfg *config.Config, ctx *bot.Context) {
+	event := ctx.Event
+
+	enabled := cfg.AutoApproveFriend
+	if event.RequestType == bot.RequestTypeGroup {
+		enabled = cfg.AutoApproveGroup
+		if event.SubType == "add" && !noticeGroupEnabled(cfg, event.GroupID) {
+			return
+		}
+	}
+	if !enabled {
+		logger.Info(fmt.Sprintf("[Request] Pending %s request from %d: %s", event.RequestType, event.UserID, event.Comment))
+		return
+	}
+
+	approve := requestMatches(cfg, event)
+	if !approve && !cfg.RejectUnmatchedRequests {
+		logger.Info(fmt.Sprintf("[Request] Leaving %s request from %d pending: %s", event.RequestType, event.UserID, event.Comment))
+		return
+	}
+
+	if err := ctx.ApproveRequest(approve, ""); err != nil {
+		logger.Error(fmt.Sprintf("[Request] Failed to answer %s request from %d: %v", event.RequestType, event.UserID, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("[Request] %s %s request (%s) from %d: %s", approvalWord(approve), event.RequestType, event.SubType, event.UserID, event.Comment))
+}
+
+// requestMatches approves whitelisted users and requests whose comment
+// contains one of the configured keywords. Group invitations have no
+// comment, so only the whitelist applies to them.
+func requestMatches(cfg *config.Config, event *bot.Event) bool {
+	if containsInt64(cfg.ApproveUsers, event.UserID) {
+		return true
+	}
+	if event.RequestType == bot.RequestTypeGroup && event.SubType == "invite" {
+		return false
+	}
+
+	comment := strings.ToLower(event.Comment)
+	for _, keyword := range cfg.ApproveKeywords {
+		if strings.Contains(comment, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+func approvalWord(approve bool) string {
+	if approve {
+		return "Approved"
+	}
+	return "Rejected"
+}
@@ -0,0 +1,175 @@
+package plugins
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/permission"
+)
+
+var atCodePattern = regexp.MustCompile(`\[CQ:at,qq=(\d+)[^\]]*\]`)
+
+func PermPlugin(cfg *config.Config) bot.HandlerFunc {
+	manager := permission.Default()
+	usage := fmt.Sprintf(`用法：
+%[1]sperm show [@用户|QQ] - 查看角色和授权
+%[1]sperm role <@用户|QQ> <角色> [here] - 设置用户角色
+%[1]sperm reset <@用户|QQ> [here] - 恢复用户默认角色
+%[1]sperm grant <插件|%[1]s命令> <角色> [here] - 设置最低角色
+%[1]sperm revoke <插件|%[1]s命令> [here] - 取消授权
+角色：superuser, bot_admin, group_owner, group_admin, member, blocked
+加 here 只对本群生效`, cfg.CommandPrefix)
+
+	return bot.OnCommand(cfg.CommandPrefix, "perm", func(ctx *bot.Context) {
+		text := strings.TrimPrefix(ctx.Event.GetText(), cfg.CommandPrefix+"perm")
+		args := strings.Fields(atCodePattern.ReplaceAllString(text, " $1 "))
+		if len(args) == 0 {
+			ctx.ReplyText(usage)
+			return
+		}
+
+		action := strings.ToLower(args[0])
+		groupID, args, ok := permScope(ctx, args[1:])
+		if !ok {
+			ctx.ReplyText("here 只能在群聊中使用")
+			return
+		}
+
+		if action == "show" {
+			showPermissions(ctx, manager, groupID, args)
+			return
+		}
+
+		if !canManage(ctx, manager, groupID) {
+			ctx.ReplyText("只有超级用户可以管理权限")
+			return
+		}
+
+		var err error
+		var reply string
+		switch {
+		case action == "role" && len(args) == 2:
+			userID, parseErr := strconv.ParseInt(args[0], 10, 64)
+			role, roleErr := permission.ParseRole(args[1])
+			if parseErr != nil || roleErr != nil {
+				ctx.ReplyText(usage)
+				return
+			}
+			err = manager.SetUserRole(userID, groupID, role)
+			reply = fmt.Sprintf("已将 %d 的角色%s设为%s", userID, scopeText(groupID), role.Label())
+		case action == "reset" && len(args) == 1:
+			userID, parseErr := strconv.ParseInt(args[0], 10, 64)
+			if parseErr != nil {
+				ctx.ReplyText(usage)
+				return
+			}
+			err = manager.ResetUserRole(userID, groupID)
+			reply = fmt.Sprintf("已恢复 %d %s的默认角色", userID, scopeText(groupID))
+		case action == "grant" && len(args) == 2:
+			role, roleErr := permission.ParseRole(args[1])
+			if roleErr != nil {
+				ctx.ReplyText(usage)
+				return
+			}
+			err = manager.SetGrant(args[0], groupID, role)
+			reply = fmt.Sprintf("%s%s需要%s及以上", args[0], scopeText(groupID), role.Label())
+		case action == "revoke" && len(args) == 1:
+			err = manager.RevokeGrant(args[0], groupID)
+			reply = fmt.Sprintf("已取消 %s %s的授权", args[0], scopeText(groupID))
+		default:
+			ctx.ReplyText(usage)
+			return
+		}
+
+		if err != nil {
+			ctx.ReplyText(fmt.Sprintf("修改权限失败：%v", err))
+			return
+		}
+		ctx.ReplyText(reply)
+	})
+}
+
+// permScope strips a trailing "here" from args, which limits the change to
+// the current group. It reports false if "here" is used outside a group.
+func permScope(ctx *bot.Context, args []string) (int64, []string, bool) {
+	if len(args) == 0 || !strings.EqualFold(args[len(args)-1], "here") {
+		return 0, args, true
+	}
+	if !ctx.Event.IsGroupMessage() {
+		return 0, nil, false
+	}
+	return ctx.Event.GroupID, args[:len(args)-1], true
+}
+
+// canManage reports whether the sender may change or inspect the rules of
+// groupID. A superuser role set with "here" only covers that group, so
+// changes everywhere need a superuser outside any group.
+func canManage(ctx *bot.Context, manager *permission.Manager, groupID int64) bool {
+	if groupID != 0 {
+		return manager.ContextRole(ctx) >= permission.RoleSuperuser
+	}
+	return manager.RoleOf(ctx.Event.UserID, 0, "") >= permission.RoleSuperuser
+}
+
+func scopeText(groupID int64) string {
+	if groupID != 0 {
+		return "在本群"
+	}
+	return "在所有聊天中"
+}
+
+// showPermissions tells anyone their own role. Superusers may look up other
+// users and the roles and grants set in the scope.
+func showPermissions(ctx *bot.Context, manager *permission.Manager, groupID int64, args []string) {
+	own := manager.ContextRole(ctx)
+	if len(args) > 0 {
+		if !canManage(ctx, manager, groupID) {
+			ctx.ReplyText("只有超级用户可以查看他人的权限")
+			return
+		}
+		userID, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			ctx.ReplyText("请 @ 用户或填写 QQ 号")
+			return
+		}
+		role := manager.RoleOf(userID, groupID, "")
+		ctx.ReplyText(fmt.Sprintf("%d %s的角色：%s", userID, scopeText(groupID), role.Label()))
+		return
+	}
+
+	if !canManage(ctx, manager, groupID) {
+		ctx.ReplyText(fmt.Sprintf("你的角色：%s", own.Label()))
+		return
+	}
+
+	rules := manager.Rules(groupID)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("你的角色：%s\n%s的设置：", own.Label(), strings.TrimPrefix(scopeText(groupID), "在")))
+	if len(rules.Users) == 0 && len(rules.Grants) == 0 {
+		sb.WriteString("\n无")
+	}
+
+	userIDs := make([]int64, 0, len(rules.Users))
+	for id := range rules.Users {
+		userIDs = append(userIDs, id)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	for _, id := range userIDs {
+		sb.WriteString(fmt.Sprintf("\n用户 %d：%s", id, rules.Users[id].Label()))
+	}
+
+	keys := make([]string, 0, len(rules.Grants))
+	for key := range rules.Grants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("\n%s：%s及以上", key, rules.Grants[key].Label()))
+	}
+	ctx.ReplyText(sb.String())
+}
@@ -5,21 +5,63 @@ import (
 	"github.com/crayon/wrap-bot/pkgs/bot"
 )
 
+// Register adds the plugins enabled by cfg. Recorders run first at
+// PriorityMonitor so they see every message, commands run at
+// PriorityCommand and consume what they match, and AI chat runs last as the
+// catch-all for messages nothing else handled.
 func Register(engine *bot.Engine, cfg *config.Config) {
-	engine.RegisterPlugin("ping", "Simple ping-pong command", PingPlugin(cfg))
-	engine.RegisterPlugin("echo", "Echo back user messages", EchoPlugin(cfg))
-	engine.RegisterPlugin("help", "Show available commands", HelpPlugin(cfg))
+	command := bot.WithPriority(bot.PriorityCommand)
+	matchCommand := func(names ...string) bot.PluginOption {
+		return bot.WithMatcher(bot.MatchCommand(cfg.CommandPrefix, names...))
+	}
+
+	engine.RegisterPlugin("ping", "Simple ping-pong command", PingPlugin(cfg),
+		command, matchCommand("ping"), bot.Consume())
+	engine.RegisterPlugin("echo", "Echo back user messages", EchoPlugin(cfg),
+		command, matchCommand("echo"), bot.Consume())
+	engine.RegisterPlugin("help", "Show available commands", HelpPlugin(cfg),
+		command, matchCommand("help"), bot.Consume())
+	engine.RegisterPlugin("perm", "Roles and command permissions", PermPlugin(cfg),
+		command, matchCommand("perm"), bot.Consume())
+	engine.RegisterPlugin("jobs", "Long-running job status and cancellation", JobsPlugin(cfg),
+		command, matchCommand("jobs", "cancel"), bot.Consume())
+	engine.RegisterPlugin("notice", "Group welcome, farewell, anti-recall and request approval", NoticePlugin(cfg),
+		command, bot.WithMatcher(matchNoticeOrRequest), bot.Consume())
+
+	if cfg.ArchiveEnabled {
+		engine.RegisterPlugin("archive", "Message archive and /search", ArchivePlugin(cfg),
+			bot.WithPriority(bot.PriorityMonitor), bot.WithMatcher(bot.MatchMessage))
+	}
+
+	if cfg.AIEnabled && cfg.DigestEnabled {
+		engine.RegisterPlugin("digest", "Group chat digest and /summary", DigestPlugin(cfg),
+			bot.WithPriority(bot.PriorityMonitor), bot.WithMatcher(bot.MatchMessage))
+	}
 
 	if cfg.AIEnabled {
-		engine.RegisterPlugin("ai_chat", "AI conversation plugin", AIChatPlugin(cfg))
+		engine.RegisterPlugin("ai_chat", "AI conversation plugin", AIChatPlugin(cfg),
+			bot.WithPriority(bot.PriorityFallback), bot.WithMatcher(bot.MatchMessage))
 	}
 	if cfg.HotApiHost != "" && cfg.HotApiKey != "" {
-		engine.RegisterPlugin("tech_push", "Tech news push service", TechPushPlugin(cfg))
+		engine.RegisterPlugin("tech_push", "Tech news push service", TechPushPlugin(cfg),
+			command, bot.WithMatcher(matchRawMessage("/tech")), bot.Consume())
 	}
 	if cfg.RSSApiHost != "" {
-		engine.RegisterPlugin("rss_push", "RSS feed push service", RssPushPlugin(cfg))
+		engine.RegisterPlugin("rss_push", "RSS feed push service", RssPushPlugin(cfg),
+			command, bot.WithMatcher(matchRawMessage("/rss")), bot.Consume())
 	}
 	if cfg.AIEnabled {
-		engine.RegisterPlugin("chat_explainer", "Chat explainer plugin", ChatExplainerPlugin(cfg))
+		engine.RegisterPlugin("chat_explainer", "Chat explainer plugin", ChatExplainerPlugin(cfg),
+			command, bot.WithMatcher(matchExplain(cfg)), bot.Consume())
+	}
+}
+
+func matchNoticeOrRequest(ctx *bot.Context) bool {
+	return ctx.Event.IsNotice() || ctx.Event.IsRequest()
+}
+
+func matchRawMessage(text string) bot.Matcher {
+	return func(ctx *bot.Context) bool {
+		return ctx.Event.RawMessage == text
 	}
 }
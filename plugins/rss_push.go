@@ -52,8 +52,6 @@ func RssPushPlugin(cfg *config.Config) bot.HandlerFunc {
 					logger.Info("RSS push succeeded")
 				}
 			}()
-			return
 		}
-		ctx.Next()
 	}
 }
@@ -51,8 +51,6 @@ func TechPushPlugin(cfg *config.Config) bot.HandlerFunc {
 					logger.Error(fmt.Sprintf("Tech push failed: %v", err))
 				}
 			}()
-			return
 		}
-		ctx.Next()
 	}
 }
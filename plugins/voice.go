@@ -0,0 +1,101 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/crayon/wrap-bot/internal/config"
+	"github.com/crayon/wrap-bot/pkgs/bot"
+	"github.com/crayon/wrap-bot/pkgs/feature/ai/audio"
+)
+
+const (
+	maxSpeechRunes = 500
+	// maxVoiceBytes is the largest upload speech-to-text APIs accept.
+	maxVoiceBytes = 25 * 1024 * 1024
+)
+
+type voiceSupport struct {
+	cfg        *config.Config
+	client     *audio.Client
+	httpClient *http.Client
+}
+
+func newVoiceSupport(cfg *config.Config, client *audio.Client) *voiceSupport {
+	if !cfg.AIVoiceEnabled || client == nil {
+		return nil
+	}
+
+	return &voiceSupport{
+		cfg:        cfg,
+		client:     client,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (v *voiceSupport) transcribe(ctx context.Context, api bot.APIClient, file string) (string, error) {
+	if api == nil {
+		return "", fmt.Errorf("API client not available")
+	}
+
+	record, err := api.GetRecord(file, "mp3")
+	if err != nil {
+		return "", fmt.Errorf("failed to get record: %w", err)
+	}
+
+	data, err := loadMediaData(ctx, v.httpClient, record.Base64, record.URL, record.File, maxVoiceBytes)
+	if err != nil {
+		return "", err
+	}
+
+	filename := record.FileName
+	if filename == "" {
+		filename = "voice.mp3"
+	}
+
+	return v.client.Transcribe(ctx, data, filename)
+}
+
+func (v *voiceSupport) replyEnabled(event *bot.Event) bool {
+	if event.IsGroupMessage() {
+		if _, ok := v.cfg.AITTSVoices[event.GroupID]; ok {
+			return true
+		}
+		return containsInt64(v.cfg.AITTSGroups, event.GroupID)
+	}
+	return containsInt64(v.cfg.AITTSUsers, event.UserID)
+}
+
+func (v *voiceSupport) voiceFor(event *bot.Event) string {
+	if event.IsGroupMessage() {
+		if voice, ok := v.cfg.AITTSVoices[event.GroupID]; ok {
+			return voice
+		}
+	}
+	return v.cfg.AITTSVoice
+}
+
+func (v *voiceSupport) synthesize(ctx context.Context, event *bot.Event, text string) (bot.MessageSegment, error) {
+	if utf8.RuneCountInString(text) > maxSpeechRunes {
+		return bot.MessageSegment{}, fmt.Errorf("reply too long for speech (%d runes)", utf8.RuneCountInString(text))
+	}
+
+	data, err := v.client.Speech(ctx, text, v.voiceFor(event))
+	if err != nil {
+		return bot.MessageSegment{}, err
+	}
+
+	return bot.RecordSegment(bot.MediaBytes(data)), nil
+}
+
+func containsInt64(slice []int64, item int64) bool {
+	for _, v := range slice {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -6,7 +6,7 @@ import type { WebSocketEvent } from '@/types/api';
 
 export function useWebSocket() {
   const { token } = useAuthStore();
-  const { setStatus, setPlugins, setTasks, addLog } = useBotStore();
+  const { setStatus, setPlugins, setTasks, setJobs, setConnection, setOutbound, addLog } = useBotStore();
 
   const handleMessage = useCallback((event: WebSocketEvent) => {
     switch (event.type) {
@@ -19,11 +19,20 @@ export function useWebSocket() {
       case 'tasks':
         setTasks(event.data);
         break;
+      case 'jobs':
+        setJobs(event.data);
+        break;
+      case 'connection':
+        setConnection(event.data);
+        break;
+      case 'outbound':
+        setOutbound(event.data);
+        break;
       case 'log':
         addLog(event.data);
         break;
     }
-  }, [setStatus, setPlugins, setTasks, addLog]);
+  }, [setStatus, setPlugins, setTasks, setJobs, setConnection, setOutbound, addLog]);
 
   useEffect(() => {
     if (!token) return;
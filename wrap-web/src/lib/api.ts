@@ -4,6 +4,7 @@ import type {
   LoginResponse,
   BotStatus,
   Plugin,
+  RateLimitRule,
   Task,
   ConfigItem,
   LogEntry,
@@ -19,6 +20,10 @@ import type {
   TriggerTaskResponse,
   TogglePluginResponse,
   ErrorResponse,
+  ArchiveQuery,
+  ArchiveMessagesResponse,
+  ArchiveGroupsResponse,
+  OutboundResponse,
 } from '@/types/api';
 
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || '';
@@ -74,6 +79,11 @@ class ApiClient {
     return response.data;
   }
 
+  async setPluginRateLimit(name: string, rule: RateLimitRule): Promise<Plugin> {
+    const response = await this.client.put<Plugin>(`/api/plugins/${name}/rate-limit`, rule);
+    return response.data;
+  }
+
   async getTasks(): Promise<Task[]> {
     const response = await this.client.get<Task[]>('/api/tasks');
     return response.data;
@@ -132,6 +142,29 @@ class ApiClient {
     const response = await this.client.post<ChatResponse>('/api/ai/chat/image', data);
     return response.data;
   }
+
+  async getOutbound(): Promise<OutboundResponse> {
+    const response = await this.client.get<OutboundResponse>('/api/outbound');
+    return response.data;
+  }
+
+  async getArchiveMessages(query: ArchiveQuery): Promise<ArchiveMessagesResponse> {
+    const response = await this.client.get<ArchiveMessagesResponse>('/api/archive/messages', { params: query });
+    return response.data;
+  }
+
+  async getArchiveGroups(): Promise<ArchiveGroupsResponse> {
+    const response = await this.client.get<ArchiveGroupsResponse>('/api/archive/groups');
+    return response.data;
+  }
+
+  async exportArchive(query: ArchiveQuery, format: 'jsonl' | 'csv' | 'txt'): Promise<Blob> {
+    const response = await this.client.get<Blob>('/api/archive/export', {
+      params: { ...query, format },
+      responseType: 'blob',
+    });
+    return response.data;
+  }
 }
 
 export const apiClient = new ApiClient();
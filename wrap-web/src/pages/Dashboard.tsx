@@ -1,5 +1,5 @@
 import { useEffect } from 'react';
-import { Activity, Clock } from 'lucide-react';
+import { Activity, Clock, Inbox } from 'lucide-react';
 import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card';
 import { useBotStore } from '@/stores/bot';
 import { apiClient } from '@/lib/api';
@@ -40,7 +40,7 @@ export function Dashboard() {
         <p className="text-muted-foreground">Bot运行状态</p>
       </div>
 
-      <div className="grid gap-4 md:grid-cols-2">
+      <div className="grid gap-4 md:grid-cols-2 lg:grid-cols-3">
         <Card>
           <CardHeader className="flex flex-row items-center justify-between space-y-0 pb-2">
             <CardTitle className="text-sm font-medium">运行状态</CardTitle>
@@ -70,6 +70,23 @@ export function Dashboard() {
             </p>
           </CardContent>
         </Card>
+
+        <Card>
+          <CardHeader className="flex flex-row items-center justify-between space-y-0 pb-2">
+            <CardTitle className="text-sm font-medium">事件队列</CardTitle>
+            <Inbox className="h-4 w-4 text-muted-foreground" />
+          </CardHeader>
+          <CardContent>
+            <div className="text-2xl font-bold">
+              {status?.queue ? `${status.queue.in_flight} / ${status.queue.workers}` : '--'}
+            </div>
+            <p className="text-xs text-muted-foreground">
+              {status?.queue
+                ? `等待 ${status.queue.pending} · 已处理 ${status.queue.processed} · 丢弃 ${status.queue.dropped}`
+                : '暂无数据'}
+            </p>
+          </CardContent>
+        </Card>
       </div>
     </div>
   );
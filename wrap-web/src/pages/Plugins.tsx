@@ -1,11 +1,100 @@
-import { useEffect } from 'react';
+import { useEffect, useState } from 'react';
 import { Puzzle } from 'lucide-react';
 import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card';
 import { Switch } from '@/components/ui/switch';
 import { Badge } from '@/components/ui/badge';
+import { Button } from '@/components/ui/button';
+import { Input } from '@/components/ui/input';
+import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from '@/components/ui/select';
 import { useBotStore } from '@/stores/bot';
 import { apiClient } from '@/lib/api';
 import { toast } from 'sonner';
+import type { Plugin, RateLimitRule, RateLimitScope } from '@/types/api';
+
+const scopeLabels: Record<RateLimitScope, string> = {
+  user: '每用户',
+  group: '每群',
+  command: '所有人共享',
+};
+
+function RateLimitEditor({ plugin, onSaved }: { plugin: Plugin; onSaved: (plugin: Plugin) => void }) {
+  const [events, setEvents] = useState(String(plugin.rate_limit?.events ?? ''));
+  const [windowSeconds, setWindowSeconds] = useState(String(plugin.rate_limit?.window_seconds ?? 60));
+  const [scope, setScope] = useState<RateLimitScope>(plugin.rate_limit?.scope ?? 'user');
+  const [saving, setSaving] = useState(false);
+
+  const save = async (rule: RateLimitRule) => {
+    try {
+      setSaving(true);
+      const updated = await apiClient.setPluginRateLimit(plugin.name, rule);
+      onSaved(updated);
+      toast.success(rule.events > 0 ? `插件 ${plugin.name} 已限流` : `插件 ${plugin.name} 已取消限流`);
+    } catch (error: any) {
+      toast.error(error.response?.data?.error || '保存失败');
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  return (
+    <div className="space-y-2 border-t pt-3">
+      <p className="text-xs text-muted-foreground">
+        {plugin.rate_limit
+          ? `限流：${plugin.rate_limit.window_seconds} 秒内 ${plugin.rate_limit.events} 次（${scopeLabels[plugin.rate_limit.scope]}）`
+          : '未限流'}
+      </p>
+      <div className="flex items-center gap-2">
+        <Input
+          type="number"
+          min={1}
+          value={events}
+          onChange={(e) => setEvents(e.target.value)}
+          placeholder="次数"
+          className="w-20"
+        />
+        <Input
+          type="number"
+          min={1}
+          value={windowSeconds}
+          onChange={(e) => setWindowSeconds(e.target.value)}
+          placeholder="秒"
+          className="w-20"
+        />
+        <Select value={scope} onValueChange={(value) => setScope(value as RateLimitScope)}>
+          <SelectTrigger className="w-[120px]">
+            <SelectValue />
+          </SelectTrigger>
+          <SelectContent>
+            {(Object.keys(scopeLabels) as RateLimitScope[]).map((key) => (
+              <SelectItem key={key} value={key}>
+                {scopeLabels[key]}
+              </SelectItem>
+            ))}
+          </SelectContent>
+        </Select>
+      </div>
+      <div className="flex gap-2">
+        <Button
+          size="sm"
+          disabled={saving || !(Number(events) > 0) || !(Number(windowSeconds) > 0)}
+          onClick={() => save({ events: Number(events), window_seconds: Number(windowSeconds), scope })}
+        >
+          保存
+        </Button>
+        {plugin.rate_limit && (
+          <Button
+            size="sm"
+            variant="outline"
+            disabled={saving}
+            onClick={() => save({ events: 0, window_seconds: 0, scope })}
+          >
+            取消限流
+          </Button>
+        )}
+      </div>
+    </div>
+  );
+}
 
 export function Plugins() {
   const { plugins, setPlugins, updatePlugin, setLoading, setError } = useBotStore();
@@ -26,6 +115,12 @@ export function Plugins() {
     fetchPlugins();
   }, [setPlugins, setLoading, setError]);
 
+  const handleRateLimitSaved = (updated: Plugin) => {
+    setPlugins(
+      useBotStore.getState().plugins.map((plugin) => (plugin.name === updated.name ? updated : plugin))
+    );
+  };
+
   const handleToggle = async (name: string) => {
     try {
       const result = await apiClient.togglePlugin(name);
@@ -55,16 +150,23 @@ export function Plugins() {
               </div>
               <Puzzle className="h-5 w-5 text-muted-foreground" />
             </CardHeader>
-            <CardContent>
+            <CardContent className="space-y-3">
               <div className="flex items-center justify-between">
-                <Badge variant={plugin.enabled ? 'default' : 'secondary'}>
-                  {plugin.enabled ? '已启用' : '已禁用'}
-                </Badge>
+                <div className="flex items-center gap-2">
+                  <Badge variant={plugin.enabled ? 'default' : 'secondary'}>
+                    {plugin.enabled ? '已启用' : '已禁用'}
+                  </Badge>
+                  <span className="text-xs text-muted-foreground">
+                    优先级 {plugin.priority}
+                    {plugin.consume ? ' · 独占' : ''}
+                  </span>
+                </div>
                 <Switch
                   checked={plugin.enabled}
                   onCheckedChange={() => handleToggle(plugin.name)}
                 />
               </div>
+              <RateLimitEditor plugin={plugin} onSaved={handleRateLimitSaved} />
             </CardContent>
           </Card>
         ))}
@@ -1,10 +1,13 @@
 import { create } from 'zustand';
-import type { BotStatus, Plugin, Task, LogEntry } from '@/types/api';
+import type { BotStatus, Plugin, Task, Job, LogEntry, ConnectionState, OutboundDelivery } from '@/types/api';
 
 interface BotState {
   status: BotStatus | null;
   plugins: Plugin[];
   tasks: Task[];
+  jobs: Job[];
+  connections: Record<string, ConnectionState>;
+  outbound: OutboundDelivery[];
   logs: LogEntry[];
   isLoading: boolean;
   error: string | null;
@@ -13,6 +16,9 @@ interface BotState {
   setPlugins: (plugins: Plugin[]) => void;
   updatePlugin: (name: string, enabled: boolean) => void;
   setTasks: (tasks: Task[]) => void;
+  setJobs: (jobs: Job[]) => void;
+  setConnection: (connection: ConnectionState) => void;
+  setOutbound: (outbound: OutboundDelivery[]) => void;
   addLog: (log: LogEntry) => void;
   setLogs: (logs: LogEntry[]) => void;
   setLoading: (loading: boolean) => void;
@@ -23,6 +29,9 @@ export const useBotStore = create<BotState>((set) => ({
   status: null,
   plugins: [],
   tasks: [],
+  jobs: [],
+  connections: {},
+  outbound: [],
   logs: [],
   isLoading: false,
   error: null,
@@ -38,6 +47,14 @@ export const useBotStore = create<BotState>((set) => ({
   })),
   
   setTasks: (tasks) => set({ tasks }),
+
+  setJobs: (jobs) => set({ jobs }),
+
+  setConnection: (connection) => set((state) => ({
+    connections: { ...state.connections, [connection.account]: connection },
+  })),
+
+  setOutbound: (outbound) => set({ outbound }),
   
   addLog: (log) => set((state) => ({
     logs: [...state.logs.slice(-99), log],
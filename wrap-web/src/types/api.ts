@@ -9,17 +9,38 @@ export interface LoginResponse {
   token: string;
 }
 
+export interface QueueStats {
+  policy: 'block' | 'drop_oldest' | 'per_chat';
+  workers: number;
+  pending: number;
+  in_flight: number;
+  processed: number;
+  dropped: number;
+}
+
 export interface BotStatus {
   running: boolean;
   uptime: number;
   version: string;
   go_version: string;
+  queue?: QueueStats;
+}
+
+export type RateLimitScope = 'user' | 'group' | 'command';
+
+export interface RateLimitRule {
+  events: number;
+  window_seconds: number;
+  scope: RateLimitScope;
 }
 
 export interface Plugin {
   name: string;
   enabled: boolean;
   description: string;
+  priority: number;
+  consume: boolean;
+  rate_limit: RateLimitRule | null;
 }
 
 export interface Task {
@@ -33,6 +54,94 @@ export interface Task {
   description: string;
 }
 
+export interface Job {
+  id: string;
+  name: string;
+  user_id: number;
+  group_id: number;
+  status: 'running' | 'completed' | 'failed' | 'cancelled';
+  done: number;
+  total: number;
+  error?: string;
+  started_at: string;
+  updated_at: string;
+  finished_at?: string;
+}
+
+export interface OutboundDelivery {
+  id: string;
+  source: string;
+  message_type: 'group' | 'private';
+  target_id: number;
+  status: 'queued' | 'sending' | 'retrying' | 'sent' | 'failed';
+  attempts: number;
+  message_id?: number;
+  error?: string;
+  error_category?: string;
+  queued_at: string;
+  updated_at: string;
+}
+
+export interface OutboundStats {
+  queued: number;
+  sent: number;
+  failed: number;
+  retried: number;
+}
+
+export interface OutboundResponse {
+  stats: OutboundStats;
+  deliveries: OutboundDelivery[];
+}
+
+export interface MessageSegment {
+  type: string;
+  data: Record<string, any>;
+}
+
+export interface ArchiveMessage {
+  message_id: number;
+  direction: 'in' | 'out';
+  message_type: 'group' | 'private';
+  group_id?: number;
+  user_id: number;
+  sender_name: string;
+  segments: MessageSegment[];
+  text: string;
+  time: number;
+}
+
+export interface ArchiveQuery {
+  q?: string;
+  group_id?: number;
+  user_id?: number;
+  direction?: 'in' | 'out';
+  since?: string;
+  until?: string;
+  offset?: number;
+  limit?: number;
+}
+
+export interface ArchiveMessagesResponse {
+  total: number;
+  offset: number;
+  limit: number;
+  messages: ArchiveMessage[];
+}
+
+export interface ArchiveGroupStat {
+  group_id: number;
+  count: number;
+  first_time: number;
+  last_time: number;
+}
+
+export interface ArchiveGroupsResponse {
+  total: number;
+  retention_days: number;
+  groups: ArchiveGroupStat[];
+}
+
 export interface ConfigItem {
   key: string;
   value: string;
@@ -117,7 +226,18 @@ export interface ErrorResponse {
 }
 
 // WebSocket事件类型
-export type WebSocketEventType = 'status' | 'plugins' | 'tasks' | 'log';
+export type WebSocketEventType = 'status' | 'plugins' | 'tasks' | 'jobs' | 'log' | 'connection' | 'outbound';
+
+// NapCat WebSocket连接状态
+export interface ConnectionState {
+  account: string;
+  state: 'connected' | 'disconnected' | 'reconnecting';
+  url: string;
+  attempt: number;
+  delay_ms: number;
+  error: string;
+  time: number;
+}
 
 export interface WebSocketEvent<T = any> {
   type: WebSocketEventType;